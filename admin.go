@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 管理接口的鉴权中间件：请求需在 Authorization: Bearer <token> 或 X-Admin-Token 中携带 ADMIN_TOKEN
+// 未配置 ADMIN_TOKEN 时管理接口一律返回 403，避免在没有鉴权的情况下暴露
+func requireAdmin(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			abortRespond(c, http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "Admin endpoints are disabled, set ADMIN_TOKEN to enable them",
+			})
+			return
+		}
+		if !tokenMatches(c, "X-Admin-Token", token) {
+			abortRespond(c, http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Invalid or missing admin token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// 需要 API_KEY 的接口的鉴权中间件：请求需在 Authorization: Bearer <key> 或 X-API-Key 中携带 API_KEY
+// 未配置 API_KEY 时这些接口一律返回 403
+func requireAPIKey(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey == "" {
+			abortRespond(c, http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "This endpoint is disabled, set API_KEY to enable it",
+			})
+			return
+		}
+		if !tokenMatches(c, "X-API-Key", apiKey) {
+			abortRespond(c, http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// 从 Authorization: Bearer <token> 或指定的请求头中取出令牌，与 expected 做常量时间比较
+func tokenMatches(c *gin.Context, header, expected string) bool {
+	provided := c.GetHeader(header)
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		provided = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 归档时写入的归档时间元数据
+const archiveMetaArchivedAt = "archived-at"
+
+// /archive 允许指定的存储类型
+var storageClasses = map[string]oss.StorageClassType{
+	"Standard":        oss.StorageStandard,
+	"IA":              oss.StorageIA,
+	"Archive":         oss.StorageArchive,
+	"ColdArchive":     oss.StorageColdArchive,
+	"DeepColdArchive": oss.StorageDeepColdArchive,
+}
+
+// 解析 ARCHIVE_METADATA：逗号分隔的 name=value，归档时覆盖到对象的自定义元数据上
+func parseMetadataOverlay(value string) (map[string]string, error) {
+	overlay := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(pair, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid metadata entry %q, expected name=value", pair)
+		}
+		overlay[name] = strings.TrimSpace(val)
+	}
+	return overlay, nil
+}
+
+// 把对象复制到 dest 并改为 class 存储类型：保留原对象的类型、缓存头和自定义元数据，
+// 再叠加 overlay 和归档时间（同名的以 overlay 为准）；返回新对象实际的存储类型
+func archiveObject(bucket *oss.Bucket, key, dest string, class oss.StorageClassType, overlay map[string]string, options ...oss.Option) (string, error) {
+	meta, err := bucket.GetObjectDetailedMeta(key, options...)
+	if err != nil {
+		return "", err
+	}
+	exclude := []string{archiveMetaArchivedAt}
+	for name := range overlay {
+		exclude = append(exclude, name)
+	}
+	copyOptions := append(objectHeaderOptions(meta, exclude...),
+		oss.MetadataDirective(oss.MetaReplace),
+		oss.ObjectStorageClass(class),
+		oss.Meta(archiveMetaArchivedAt, time.Now().UTC().Format(time.RFC3339)),
+		oss.CopySourceIfMatch(meta.Get("ETag")),
+	)
+	for name, value := range overlay {
+		copyOptions = append(copyOptions, oss.Meta(name, value))
+	}
+	if _, err := bucket.CopyObject(key, dest, append(copyOptions, options...)...); err != nil {
+		return "", err
+	}
+	destMeta, err := bucket.GetObjectDetailedMeta(dest, options...)
+	if err != nil {
+		return "", fmt.Errorf("archived but failed to read back storage class: %w", err)
+	}
+	// 标准存储的对象不返回 x-oss-storage-class
+	if sc := destMeta.Get(oss.HTTPHeaderOssStorageClass); sc != "" {
+		return sc, nil
+	}
+	return string(oss.StorageStandard), nil
+}
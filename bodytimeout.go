@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const uploadBodyContextKey = "uploadBody"
+
+var errUploadStalled = errors.New("upload body read timed out")
+
+// timeoutBody 为请求体设置读取截止时间，防止客户端打开上传后长时间不发送数据（slowloris）一直占用连接和 goroutine：
+//   - idle：每次读取最多等待的时间，期间没有收到任何数据即中止
+//   - total：读取整个请求体的时间上限，为 0 时不限制
+//
+// 截止时间设置在底层连接上，超时后连接不可再用，服务端发出响应后关闭连接
+type timeoutBody struct {
+	body     io.ReadCloser
+	rc       *http.ResponseController
+	idle     time.Duration
+	deadline time.Time // total 对应的截止时间，零值表示不限制
+	stalled  atomic.Bool
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	deadline := time.Now().Add(b.idle)
+	if !b.deadline.IsZero() && b.deadline.Before(deadline) {
+		deadline = b.deadline
+	}
+	b.rc.SetReadDeadline(deadline)
+	n, err := b.body.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		b.stalled.Store(true)
+		return n, errUploadStalled
+	}
+	if err == io.EOF {
+		// 读完后清除截止时间，否则处理请求期间 net/http 检测连接断开的后台读取会在截止时间到达时取消请求
+		b.rc.SetReadDeadline(time.Time{})
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	return b.body.Close()
+}
+
+// 上传类接口的中间件，见 timeoutBody；idle 为 0 时不启用
+// 连接不支持设置读取截止时间时（例如经过某些包装的 ResponseWriter）不做限制
+func uploadReadTimeout(idle, total time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if idle <= 0 {
+			c.Next()
+			return
+		}
+		rc := http.NewResponseController(c.Writer)
+		if err := rc.SetReadDeadline(time.Now().Add(idle)); err != nil {
+			if errors.Is(err, http.ErrNotSupported) {
+				c.Next()
+				return
+			}
+			log.Printf("Failed to set upload read deadline: %v", err)
+		}
+		body := &timeoutBody{body: c.Request.Body, rc: rc, idle: idle}
+		if total > 0 {
+			body.deadline = time.Now().Add(total)
+		}
+		c.Request.Body = body
+		c.Set(uploadBodyContextKey, body)
+		c.Next()
+		// 读取超时后保留已经过去的截止时间：net/http 写响应前会读掉剩余的请求体，清除截止时间会让它一直等待停止发送的客户端
+		if !body.stalled.Load() {
+			rc.SetReadDeadline(time.Time{})
+		}
+	}
+}
+
+// 请求体是否因读取超时而中止，处理函数据此返回 408
+func uploadStalled(c *gin.Context) bool {
+	body, ok := c.Get(uploadBodyContextKey)
+	return ok && body.(*timeoutBody).stalled.Load()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 发送声明了 Content-Length 的请求，先写入 sent，之后每隔 interval 写入一个字节，返回服务端的响应
+func trickleRequest(t *testing.T, serverURL, method, path string, declared int, sent string, interval time.Duration) *http.Response {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "%s %s HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\n\r\n%s", method, path, declared, sent)
+	if interval > 0 {
+		go func() {
+			for i := len(sent); i < declared; i++ {
+				time.Sleep(interval)
+				if _, err := conn.Write([]byte("x")); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	return resp
+}
+
+func newTimeoutRouter(idle, total time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/upload", uploadReadTimeout(idle, total), func(c *gin.Context) {
+		if _, err := io.Copy(io.Discard, c.Request.Body); err != nil {
+			if uploadStalled(c) {
+				c.JSON(http.StatusRequestTimeout, gin.H{"message": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	return r
+}
+
+func TestUploadReadTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		idle, total time.Duration
+		declared    int
+		sent        string
+		interval    time.Duration
+		want        int
+	}{
+		{"complete body", 200 * time.Millisecond, 0, 10, strings.Repeat("x", 10), 0, http.StatusOK},
+		{"body stops", 100 * time.Millisecond, 0, 50, "abc", 0, http.StatusRequestTimeout},
+		{"gaps longer than idle", 100 * time.Millisecond, 0, 50, "abc", 300 * time.Millisecond, http.StatusRequestTimeout},
+		// 每个字节都在 idle 内到达，但整个请求体超过了 total
+		{"trickle exceeds total", 200 * time.Millisecond, 300 * time.Millisecond, 50, "abc", 20 * time.Millisecond, http.StatusRequestTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(newTimeoutRouter(tt.idle, tt.total))
+			defer server.Close()
+			start := time.Now()
+			resp := trickleRequest(t, server.URL, http.MethodPut, "/upload", tt.declared, tt.sent, tt.interval)
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("request took %v, the timeout did not fire", elapsed)
+			}
+		})
+	}
+}
+
+// 改写对象时请求体中断：返回 408，已经开始的分片上传被取消，原对象不变
+func TestPatchStalledBodyAbortsMultipartUpload(t *testing.T) {
+	fake := newFakeOSS(t)
+	bucket := fake.bucket(t)
+	original := []byte(strings.Repeat("a", 300))
+	fake.put("file.bin", original, nil)
+	opts := partSizeOptions{threshold: 100, minSize: 100, maxSize: 1000, defaultSize: 100}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PATCH("/patch/:object", uploadReadTimeout(100*time.Millisecond, 0), func(c *gin.Context) {
+		meta, err := bucket.GetObjectDetailedMeta(c.Param("object"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		if _, _, err := patchObject(bucket, c.Param("object"), meta, 150, c.Request.Body, c.Request.ContentLength, opts); err != nil {
+			if uploadStalled(c) {
+				c.JSON(http.StatusRequestTimeout, gin.H{"message": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp := trickleRequest(t, server.URL, http.MethodPatch, "/patch/file.bin", 50, "bbbbbbbbbb", 0)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusRequestTimeout)
+	}
+	if aborted := fake.abortedUploads(); len(aborted) != 1 {
+		t.Errorf("aborted uploads = %v, want exactly one", aborted)
+	}
+	if open := fake.openUploads(); open != 0 {
+		t.Errorf("%d multipart upload(s) left open", open)
+	}
+	if obj, _ := fake.object("file.bin"); string(obj.data) != string(original) {
+		t.Errorf("object was modified by the failed patch")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常放行
+	BreakerOpen     = "open"      // OSS 连续失败，冷却期内直接返回 503
+	BreakerHalfOpen = "half-open" // 冷却期结束，放行一个探测请求，成功后恢复，失败则重新打开
+)
+
+// ossBreaker 包在 OSS 调用外的熔断器：连续 threshold 次连接错误或 5xx 后打开，cooldown 内的请求直接返回 503，
+// 不再排队等待注定超时的 OSS 调用；threshold 为 0 时不启用
+// 结果在 OSS 客户端的传输层记录（包括后台任务的调用），放行与否在请求入口判断
+type ossBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	exempt    map[string]bool
+
+	mu       sync.Mutex
+	state    string
+	failures int       // 连续失败次数
+	until    time.Time // 打开状态的结束时间，半开状态下为探测请求的超时时间
+	opened   int64     // 累计打开次数
+	rejected int64
+}
+
+func newOSSBreaker(threshold int, cooldown time.Duration) *ossBreaker {
+	return &ossBreaker{threshold: threshold, cooldown: cooldown, exempt: make(map[string]bool), state: BreakerClosed}
+}
+
+func (b *ossBreaker) enabled() bool {
+	return b.threshold > 0
+}
+
+// 不访问 OSS 的路由不受熔断影响
+func (b *ossBreaker) skip(paths ...string) {
+	for _, path := range paths {
+		b.exempt[path] = true
+	}
+}
+
+// 请求能否放行；拒绝时返回距离下一次探测的时间
+// 探测请求可能根本没有调用 OSS（例如参数错误），因此半开状态超过 cooldown 仍没有结果时再放行一个
+func (b *ossBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	switch {
+	case b.state == BreakerClosed:
+		return true, 0
+	case now.Before(b.until):
+		b.rejected++
+		return false, b.until.Sub(now)
+	}
+	if b.state == BreakerOpen {
+		log.Printf("OSS circuit breaker half-open, probing")
+	}
+	b.state, b.until = BreakerHalfOpen, now.Add(b.cooldown)
+	return true, 0
+}
+
+// 记录一次 OSS 调用的结果
+func (b *ossBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		if b.state != BreakerClosed {
+			log.Printf("OSS circuit breaker closed")
+		}
+		b.state, b.failures = BreakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		log.Printf("OSS circuit breaker open for %s after %d consecutive failure(s)", b.cooldown, b.failures)
+		b.state, b.until = BreakerOpen, time.Now().Add(b.cooldown)
+		b.opened++
+	}
+}
+
+// 中间件：熔断器打开时返回 503 和 Retry-After
+func (b *ossBreaker) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !b.enabled() || b.exempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+		if ok, wait := b.allow(); !ok {
+			c.Header("Retry-After", strconv.Itoa(max(1, int(wait.Seconds()+0.5))))
+			abortRespond(c, http.StatusServiceUnavailable, gin.H{
+				"status":  "error",
+				"message": "OSS is currently unavailable, please retry later",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (b *ossBreaker) stats() gin.H {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := gin.H{
+		"enabled":             b.enabled(),
+		"state":               b.state,
+		"consecutiveFailures": b.failures,
+		"opened":              b.opened,
+		"rejected":            b.rejected,
+	}
+	if b.state == BreakerOpen {
+		stats["retryAt"] = b.until.UTC()
+	}
+	return stats
+}
+
+// breakerTransport 在 OSS 客户端的传输层记录每次请求的结果：连接错误和 5xx 算失败，
+// 其余响应（包括 404 等 4xx）说明 OSS 正常工作；调用方主动取消的请求不计入
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *ossBreaker
+}
+
+func (t breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil && (errors.Is(err, context.Canceled) || req.Context().Err() != nil):
+	case err != nil:
+		t.breaker.record(true)
+	default:
+		t.breaker.record(resp.StatusCode >= 500)
+	}
+	return resp, err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/gin-gonic/gin"
+)
+
+// 多租户：请求可通过 X-OSS-Bucket 指定 ALLOWED_BUCKETS 中的存储桶，未指定时使用 OSS_BUCKET_NAME
+// 所有存储桶使用同一个 OSS 客户端（相同的 endpoint 和访问密钥）
+const bucketHeader = "X-OSS-Bucket"
+
+const selectedBucketKey = "selectedBucket"
+
+type bucketSet struct {
+	defaultBucket *oss.Bucket
+	allowed       map[string]*oss.Bucket
+}
+
+func newBucketSet(client *oss.Client, defaultBucket *oss.Bucket, names []string) (*bucketSet, error) {
+	s := &bucketSet{defaultBucket: defaultBucket, allowed: map[string]*oss.Bucket{defaultBucket.BucketName: defaultBucket}}
+	for _, name := range names {
+		if _, ok := s.allowed[name]; ok {
+			continue
+		}
+		b, err := client.Bucket(name)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %q: %v", name, err)
+		}
+		s.allowed[name] = b
+	}
+	return s, nil
+}
+
+// 逗号分隔的存储桶名，忽略空项
+func parseBucketNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// 按 X-OSS-Bucket 选择本次请求使用的存储桶，不在允许列表中的存储桶返回 403
+func (s *bucketSet) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.GetHeader(bucketHeader)
+		if name == "" {
+			c.Next()
+			return
+		}
+		b, ok := s.allowed[name]
+		if !ok {
+			abortRespond(c, http.StatusForbidden, gin.H{
+				"message": fmt.Sprintf("Bucket '%s' is not allowed", name),
+			})
+			return
+		}
+		c.Set(selectedBucketKey, b)
+		c.Next()
+	}
+}
+
+// 本次请求使用的存储桶
+func (s *bucketSet) of(c *gin.Context) *oss.Bucket {
+	if b, ok := c.Get(selectedBucketKey); ok {
+		return b.(*oss.Bucket)
+	}
+	return s.defaultBucket
+}
+
+// 生成 bucket 中对象的地址时使用的配置；其他存储桶的公共读设置和 CDN 域名未知，一律返回不经 CDN 的签名地址
+func (o objectURLOptions) forBucket(bucket *oss.Bucket) objectURLOptions {
+	if bucket.BucketName != o.bucketName {
+		o.bucketName, o.public, o.cdnBaseURL = bucket.BucketName, false, ""
+	}
+	return o
+}
+
+// 列举 bucket 时使用的 lister；列举缓存只保存默认存储桶的结果
+func (l objectLister) forBucket(bucket *oss.Bucket) objectLister {
+	if bucket != l.bucket {
+		l.bucket, l.cache = bucket, nil
+	}
+	return l
+}
+
+// 读取 bucket 时使用的故障转移配置；备用地域只复制了默认存储桶
+func (f *failoverReads) forBucket(bucket *oss.Bucket) *failoverReads {
+	if bucket == f.primary {
+		return f
+	}
+	return &failoverReads{primary: bucket, primaryRegion: f.primaryRegion}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// 上传时计算的 SHA-256 保存在自定义元数据 x-oss-meta-sha256 中
+const (
+	checksumMetaKey    = "sha256"
+	checksumMetaHeader = "X-Oss-Meta-Sha256"
+	// verify=true 时通过 trailer 返回校验结果：ok、mismatch 或 unavailable（对象没有存储校验值）
+	checksumTrailer = "X-Checksum-Sha256-Status"
+	// CopyObject 只能复制不超过 1GB 的对象，更大的对象无法通过原地复制写入校验值
+	maxCopyObjectSize = 1 << 30
+)
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// contentDigests 上传内容的摘要，均为十六进制
+type contentDigests struct {
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5"`
+	CRC32  string `json:"crc32"` // IEEE 多项式
+}
+
+// OSS 的 Content-MD5 请求头使用 base64 编码的原始摘要
+func (d contentDigests) contentMD5() string {
+	raw, _ := hex.DecodeString(d.MD5)
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// 客户端提供的内容 MD5，可以是十六进制或 base64（与 Content-MD5 请求头相同）编码，统一转为小写十六进制
+func parseExpectedMD5(value string) (string, error) {
+	if raw, err := hex.DecodeString(value); err == nil && len(raw) == md5.Size {
+		return hex.EncodeToString(raw), nil
+	}
+	if raw, err := base64.StdEncoding.DecodeString(value); err == nil && len(raw) == md5.Size {
+		return hex.EncodeToString(raw), nil
+	}
+	return "", fmt.Errorf("invalid expectedMd5 %q, must be a hex or base64 encoded MD5 digest", value)
+}
+
+// 一次读取同时计算 SHA-256、MD5 和 CRC32，结束后把读取位置重置到开头，方便随后上传
+func computeDigests(r io.ReadSeeker) (contentDigests, error) {
+	sha, sum, crc := sha256.New(), md5.New(), crc32.NewIEEE()
+	if _, err := io.Copy(io.MultiWriter(sha, sum, crc), r); err != nil {
+		return contentDigests{}, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return contentDigests{}, err
+	}
+	return contentDigests{
+		SHA256: hex.EncodeToString(sha.Sum(nil)),
+		MD5:    hex.EncodeToString(sum.Sum(nil)),
+		CRC32:  hex.EncodeToString(crc.Sum(nil)),
+	}, nil
+}
+
+// 严格校验：先把对象完整写入临时文件并计算 SHA-256，一致时返回定位到开头的临时文件
+// 已发出的字节无法撤回，只有这种方式能保证客户端不会收到损坏的数据；调用方负责关闭并删除文件
+func bufferAndVerify(body io.Reader, expected string) (*os.File, error) {
+	tmp, err := os.CreateTemp("", "verify-*")
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, h), body); err == nil {
+		if hex.EncodeToString(h.Sum(nil)) != expected {
+			err = errChecksumMismatch
+		} else {
+			_, err = tmp.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// downloadGzip 下载时的 gzip 压缩配置：小于 minSize 的对象压缩收益抵不过开销，直接原样返回
+type downloadGzip struct {
+	enabled bool
+	minSize int64
+	level   int // 1（最快）到 9（压缩率最高）
+}
+
+// 判断本次下载是否压缩：客户端接受 gzip、对象没有自带 Content-Encoding、大小达到阈值且类型是文本类
+func (g downloadGzip) applies(acceptEncoding, contentEncoding, contentType string, size int64) bool {
+	return g.enabled && contentEncoding == "" && size >= g.minSize &&
+		compressibleType(contentType) && acceptsGzip(acceptEncoding)
+}
+
+// 压缩后的响应与原对象的字节不同，不能沿用原对象的强校验 ETag（缓存和 Range 请求会把两者当成相同的字节），
+// 改为弱校验形式；If-Match、If-None-Match 的比较会去掉 W/，客户端带回时仍能匹配。没有 ETag 时返回空字符串
+func gzipETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return "W/" + etag
+}
+
+// 图片、视频、压缩包等已经压缩过的格式再压缩几乎没有收益
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-ndjson", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// 解析 Accept-Encoding，gzip 或 * 的 q 值不为 0 时接受
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
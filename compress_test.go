@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestDownloadGzipApplies(t *testing.T) {
+	g := downloadGzip{enabled: true, minSize: 1024, level: 6}
+	tests := []struct {
+		name            string
+		gzip            downloadGzip
+		acceptEncoding  string
+		contentEncoding string
+		contentType     string
+		size            int64
+		want            bool
+	}{
+		{"text above threshold", g, "gzip, deflate", "", "text/plain", 4096, true},
+		{"exactly the threshold", g, "gzip", "", "text/plain", 1024, true},
+		{"below threshold", g, "gzip", "", "text/plain", 1023, false},
+		{"disabled", downloadGzip{minSize: 1024, level: 6}, "gzip", "", "text/plain", 4096, false},
+		{"client does not accept gzip", g, "br", "", "text/plain", 4096, false},
+		{"gzip refused with q=0", g, "gzip;q=0, br", "", "text/plain", 4096, false},
+		{"wildcard", g, "*", "", "application/json", 4096, true},
+		{"already encoded", g, "gzip", "br", "text/plain", 4096, false},
+		{"image", g, "gzip", "", "image/png", 4096, false},
+		{"svg", g, "gzip", "", "image/svg+xml", 4096, true},
+		{"zero threshold", downloadGzip{enabled: true, level: 6}, "gzip", "", "text/plain", 1, true},
+	}
+	for _, tt := range tests {
+		if got := tt.gzip.applies(tt.acceptEncoding, tt.contentEncoding, tt.contentType, tt.size); got != tt.want {
+			t.Errorf("%s: applies = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGzipETag(t *testing.T) {
+	tests := []struct {
+		etag, want string
+	}{
+		{`"ABC"`, `W/"ABC"`},
+		{`W/"ABC"`, `W/"ABC"`},
+		{``, ``},
+	}
+	for _, tt := range tests {
+		got := gzipETag(tt.etag)
+		if got != tt.want {
+			t.Errorf("gzipETag(%q) = %q, want %q", tt.etag, got, tt.want)
+		}
+		// 客户端带回压缩响应的 ETag 时仍与原对象匹配
+		if tt.etag != "" && !etagMatches(got, tt.etag) {
+			t.Errorf("etagMatches(%q, %q) = false", got, tt.etag)
+		}
+	}
+}
+
+// 与下载时相同的写法：按配置的级别压缩
+func gzipBytes(t testing.TB, data []byte, level int) []byte {
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz.Write(data)
+	gz.Close()
+	return buf.Bytes()
+}
+
+func compressibleSample(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, `{"id":%d,"name":"object-%d","tags":["a","b","c"]}`+"\n", i, i%97)
+	}
+	return buf.Bytes()[:size]
+}
+
+// 级别越高压缩率越高：级别 9 的结果不大于级别 1，且都能解压回原内容
+func TestGzipLevelHonored(t *testing.T) {
+	data := compressibleSample(256 << 10)
+	fast, best := gzipBytes(t, data, 1), gzipBytes(t, data, 9)
+	if len(best) > len(fast) {
+		t.Errorf("level 9 produced %d bytes, more than level 1 (%d bytes)", len(best), len(fast))
+	}
+	for _, compressed := range [][]byte{fast, best} {
+		r, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(r)
+		if !bytes.Equal(got, data) {
+			t.Fatal("decompressed content differs from the original")
+		}
+	}
+}
+
+// go test -bench DownloadGzip：对比各压缩级别的吞吐量和压缩率（ratio 为压缩后/压缩前），
+// 以及低于 DOWNLOAD_GZIP_MIN_SIZE 时直接跳过压缩的开销
+func BenchmarkDownloadGzip(b *testing.B) {
+	for _, size := range []int{512, 64 << 10, 1 << 20} {
+		data := compressibleSample(size)
+		for _, level := range []int{1, 6, 9} {
+			g := downloadGzip{enabled: true, minSize: 1024, level: level}
+			b.Run(fmt.Sprintf("size=%d/level=%d", size, level), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				var out int
+				for i := 0; i < b.N; i++ {
+					counter := &countingWriter{}
+					if g.applies("gzip", "", "application/json", int64(size)) {
+						gz, _ := gzip.NewWriterLevel(counter, g.level)
+						io.Copy(gz, bytes.NewReader(data))
+						gz.Close()
+					} else {
+						io.Copy(counter, bytes.NewReader(data))
+					}
+					out = counter.n
+				}
+				b.ReportMetric(float64(out)/float64(size), "ratio")
+			})
+		}
+	}
+}
+
+type countingWriter struct{ n int }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// concatPart 拼接下载中的一个对象，etag 用于保证读取到的是检查时的版本
+type concatPart struct {
+	key  string
+	etag string
+	size int64 // 未知时为 -1
+	meta http.Header
+}
+
+// 拼接前逐个读取元数据，任何一个对象不存在都在开始发送之前返回错误
+// 返回的 total 为所有对象大小之和，有对象大小未知时为 -1；出错时 failed 为出错的对象名
+func statConcatParts(bucket *oss.Bucket, keys []string, options ...oss.Option) (parts []concatPart, total int64, failed string, err error) {
+	for _, key := range keys {
+		meta, err := bucket.GetObjectDetailedMeta(key, options...)
+		if err != nil {
+			return nil, 0, key, err
+		}
+		size, err := strconv.ParseInt(meta.Get("Content-Length"), 10, 64)
+		if err != nil {
+			size = -1
+		}
+		if size < 0 || total < 0 {
+			total = -1
+		} else {
+			total += size
+		}
+		parts = append(parts, concatPart{key: key, etag: meta.Get("ETag"), size: size, meta: meta})
+	}
+	return parts, total, "", nil
+}
+
+// 按顺序读取每个对象并依次写入 dst；以 If-Match 读取，对象在检查之后被修改或删除时中止
+// 响应此时已经开始，调用方只能记录日志并断开连接
+func streamConcat(ctx context.Context, dst io.Writer, bucket *oss.Bucket, parts []concatPart, options ...oss.Option) (int64, error) {
+	var written int64
+	for _, part := range parts {
+		body, err := bucket.GetObject(part.key, append(options, oss.IfMatch(part.etag))...)
+		if err != nil {
+			return written, fmt.Errorf("%s: %w", part.key, err)
+		}
+		stop := context.AfterFunc(ctx, func() { body.Close() })
+		n, err := copyWithContext(ctx, dst, body)
+		stop()
+		body.Close()
+		written += n
+		if err != nil {
+			return written, fmt.Errorf("%s: %w", part.key, err)
+		}
+		if part.size >= 0 && n != part.size {
+			return written, fmt.Errorf("%s: read %d bytes, expected %d", part.key, n, part.size)
+		}
+	}
+	return written, nil
+}
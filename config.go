@@ -0,0 +1,817 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// Config 服务的全部配置，启动时从环境变量读取一次，各处理函数只读取这个结构体
+type Config struct {
+	// OSS 连接信息
+	Endpoint        string
+	AccessKeyID     string
+	AccessKeySecret string
+	BucketName      string
+
+	// 跨地域读故障转移：/download 和 /meta 在主存储桶返回连接错误或 5xx 时改读备用地域的复制存储桶
+	// 两者都为空时不启用，备用存储桶使用相同的访问密钥
+	FailoverEndpoint   string
+	FailoverBucketName string
+
+	// 请求可通过 X-OSS-Bucket 请求头选择的其他存储桶（逗号分隔），OSS_BUCKET_NAME 始终允许
+	AllowedBuckets string
+
+	// OSS 客户端选项：User-Agent 便于在 OSS 侧按来源统计和排查，超时和连接池用于调整 HTTP 传输
+	OSSUserAgent           string // 为空时使用 SDK 默认值
+	OSSConnectTimeout      time.Duration
+	OSSReadWriteTimeout    time.Duration
+	OSSMaxIdleConns        int
+	OSSMaxIdleConnsPerHost int
+	OSSMaxConnsPerHost     int           // 为 0 时不限制
+	OSSIdleConnTimeout     time.Duration // 空闲连接保留多久后关闭，为 0 时不关闭
+
+	// 上传请求的 multipart 限制，防止超大请求体或海量字段耗尽资源
+	MaxMultipartMemory    int64         // 解析表单时驻留内存的上限
+	MaxUploadBodySize     int64         // 整个请求体的上限，0 表示不限制
+	MaxFormParts          int           // 字段与文件的总数上限
+	MaxFormFieldSize      int64         // 单个非文件字段的大小上限
+	UploadIdleTimeout     time.Duration // 上传请求体超过这么久没有收到数据时中止并返回 408，为 0 时不限制
+	UploadReadTimeout     time.Duration // 读取整个上传请求体的时间上限，为 0 时不限制
+	UploadForbidOverwrite bool          // 默认禁止覆盖已有对象
+	UploadValidateImages  bool          // 默认校验自称图片的文件能否解码
+	DefaultObjectACL      string        // 上传对象的默认 ACL，为空时继承存储桶的 ACL
+
+	// 对象名长度上限（字节，不超过 OSS 的 1023）和超长时的处理方式：reject 返回 400，truncate 截断文件名主体
+	MaxKeyLength      int
+	KeyLengthStrategy string
+	// 对象名中百分号编码的处理方式（off、normalize、reject），避免 "a b.txt" 和 "a%20b.txt" 成为两个对象，见 applyKeyEncoding
+	KeyEncodingStrategy string
+
+	// 大小写不敏感查找：/download 和 /meta 找不到对象时，在同一目录下按忽略大小写的名字查找，最多检查 scanLimit 个对象
+	CaseInsensitiveLookup    bool
+	CaseInsensitiveScanLimit int
+
+	// 上传 Idempotency-Key 的记录时长和条目上限，时长为 0 时不启用
+	IdempotencyWindow     time.Duration
+	IdempotencyMaxEntries int
+
+	// 软删除：DELETE /delete/:object 默认把对象移到回收站前缀下而不是直接删除
+	SoftDelete  bool
+	TrashPrefix string
+
+	// POST /archive/:object 的默认目标前缀、存储类型，以及写入的元数据（逗号分隔的 name=value）
+	ArchivePrefix       string
+	ArchiveStorageClass string
+	ArchiveMetadata     string
+
+	// 分片上传：超过阈值的文件按自动计算的分片大小上传
+	MultipartThreshold       int64
+	MultipartMinPartSize     int64
+	MultipartMaxPartSize     int64
+	MultipartDefaultPartSize int64 // 总大小未知时使用
+	// 未完成的分片上传超过这个时间后可被后台清理，浏览器直传的分片签名地址也不会超过这个有效期
+	MultipartUploadTTL time.Duration
+	// 后台清理会取消存储桶中所有超过 MULTIPART_UPLOAD_TTL 的未完成上传，包括其他程序发起的上传，
+	// 因此默认不启动（间隔为 0）；与其他程序共用存储桶时用 MULTIPART_SWEEP_PREFIX 限定为本服务使用的前缀
+	MultipartSweepInterval time.Duration
+	MultipartSweepPrefix   string
+
+	// 转码任务：失败后按指数退避自动重试
+	FFmpegPath            string
+	FFprobePath           string // 用于校验预览片段的范围
+	TranscodeMaxAttempts  int
+	TranscodeRetryBackoff time.Duration
+	// 单次 ffmpeg（转码、缩略图）和 ffprobe 运行的时间上限，超时后终止进程
+	FFmpegTimeout  time.Duration
+	FFprobeTimeout time.Duration
+	// 同时执行的转码任务数和排队的任务数上限，队列已满时返回 429 和 Retry-After
+	TranscodeWorkers    int
+	TranscodeQueueSize  int
+	TranscodeRetryAfter time.Duration
+	// 生成缩略图时源图的字节数和像素数（宽 x 高）上限，超出时返回 413，避免解码巨大的图片耗尽内存
+	ThumbnailMaxSourceSize int64
+	ThumbnailMaxPixels     int64
+
+	// 异步任务记录的持久化方式：memory、file 或 oss
+	JobStore     string
+	JobStorePath string
+	JobStoreKey  string
+	// 已结束的任务保留的时间和数量上限，超出后在创建新任务时删除；为 0 表示不限制
+	JobRetention   time.Duration
+	JobMaxFinished int
+
+	// 上传成功后返回的对象地址
+	CDNBaseURL       string
+	BucketPublic     bool
+	PresignExpiry    time.Duration
+	PresignMaxExpiry time.Duration
+
+	// GET /presign/post 生成的表单直传 policy：允许的 key 前缀、文件大小上限和有效期
+	PostPolicyKeyPrefix string
+	PostPolicyMaxSize   int64
+	PostPolicyExpiry    time.Duration
+
+	// GET /presign/delete/:object 签发的删除地址的默认有效期和上限；持有地址的任何人都能删除对象，应尽量短
+	PresignDeleteExpiry    time.Duration
+	PresignDeleteMaxExpiry time.Duration
+
+	// 下载文件名模板，支持 {key}、{basename}、{timestamp}、{random}、{ext}
+	DownloadFilenameTemplate string
+	// {random} 的长度和字符集，字符集中重复的字符只计一次
+	RandomNameLength  int
+	RandomNameCharset string
+	// 下载以 "/" 结尾的前缀时返回该前缀下的索引对象（例如 index.html），默认为空即不启用
+	IndexDocument string
+	// POST /download/session/:object 创建的续传会话的有效期
+	DownloadSessionTTL time.Duration
+	// POST /download/concat 一次最多拼接的对象数
+	ConcatMaxObjects int
+
+	// /inline 以 base64 直接返回内容的对象大小上限
+	InlineMaxSize int64
+	// GET /preview 返回的字节数上限
+	PreviewMaxBytes int64
+
+	// 按存储的 Content-Type 内联展示的类型（逗号分隔，支持 image/* 通配），其余类型作为附件下载
+	InlineContentTypes string
+	// 下载时未声明字符集则补充 charset=utf-8 的类型（逗号分隔，支持通配）
+	CharsetContentTypes string
+
+	// 下载文本类对象时按 Accept-Encoding 使用 gzip 压缩：小于最小大小的对象不压缩，压缩级别 1-9
+	DownloadGzip        bool
+	DownloadGzipMinSize int64
+	DownloadGzipLevel   int
+
+	// 下载的本地磁盘缓存，目录为空时不启用；启动时会清理上次运行留下的缓存文件
+	DownloadCacheDir     string
+	DownloadCacheMaxSize int64
+
+	// 列举对象时使用 ListObjectsV2（continuation token 分页，返回对象所有者）
+	ListUseV2 bool
+	// 列举时隐藏以 "/" 结尾的 0 字节目录标记对象
+	ListHideDirectoryMarkers bool
+	// 列举结果的缓存时间，为 0 时不缓存；超过条目上限时淘汰最早的结果
+	ListCacheTTL        time.Duration
+	ListCacheMaxEntries int
+	// /list 按分区并行列举时的并发数
+	ListConcurrency int
+	// POST /search 暴力内容搜索：单个对象的大小上限、一次搜索的下载总量上限和并发下载数
+	SearchMaxObjectSize int64
+	SearchMaxTotalBytes int64
+	SearchConcurrency   int
+	// GET /usage 用量报告的缓存时间，为 0 时不缓存
+	UsageCacheTTL time.Duration
+	// /list/by-tag、/delete/by-tag 并发查询对象标签的请求数
+	TagScanConcurrency int
+	// POST /meta/batch 一次最多查询的对象数和并发 HEAD 请求数
+	MetaBatchMaxKeys     int
+	MetaBatchConcurrency int
+	// GET /tree 的最大层数、最多返回的节点数、最多发出的列举请求数和用时上限（为 0 时不限制用时）
+	TreeMaxDepth     int
+	TreeMaxNodes     int
+	TreeMaxListCalls int
+	TreeTimeout      time.Duration
+	// /list 的软截止时间：到时仍未列举完时返回已有结果和续传标记，为 0 时不限制
+	ListSoftDeadline time.Duration
+	// /list 返回的续传游标的有效期，为 0 时不过期
+	ListCursorTTL time.Duration
+
+	// 上传、删除事件的 webhook 通知
+	WebhookURL        string
+	WebhookSecret     string // 用于 HMAC 签名
+	WebhookEvents     string // 逗号分隔的订阅事件
+	WebhookTimeout    time.Duration
+	WebhookMaxRetries int
+
+	// 出站请求（webhook、从 URL 导入）的目标限制：主机名允许/禁止列表（支持 *.example.com）和 CIDR 允许/禁止列表
+	// 默认禁止私有、回环和链路本地地址，OUTBOUND_ALLOW_CIDRS 中的地址和 OUTBOUND_ALLOW_PRIVATE=true 可以放行
+	OutboundAllowHosts   string
+	OutboundDenyHosts    string
+	OutboundAllowCIDRs   string
+	OutboundDenyCIDRs    string
+	OutboundAllowPrivate bool
+	// POST /upload/url 从远端下载一个文件的时间上限，包括写入 OSS 的时间
+	ImportTimeout time.Duration
+	// 同时进行的导入任务数上限，达到上限时新的导入请求返回 429
+	ImportMaxConcurrency int
+
+	// OSS 读、写并发名额，每个进行中的 OSS 请求占用一个；请求入口和请求发起的每次 OSS 调用最多等待 OSSAcquireTimeout，仍没有空闲名额时返回 503
+	OSSMaxReadConcurrency  int
+	OSSMaxWriteConcurrency int
+	OSSAcquireTimeout      time.Duration
+	OSSRetryAfter          time.Duration
+	// OSS 熔断：连续 threshold 次连接错误或 5xx 后，cooldown 内的请求直接返回 503；threshold 为 0 时不启用
+	OSSBreakerThreshold int
+	OSSBreakerCooldown  time.Duration
+	// OSS 限流：限流响应最多重试的次数（没有 Retry-After 时从 backoff 开始指数退避），
+	// 以及每次被限流后 window 内同时发往 OSS 的请求上限
+	OSSThrottleRetries     int
+	OSSThrottleBackoff     time.Duration
+	OSSThrottleWindow      time.Duration
+	OSSThrottleConcurrency int
+
+	// 上传时指定 ttl 的对象：过期索引的前缀和后台清理间隔（为 0 时不清理）
+	ObjectTTLIndexPrefix   string
+	ObjectTTLSweepInterval time.Duration
+
+	// 派生对象（缩略图、转码结果）的命名规则（见 defaultDerivedKeyPatterns）和孤立派生对象的后台清理间隔（为 0 时不清理）
+	DerivedKeyPatterns   string
+	DerivedSweepInterval time.Duration
+
+	// 管理接口的访问令牌，未设置时管理接口不可用
+	AdminToken string
+	// 读取标记为 private 的对象时需要的 API key，可见性存放在用户元数据 VisibilityMetaKey 中
+	APIKey            string
+	VisibilityMetaKey string
+	// /admin/manifest 生成的清单存放的前缀
+	ManifestPrefix string
+	// POST /export 每个 tar 卷的目标大小和读取对象的速率上限（字节/秒，为 0 时不限制）
+	ExportVolumeSize int64
+	ExportBandwidth  int64
+	// 按前缀删除、清空回收站等破坏性操作的确认令牌有效期
+	ConfirmationTTL time.Duration
+
+	// 同时设置证书和私钥时直接提供 HTTPS（自动启用 HTTP/2），否则使用明文 HTTP
+	TLSCertFile string
+	TLSKeyFile  string
+	// 收到退出信号后等待进行中请求完成的最长时间
+	ShutdownTimeout time.Duration
+
+	// 每个配置项的最终取值和来源，供 /debug/config 展示
+	entries []configEntry
+}
+
+// configEntry 记录一个配置项的取值及其来源（环境变量或默认值）
+type configEntry struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	secret bool
+}
+
+// 返回所有配置项，密钥类的值只保留最后 4 个字符
+func (c *Config) redactedEntries() []configEntry {
+	out := make([]configEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		if entry.secret {
+			entry.Value = redactSecret(entry.Value)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func redactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 4 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// envLoader 读取环境变量并记录所有格式错误，最后一次性报告，而不是遇到第一个错误就退出
+type envLoader struct {
+	problems []string
+	entries  []configEntry
+}
+
+// 记录配置项的来源；没有设置环境变量或格式错误时使用的是默认值
+func (l *envLoader) record(name string, value any, fromEnv bool) {
+	source := "default"
+	if fromEnv {
+		source = "env"
+	}
+	l.entries = append(l.entries, configEntry{Name: name, Value: fmt.Sprint(value), Source: source})
+}
+
+func (l *envLoader) string(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		l.record(name, value, true)
+		return value
+	}
+	l.record(name, def, false)
+	return def
+}
+
+// 与 string 相同，但在 /debug/config 中会被脱敏
+func (l *envLoader) secret(name, def string) string {
+	value := l.string(name, def)
+	l.entries[len(l.entries)-1].secret = true
+	return value
+}
+
+func (l *envLoader) int64(name string, def int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		l.record(name, def, false)
+		return def
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		l.problems = append(l.problems, fmt.Sprintf("%s: %q is not an integer", name, value))
+		l.record(name, def, false)
+		return def
+	}
+	l.record(name, n, true)
+	return n
+}
+
+func (l *envLoader) int(name string, def int) int {
+	return int(l.int64(name, int64(def)))
+}
+
+func (l *envLoader) bool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		l.record(name, def, false)
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.problems = append(l.problems, fmt.Sprintf("%s: %q is not a boolean", name, value))
+		l.record(name, def, false)
+		return def
+	}
+	l.record(name, b, true)
+	return b
+}
+
+// 时长格式如 "2s"、"500ms"、"1h"
+func (l *envLoader) duration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		l.record(name, def, false)
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		l.problems = append(l.problems, fmt.Sprintf("%s: %q is not a duration", name, value))
+		l.record(name, def, false)
+		return def
+	}
+	l.record(name, d, true)
+	return d
+}
+
+// 从环境变量读取配置并校验，返回的错误包含所有问题
+func loadConfig() (*Config, error) {
+	l := &envLoader{}
+	cfg := &Config{
+		Endpoint:        l.string("OSS_ENDPOINT", ""),
+		AccessKeyID:     l.string("OSS_ACCESS_KEY_ID", ""),
+		AccessKeySecret: l.secret("OSS_ACCESS_KEY_SECRET", ""),
+		BucketName:      l.string("OSS_BUCKET_NAME", ""),
+
+		FailoverEndpoint:   l.string("OSS_FAILOVER_ENDPOINT", ""),
+		FailoverBucketName: l.string("OSS_FAILOVER_BUCKET_NAME", ""),
+		AllowedBuckets:     l.string("ALLOWED_BUCKETS", ""),
+
+		OSSUserAgent:           l.string("OSS_USER_AGENT", ""),
+		OSSConnectTimeout:      l.duration("OSS_CONNECT_TIMEOUT", 30*time.Second),
+		OSSReadWriteTimeout:    l.duration("OSS_READ_WRITE_TIMEOUT", 60*time.Second),
+		OSSMaxIdleConns:        l.int("OSS_MAX_IDLE_CONNS", 100),
+		OSSMaxIdleConnsPerHost: l.int("OSS_MAX_IDLE_CONNS_PER_HOST", 100),
+		OSSMaxConnsPerHost:     l.int("OSS_MAX_CONNS_PER_HOST", 0),
+		OSSIdleConnTimeout:     l.duration("OSS_IDLE_CONN_TIMEOUT", 60*time.Second),
+
+		MaxMultipartMemory:    l.int64("MAX_MULTIPART_MEMORY", 32<<20),
+		MaxUploadBodySize:     l.int64("MAX_UPLOAD_BODY_SIZE", 1<<30),
+		MaxFormParts:          l.int("MAX_FORM_PARTS", 16),
+		MaxFormFieldSize:      l.int64("MAX_FORM_FIELD_SIZE", 64<<10),
+		UploadIdleTimeout:     l.duration("UPLOAD_IDLE_TIMEOUT", 30*time.Second),
+		UploadReadTimeout:     l.duration("UPLOAD_READ_TIMEOUT", 0),
+		UploadForbidOverwrite: l.bool("UPLOAD_FORBID_OVERWRITE", false),
+		DefaultObjectACL:      l.string("DEFAULT_OBJECT_ACL", ""),
+		UploadValidateImages:  l.bool("UPLOAD_VALIDATE_IMAGES", false),
+
+		MaxKeyLength:        l.int("MAX_KEY_LENGTH", maxOSSKeyLength),
+		KeyLengthStrategy:   l.string("KEY_LENGTH_STRATEGY", KeyLengthReject),
+		KeyEncodingStrategy: l.string("KEY_ENCODING_STRATEGY", KeyEncodingOff),
+
+		CaseInsensitiveLookup:    l.bool("CASE_INSENSITIVE_LOOKUP", false),
+		CaseInsensitiveScanLimit: l.int("CASE_INSENSITIVE_SCAN_LIMIT", 1000),
+
+		IdempotencyWindow:     l.duration("IDEMPOTENCY_WINDOW", 24*time.Hour),
+		IdempotencyMaxEntries: l.int("IDEMPOTENCY_MAX_ENTRIES", 10000),
+
+		SoftDelete:  l.bool("SOFT_DELETE", false),
+		TrashPrefix: l.string("TRASH_PREFIX", "trash/"),
+
+		ArchivePrefix:       l.string("ARCHIVE_PREFIX", "archive/"),
+		ArchiveStorageClass: l.string("ARCHIVE_STORAGE_CLASS", "Archive"),
+		ArchiveMetadata:     l.string("ARCHIVE_METADATA", ""),
+
+		MultipartThreshold:       l.int64("MULTIPART_THRESHOLD", 100<<20),
+		MultipartMinPartSize:     l.int64("MULTIPART_MIN_PART_SIZE", 5<<20),
+		MultipartMaxPartSize:     l.int64("MULTIPART_MAX_PART_SIZE", 1<<30),
+		MultipartDefaultPartSize: l.int64("MULTIPART_DEFAULT_PART_SIZE", 5<<20),
+		MultipartUploadTTL:       l.duration("MULTIPART_UPLOAD_TTL", 24*time.Hour),
+		MultipartSweepInterval:   l.duration("MULTIPART_SWEEP_INTERVAL", 0),
+		MultipartSweepPrefix:     l.string("MULTIPART_SWEEP_PREFIX", ""),
+
+		FFmpegPath:            l.string("FFMPEG_PATH", "ffmpeg"),
+		FFprobePath:           l.string("FFPROBE_PATH", "ffprobe"),
+		FFmpegTimeout:         l.duration("FFMPEG_TIMEOUT", 30*time.Minute),
+		FFprobeTimeout:        l.duration("FFPROBE_TIMEOUT", 30*time.Second),
+		TranscodeMaxAttempts:  l.int("TRANSCODE_MAX_ATTEMPTS", 3),
+		TranscodeRetryBackoff: l.duration("TRANSCODE_RETRY_BACKOFF", 2*time.Second),
+		TranscodeWorkers:      l.int("TRANSCODE_WORKERS", runtime.NumCPU()),
+		TranscodeQueueSize:    l.int("TRANSCODE_QUEUE_SIZE", 100),
+		TranscodeRetryAfter:   l.duration("TRANSCODE_RETRY_AFTER", 30*time.Second),
+
+		ThumbnailMaxSourceSize: l.int64("THUMBNAIL_MAX_SOURCE_SIZE", 50<<20),
+		ThumbnailMaxPixels:     l.int64("THUMBNAIL_MAX_PIXELS", 50_000_000),
+
+		JobStore:     l.string("JOB_STORE", "memory"),
+		JobStorePath: l.string("JOB_STORE_PATH", "jobs.json"),
+		JobStoreKey:  l.string("JOB_STORE_KEY", ".jobs/jobs.json"),
+
+		JobRetention:   l.duration("JOB_RETENTION", 7*24*time.Hour),
+		JobMaxFinished: l.int("JOB_MAX_FINISHED", 1000),
+
+		CDNBaseURL:       l.string("CDN_BASE_URL", ""),
+		BucketPublic:     l.bool("OSS_BUCKET_PUBLIC", false),
+		PresignExpiry:    l.duration("PRESIGN_EXPIRY", time.Hour),
+		PresignMaxExpiry: l.duration("PRESIGN_MAX_EXPIRY", 7*24*time.Hour),
+
+		PostPolicyKeyPrefix: l.string("POST_POLICY_KEY_PREFIX", "uploads/"),
+		PostPolicyMaxSize:   l.int64("POST_POLICY_MAX_SIZE", 100<<20),
+		PostPolicyExpiry:    l.duration("POST_POLICY_EXPIRY", 15*time.Minute),
+
+		PresignDeleteExpiry:    l.duration("PRESIGN_DELETE_EXPIRY", 5*time.Minute),
+		PresignDeleteMaxExpiry: l.duration("PRESIGN_DELETE_MAX_EXPIRY", 15*time.Minute),
+
+		DownloadFilenameTemplate: l.string("DOWNLOAD_FILENAME_TEMPLATE", defaultFilenameTemplate),
+		RandomNameLength:         l.int("RANDOM_NAME_LENGTH", defaultRandomNameLength),
+		RandomNameCharset:        l.string("RANDOM_NAME_CHARSET", defaultRandomNameCharset),
+		IndexDocument:            l.string("INDEX_DOCUMENT", ""),
+		DownloadSessionTTL:       l.duration("DOWNLOAD_SESSION_TTL", 24*time.Hour),
+		ConcatMaxObjects:         l.int("CONCAT_MAX_OBJECTS", 100),
+
+		InlineMaxSize:   l.int64("INLINE_MAX_SIZE", 64<<10),
+		PreviewMaxBytes: l.int64("PREVIEW_MAX_BYTES", 64<<10),
+
+		InlineContentTypes:  l.string("INLINE_CONTENT_TYPES", defaultInlineContentTypes),
+		CharsetContentTypes: l.string("CHARSET_CONTENT_TYPES", defaultCharsetContentTypes),
+
+		DownloadGzip:        l.bool("DOWNLOAD_GZIP", false),
+		DownloadGzipMinSize: l.int64("DOWNLOAD_GZIP_MIN_SIZE", 1024),
+		DownloadGzipLevel:   l.int("DOWNLOAD_GZIP_LEVEL", 6),
+
+		DownloadCacheDir:     l.string("DOWNLOAD_CACHE_DIR", ""),
+		DownloadCacheMaxSize: l.int64("DOWNLOAD_CACHE_MAX_SIZE", 10<<30),
+
+		ListUseV2:                l.bool("LIST_USE_V2", false),
+		ListHideDirectoryMarkers: l.bool("LIST_HIDE_DIRECTORY_MARKERS", false),
+		ListCacheTTL:             l.duration("LIST_CACHE_TTL", 0),
+		ListCacheMaxEntries:      l.int("LIST_CACHE_MAX_ENTRIES", 1000),
+		ListConcurrency:          l.int("LIST_CONCURRENCY", 4),
+		TagScanConcurrency:       l.int("TAG_SCAN_CONCURRENCY", 8),
+		MetaBatchMaxKeys:         l.int("META_BATCH_MAX_KEYS", 100),
+		MetaBatchConcurrency:     l.int("META_BATCH_CONCURRENCY", 8),
+		SearchMaxObjectSize:      l.int64("SEARCH_MAX_OBJECT_SIZE", 1<<20),
+		SearchMaxTotalBytes:      l.int64("SEARCH_MAX_TOTAL_BYTES", 100<<20),
+		SearchConcurrency:        l.int("SEARCH_CONCURRENCY", 8),
+		UsageCacheTTL:            l.duration("USAGE_CACHE_TTL", 5*time.Minute),
+		TreeMaxDepth:             l.int("TREE_MAX_DEPTH", 5),
+		TreeMaxNodes:             l.int("TREE_MAX_NODES", 5000),
+		TreeMaxListCalls:         l.int("TREE_MAX_LIST_CALLS", 200),
+		TreeTimeout:              l.duration("TREE_TIMEOUT", 10*time.Second),
+		ListSoftDeadline:         l.duration("LIST_SOFT_DEADLINE", 0),
+		ListCursorTTL:            l.duration("LIST_CURSOR_TTL", 24*time.Hour),
+
+		WebhookURL:        l.string("WEBHOOK_URL", ""),
+		WebhookSecret:     l.secret("WEBHOOK_SECRET", ""),
+		WebhookEvents:     l.string("WEBHOOK_EVENTS", EventUpload+","+EventDelete),
+		WebhookTimeout:    l.duration("WEBHOOK_TIMEOUT", 5*time.Second),
+		WebhookMaxRetries: l.int("WEBHOOK_MAX_RETRIES", 3),
+
+		OutboundAllowHosts:   l.string("OUTBOUND_ALLOW_HOSTS", ""),
+		OutboundDenyHosts:    l.string("OUTBOUND_DENY_HOSTS", ""),
+		OutboundAllowCIDRs:   l.string("OUTBOUND_ALLOW_CIDRS", ""),
+		OutboundDenyCIDRs:    l.string("OUTBOUND_DENY_CIDRS", ""),
+		OutboundAllowPrivate: l.bool("OUTBOUND_ALLOW_PRIVATE", false),
+		ImportTimeout:        l.duration("IMPORT_TIMEOUT", 6*time.Hour),
+		ImportMaxConcurrency: l.int("IMPORT_MAX_CONCURRENCY", 4),
+
+		OSSMaxReadConcurrency:  l.int("OSS_MAX_READ_CONCURRENCY", 64),
+		OSSMaxWriteConcurrency: l.int("OSS_MAX_WRITE_CONCURRENCY", 16),
+		OSSAcquireTimeout:      l.duration("OSS_ACQUIRE_TIMEOUT", 200*time.Millisecond),
+		OSSRetryAfter:          l.duration("OSS_RETRY_AFTER", time.Second),
+		OSSBreakerThreshold:    l.int("OSS_BREAKER_THRESHOLD", 5),
+		OSSBreakerCooldown:     l.duration("OSS_BREAKER_COOLDOWN", 30*time.Second),
+		OSSThrottleRetries:     l.int("OSS_THROTTLE_RETRIES", 3),
+		OSSThrottleBackoff:     l.duration("OSS_THROTTLE_BACKOFF", 200*time.Millisecond),
+		OSSThrottleWindow:      l.duration("OSS_THROTTLE_WINDOW", 10*time.Second),
+		OSSThrottleConcurrency: l.int("OSS_THROTTLE_CONCURRENCY", 8),
+
+		ObjectTTLIndexPrefix:   l.string("OBJECT_TTL_INDEX_PREFIX", ".ttl/"),
+		ObjectTTLSweepInterval: l.duration("OBJECT_TTL_SWEEP_INTERVAL", time.Minute),
+
+		DerivedKeyPatterns:   l.string("DERIVED_KEY_PATTERNS", defaultDerivedKeyPatterns),
+		DerivedSweepInterval: l.duration("DERIVED_SWEEP_INTERVAL", 0),
+
+		AdminToken:        l.secret("ADMIN_TOKEN", ""),
+		APIKey:            l.secret("API_KEY", ""),
+		VisibilityMetaKey: l.string("VISIBILITY_META_KEY", "visibility"),
+		ManifestPrefix:    l.string("MANIFEST_PREFIX", "manifests/"),
+		ExportVolumeSize:  l.int64("EXPORT_VOLUME_SIZE", 1<<30),
+		ExportBandwidth:   l.int64("EXPORT_BANDWIDTH", 0),
+		ConfirmationTTL:   l.duration("CONFIRMATION_TTL", 2*time.Minute),
+
+		TLSCertFile:     l.string("TLS_CERT_FILE", ""),
+		TLSKeyFile:      l.string("TLS_KEY_FILE", ""),
+		ShutdownTimeout: l.duration("SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+	cfg.entries = l.entries
+	problems := append(l.problems, cfg.Validate()...)
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return cfg, nil
+}
+
+// Validate 检查必填项、数值范围和枚举值，返回发现的所有问题
+func (c *Config) Validate() []string {
+	var problems []string
+	required := func(name, value string) {
+		if value == "" {
+			problems = append(problems, name+" is required")
+		}
+	}
+	atLeast := func(name string, value, min int64) {
+		if value < min {
+			problems = append(problems, fmt.Sprintf("%s must be at least %d, got %d", name, min, value))
+		}
+	}
+	positive := func(name string, d time.Duration) {
+		if d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive, got %s", name, d))
+		}
+	}
+	nonNegative := func(name string, d time.Duration) {
+		if d < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, got %s", name, d))
+		}
+	}
+
+	required("OSS_ENDPOINT", c.Endpoint)
+	required("OSS_ACCESS_KEY_ID", c.AccessKeyID)
+	required("OSS_ACCESS_KEY_SECRET", c.AccessKeySecret)
+	required("OSS_BUCKET_NAME", c.BucketName)
+	if (c.FailoverEndpoint == "") != (c.FailoverBucketName == "") {
+		problems = append(problems, "OSS_FAILOVER_ENDPOINT and OSS_FAILOVER_BUCKET_NAME must be set together")
+	}
+
+	// SDK 的超时以秒为单位
+	wholeSeconds := func(name string, d time.Duration) {
+		if d < time.Second || d%time.Second != 0 {
+			problems = append(problems, fmt.Sprintf("%s must be a whole number of seconds of at least 1s, got %s", name, d))
+		}
+	}
+	wholeSeconds("OSS_CONNECT_TIMEOUT", c.OSSConnectTimeout)
+	wholeSeconds("OSS_READ_WRITE_TIMEOUT", c.OSSReadWriteTimeout)
+	atLeast("OSS_MAX_IDLE_CONNS", int64(c.OSSMaxIdleConns), 0)
+	atLeast("OSS_MAX_IDLE_CONNS_PER_HOST", int64(c.OSSMaxIdleConnsPerHost), 0)
+	atLeast("OSS_MAX_CONNS_PER_HOST", int64(c.OSSMaxConnsPerHost), 0)
+	nonNegative("OSS_IDLE_CONN_TIMEOUT", c.OSSIdleConnTimeout)
+
+	atLeast("MAX_MULTIPART_MEMORY", c.MaxMultipartMemory, 1)
+	atLeast("MAX_UPLOAD_BODY_SIZE", c.MaxUploadBodySize, 0)
+	atLeast("MAX_FORM_PARTS", int64(c.MaxFormParts), 0)
+	atLeast("MAX_FORM_FIELD_SIZE", c.MaxFormFieldSize, 0)
+	nonNegative("UPLOAD_IDLE_TIMEOUT", c.UploadIdleTimeout)
+	nonNegative("UPLOAD_READ_TIMEOUT", c.UploadReadTimeout)
+
+	if c.MaxKeyLength < 1 || c.MaxKeyLength > maxOSSKeyLength {
+		problems = append(problems, fmt.Sprintf("MAX_KEY_LENGTH must be between 1 and %d, got %d", maxOSSKeyLength, c.MaxKeyLength))
+	}
+	atLeast("CASE_INSENSITIVE_SCAN_LIMIT", int64(c.CaseInsensitiveScanLimit), 1)
+	if _, ok := objectACLs[c.DefaultObjectACL]; c.DefaultObjectACL != "" && !ok {
+		problems = append(problems, fmt.Sprintf("DEFAULT_OBJECT_ACL must be one of default, private, public-read, public-read-write, got %q", c.DefaultObjectACL))
+	}
+	switch c.KeyLengthStrategy {
+	case KeyLengthReject, KeyLengthTruncate:
+	default:
+		problems = append(problems, fmt.Sprintf("KEY_LENGTH_STRATEGY must be %q or %q, got %q", KeyLengthReject, KeyLengthTruncate, c.KeyLengthStrategy))
+	}
+	switch c.KeyEncodingStrategy {
+	case KeyEncodingOff, KeyEncodingNormalize, KeyEncodingReject:
+	default:
+		problems = append(problems, fmt.Sprintf("KEY_ENCODING_STRATEGY must be %q, %q or %q, got %q", KeyEncodingOff, KeyEncodingNormalize, KeyEncodingReject, c.KeyEncodingStrategy))
+	}
+
+	nonNegative("IDEMPOTENCY_WINDOW", c.IdempotencyWindow)
+	if c.IdempotencyWindow > 0 {
+		atLeast("IDEMPOTENCY_MAX_ENTRIES", int64(c.IdempotencyMaxEntries), 1)
+	}
+	if !strings.HasSuffix(c.TrashPrefix, "/") {
+		problems = append(problems, fmt.Sprintf("TRASH_PREFIX must end with \"/\", got %q", c.TrashPrefix))
+	}
+	if _, ok := storageClasses[c.ArchiveStorageClass]; !ok {
+		problems = append(problems, fmt.Sprintf("ARCHIVE_STORAGE_CLASS must be one of Standard, IA, Archive, ColdArchive, DeepColdArchive, got %q", c.ArchiveStorageClass))
+	}
+	if _, err := parseMetadataOverlay(c.ArchiveMetadata); err != nil {
+		problems = append(problems, fmt.Sprintf("ARCHIVE_METADATA: %v", err))
+	}
+
+	// OSS 要求除最后一个分片外每个分片至少 100KB，最大 5GB
+	atLeast("MULTIPART_THRESHOLD", c.MultipartThreshold, 1)
+	atLeast("MULTIPART_MIN_PART_SIZE", c.MultipartMinPartSize, 100<<10)
+	if c.MultipartMaxPartSize > 5<<30 {
+		problems = append(problems, fmt.Sprintf("MULTIPART_MAX_PART_SIZE must not exceed %d, got %d", int64(5<<30), c.MultipartMaxPartSize))
+	}
+	if c.MultipartMinPartSize > c.MultipartMaxPartSize {
+		problems = append(problems, "MULTIPART_MIN_PART_SIZE must not exceed MULTIPART_MAX_PART_SIZE")
+	}
+	if c.MultipartDefaultPartSize < c.MultipartMinPartSize || c.MultipartDefaultPartSize > c.MultipartMaxPartSize {
+		problems = append(problems, "MULTIPART_DEFAULT_PART_SIZE must be between MULTIPART_MIN_PART_SIZE and MULTIPART_MAX_PART_SIZE")
+	}
+	positive("MULTIPART_UPLOAD_TTL", c.MultipartUploadTTL)
+	nonNegative("MULTIPART_SWEEP_INTERVAL", c.MultipartSweepInterval)
+
+	positive("FFMPEG_TIMEOUT", c.FFmpegTimeout)
+	positive("FFPROBE_TIMEOUT", c.FFprobeTimeout)
+	atLeast("TRANSCODE_MAX_ATTEMPTS", int64(c.TranscodeMaxAttempts), 1)
+	positive("TRANSCODE_RETRY_BACKOFF", c.TranscodeRetryBackoff)
+	atLeast("TRANSCODE_WORKERS", int64(c.TranscodeWorkers), 1)
+	atLeast("TRANSCODE_QUEUE_SIZE", int64(c.TranscodeQueueSize), 0)
+	positive("TRANSCODE_RETRY_AFTER", c.TranscodeRetryAfter)
+	atLeast("THUMBNAIL_MAX_SOURCE_SIZE", c.ThumbnailMaxSourceSize, 1)
+	atLeast("THUMBNAIL_MAX_PIXELS", c.ThumbnailMaxPixels, 1)
+
+	switch c.JobStore {
+	case "memory", "file", "oss":
+	default:
+		problems = append(problems, fmt.Sprintf("JOB_STORE must be one of memory, file, oss, got %q", c.JobStore))
+	}
+	if c.JobStore == "file" {
+		required("JOB_STORE_PATH", c.JobStorePath)
+	}
+	if c.JobStore == "oss" {
+		required("JOB_STORE_KEY", c.JobStoreKey)
+	}
+	nonNegative("JOB_RETENTION", c.JobRetention)
+	atLeast("JOB_MAX_FINISHED", int64(c.JobMaxFinished), 0)
+
+	if c.CDNBaseURL != "" && !strings.HasPrefix(c.CDNBaseURL, "http://") && !strings.HasPrefix(c.CDNBaseURL, "https://") {
+		problems = append(problems, fmt.Sprintf("CDN_BASE_URL must start with http:// or https://, got %q", c.CDNBaseURL))
+	}
+	positive("PRESIGN_EXPIRY", c.PresignExpiry)
+	positive("PRESIGN_MAX_EXPIRY", c.PresignMaxExpiry)
+	if c.PresignExpiry > c.PresignMaxExpiry {
+		problems = append(problems, "PRESIGN_EXPIRY must not exceed PRESIGN_MAX_EXPIRY")
+	}
+	atLeast("POST_POLICY_MAX_SIZE", c.PostPolicyMaxSize, 1)
+	positive("POST_POLICY_EXPIRY", c.PostPolicyExpiry)
+	if c.PostPolicyExpiry > c.PresignMaxExpiry {
+		problems = append(problems, "POST_POLICY_EXPIRY must not exceed PRESIGN_MAX_EXPIRY")
+	}
+	positive("PRESIGN_DELETE_EXPIRY", c.PresignDeleteExpiry)
+	positive("PRESIGN_DELETE_MAX_EXPIRY", c.PresignDeleteMaxExpiry)
+	if c.PresignDeleteExpiry > c.PresignDeleteMaxExpiry {
+		problems = append(problems, "PRESIGN_DELETE_EXPIRY must not exceed PRESIGN_DELETE_MAX_EXPIRY")
+	}
+
+	if err := validateFilenameTemplate(c.DownloadFilenameTemplate); err != nil {
+		problems = append(problems, "DOWNLOAD_FILENAME_TEMPLATE: "+err.Error())
+	}
+	if c.RandomNameLength < 1 || c.RandomNameLength > 64 {
+		problems = append(problems, fmt.Sprintf("RANDOM_NAME_LENGTH must be between 1 and 64, got %d", c.RandomNameLength))
+	}
+	if _, err := parseRandomCharset(c.RandomNameCharset); err != nil {
+		problems = append(problems, "RANDOM_NAME_CHARSET: "+err.Error())
+	}
+	atLeast("CONCAT_MAX_OBJECTS", int64(c.ConcatMaxObjects), 1)
+	atLeast("INLINE_MAX_SIZE", c.InlineMaxSize, 1)
+	atLeast("PREVIEW_MAX_BYTES", c.PreviewMaxBytes, 1)
+	atLeast("DOWNLOAD_GZIP_MIN_SIZE", c.DownloadGzipMinSize, 0)
+	if c.DownloadGzipLevel < 1 || c.DownloadGzipLevel > 9 {
+		problems = append(problems, fmt.Sprintf("DOWNLOAD_GZIP_LEVEL must be between 1 and 9, got %d", c.DownloadGzipLevel))
+	}
+	for _, t := range parseInlineTypes(c.InlineContentTypes) {
+		if _, _, err := mime.ParseMediaType(t); err != nil || !strings.Contains(t, "/") {
+			problems = append(problems, fmt.Sprintf("INLINE_CONTENT_TYPES contains invalid type %q", t))
+		}
+	}
+	for _, t := range parseInlineTypes(c.CharsetContentTypes) {
+		if _, _, err := mime.ParseMediaType(t); err != nil || !strings.Contains(t, "/") {
+			problems = append(problems, fmt.Sprintf("CHARSET_CONTENT_TYPES contains invalid type %q", t))
+		}
+	}
+
+	if c.DownloadCacheDir != "" {
+		atLeast("DOWNLOAD_CACHE_MAX_SIZE", c.DownloadCacheMaxSize, 1)
+	}
+
+	nonNegative("LIST_CACHE_TTL", c.ListCacheTTL)
+	atLeast("LIST_CONCURRENCY", int64(c.ListConcurrency), 1)
+	atLeast("TAG_SCAN_CONCURRENCY", int64(c.TagScanConcurrency), 1)
+	atLeast("META_BATCH_MAX_KEYS", int64(c.MetaBatchMaxKeys), 1)
+	atLeast("META_BATCH_CONCURRENCY", int64(c.MetaBatchConcurrency), 1)
+	nonNegative("USAGE_CACHE_TTL", c.UsageCacheTTL)
+	atLeast("SEARCH_MAX_OBJECT_SIZE", c.SearchMaxObjectSize, 1)
+	atLeast("SEARCH_MAX_TOTAL_BYTES", c.SearchMaxTotalBytes, 1)
+	atLeast("SEARCH_CONCURRENCY", int64(c.SearchConcurrency), 1)
+	atLeast("TREE_MAX_DEPTH", int64(c.TreeMaxDepth), 1)
+	atLeast("TREE_MAX_NODES", int64(c.TreeMaxNodes), 1)
+	atLeast("TREE_MAX_LIST_CALLS", int64(c.TreeMaxListCalls), 1)
+	nonNegative("TREE_TIMEOUT", c.TreeTimeout)
+	nonNegative("LIST_SOFT_DEADLINE", c.ListSoftDeadline)
+	nonNegative("LIST_CURSOR_TTL", c.ListCursorTTL)
+	if c.ListCacheTTL > 0 {
+		atLeast("LIST_CACHE_MAX_ENTRIES", int64(c.ListCacheMaxEntries), 1)
+	}
+
+	if c.WebhookURL != "" {
+		if !strings.HasPrefix(c.WebhookURL, "http://") && !strings.HasPrefix(c.WebhookURL, "https://") {
+			problems = append(problems, fmt.Sprintf("WEBHOOK_URL must start with http:// or https://, got %q", c.WebhookURL))
+		}
+		for _, name := range strings.Split(c.WebhookEvents, ",") {
+			switch strings.TrimSpace(name) {
+			case EventUpload, EventDelete, "":
+			default:
+				problems = append(problems, fmt.Sprintf("WEBHOOK_EVENTS contains unknown event %q", name))
+			}
+		}
+	}
+	positive("WEBHOOK_TIMEOUT", c.WebhookTimeout)
+	atLeast("WEBHOOK_MAX_RETRIES", int64(c.WebhookMaxRetries), 0)
+
+	positive("IMPORT_TIMEOUT", c.ImportTimeout)
+	atLeast("IMPORT_MAX_CONCURRENCY", int64(c.ImportMaxConcurrency), 1)
+	if _, err := parseCIDRList(c.OutboundAllowCIDRs); err != nil {
+		problems = append(problems, "OUTBOUND_ALLOW_CIDRS: "+err.Error())
+	}
+	if _, err := parseCIDRList(c.OutboundDenyCIDRs); err != nil {
+		problems = append(problems, "OUTBOUND_DENY_CIDRS: "+err.Error())
+	}
+
+	atLeast("OSS_MAX_READ_CONCURRENCY", int64(c.OSSMaxReadConcurrency), 0)
+	atLeast("OSS_MAX_WRITE_CONCURRENCY", int64(c.OSSMaxWriteConcurrency), 0)
+	nonNegative("OSS_ACQUIRE_TIMEOUT", c.OSSAcquireTimeout)
+	positive("OSS_RETRY_AFTER", c.OSSRetryAfter)
+	atLeast("OSS_BREAKER_THRESHOLD", int64(c.OSSBreakerThreshold), 0)
+	positive("OSS_BREAKER_COOLDOWN", c.OSSBreakerCooldown)
+	atLeast("OSS_THROTTLE_RETRIES", int64(c.OSSThrottleRetries), 0)
+	positive("OSS_THROTTLE_BACKOFF", c.OSSThrottleBackoff)
+	nonNegative("OSS_THROTTLE_WINDOW", c.OSSThrottleWindow)
+	atLeast("OSS_THROTTLE_CONCURRENCY", int64(c.OSSThrottleConcurrency), 1)
+
+	if !strings.HasSuffix(c.ObjectTTLIndexPrefix, "/") {
+		problems = append(problems, fmt.Sprintf("OBJECT_TTL_INDEX_PREFIX must end with \"/\", got %q", c.ObjectTTLIndexPrefix))
+	}
+	nonNegative("OBJECT_TTL_SWEEP_INTERVAL", c.ObjectTTLSweepInterval)
+	if _, err := parseDerivedPatterns(c.DerivedKeyPatterns); err != nil {
+		problems = append(problems, fmt.Sprintf("DERIVED_KEY_PATTERNS: %v", err))
+	}
+	nonNegative("DERIVED_SWEEP_INTERVAL", c.DerivedSweepInterval)
+
+	atLeast("EXPORT_VOLUME_SIZE", c.ExportVolumeSize, 1)
+	atLeast("EXPORT_BANDWIDTH", c.ExportBandwidth, 0)
+	if !strings.HasSuffix(c.ManifestPrefix, "/") {
+		problems = append(problems, fmt.Sprintf("MANIFEST_PREFIX must end with \"/\", got %q", c.ManifestPrefix))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problems = append(problems, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	readable := func(name, file string) {
+		if _, err := os.Stat(file); file != "" && err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	readable("TLS_CERT_FILE", c.TLSCertFile)
+	readable("TLS_KEY_FILE", c.TLSKeyFile)
+	positive("CONFIRMATION_TTL", c.ConfirmationTTL)
+	positive("DOWNLOAD_SESSION_TTL", c.DownloadSessionTTL)
+	positive("SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+	return problems
+}
+
+// 根据配置生成创建 OSS 客户端时使用的选项
+// 所有处理函数共用同一个 bucket 句柄和底层连接池，MaxIdleConnsPerHost 应不小于并发请求数，否则高并发时连接用完即关，
+// 不断新建连接会耗尽本地临时端口
+func (c *Config) clientOptions() []oss.ClientOption {
+	idleTimeout := c.OSSIdleConnTimeout
+	options := []oss.ClientOption{
+		oss.Timeout(int64(c.OSSConnectTimeout/time.Second), int64(c.OSSReadWriteTimeout/time.Second)),
+		oss.MaxConns(c.OSSMaxIdleConns, c.OSSMaxIdleConnsPerHost, c.OSSMaxConnsPerHost),
+		// oss.Timeout 会把空闲超时设成读写超时，SDK 没有单独的选项，这里在其后覆盖
+		func(client *oss.Client) { client.Config.HTTPTimeout.IdleConnTimeout = idleTimeout },
+	}
+	if c.OSSUserAgent != "" {
+		options = append(options, oss.UserAgent(c.OSSUserAgent))
+	}
+	return options
+}
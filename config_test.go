@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 设置必填的环境变量，其余使用默认值
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("OSS_ENDPOINT", "oss-cn-hangzhou.aliyuncs.com")
+	t.Setenv("OSS_ACCESS_KEY_ID", "test-access-key")
+	t.Setenv("OSS_ACCESS_KEY_SECRET", "test-secret")
+	t.Setenv("OSS_BUCKET_NAME", "test")
+}
+
+func TestLoadConfigRandomName(t *testing.T) {
+	tests := []struct {
+		name, length, charset string
+		wantErr               string
+	}{
+		{"defaults", "", "", ""},
+		{"custom", "32", "0123456789abcdef", ""},
+		{"duplicates are allowed", "8", "aabbcc", ""},
+		{"zero length", "0", "", "RANDOM_NAME_LENGTH"},
+		{"too long", "65", "", "RANDOM_NAME_LENGTH"},
+		{"not a number", "ten", "", "RANDOM_NAME_LENGTH"},
+		{"path separator", "", "ab/c", "RANDOM_NAME_CHARSET"},
+		{"control character", "", "ab\tc", "RANDOM_NAME_CHARSET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			if tt.length != "" {
+				t.Setenv("RANDOM_NAME_LENGTH", tt.length)
+			}
+			if tt.charset != "" {
+				t.Setenv("RANDOM_NAME_CHARSET", tt.charset)
+			}
+			cfg, err := loadConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("loadConfig: %v", err)
+				}
+				if tt.length == "" && (cfg.RandomNameLength != defaultRandomNameLength || cfg.RandomNameCharset != defaultRandomNameCharset) {
+					t.Errorf("defaults changed: length %d, charset %q", cfg.RandomNameLength, cfg.RandomNameCharset)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadConfig error = %v, want a problem with %s", err, tt.wantErr)
+			}
+		})
+	}
+}
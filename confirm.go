@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// 破坏性操作的二次确认：第一次请求只统计影响范围并签发确认令牌，调用方带上令牌重复请求才会真正执行
+// 令牌绑定操作类型和作用范围（例如前缀），只能使用一次，ttl 后过期
+type confirmationStore struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]pendingConfirmation
+}
+
+type pendingConfirmation struct {
+	operation string
+	scope     string
+	expires   time.Time
+}
+
+func newConfirmationStore(ttl time.Duration) *confirmationStore {
+	return &confirmationStore{ttl: ttl, tokens: make(map[string]pendingConfirmation)}
+}
+
+// 为 operation/scope 签发一个新令牌，同时清理已过期的令牌
+func (s *confirmationStore) issue(operation, scope string) (string, time.Time) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	now := time.Now()
+	expires := now.Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t, p := range s.tokens {
+		if now.After(p.expires) {
+			delete(s.tokens, t)
+		}
+	}
+	s.tokens[token] = pendingConfirmation{operation: operation, scope: scope, expires: expires}
+	return token, expires
+}
+
+// 校验并作废令牌；令牌不存在、已过期或与 operation/scope 不符时返回 false
+// 不符的令牌同样作废，防止拿一个令牌反复试探其他范围
+func (s *confirmationStore) consume(token, operation, scope string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.tokens[token]
+	if !ok {
+		return false
+	}
+	delete(s.tokens, token)
+	return p.operation == operation && p.scope == scope && time.Now().Before(p.expires)
+}
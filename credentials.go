@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// rotatingCredentials 作为所有 OSS 客户端的 CredentialsProvider，运行时可以替换访问密钥
+// 每次请求签名时读取当前的密钥，替换后新发起的请求立即使用新密钥，不需要重建客户端和 Bucket 对象
+type rotatingCredentials struct {
+	rotating sync.Mutex // 串行化替换，验证和替换之间不会插入另一次替换
+
+	mu     sync.RWMutex
+	id     string
+	secret string
+}
+
+func newRotatingCredentials(id, secret string) *rotatingCredentials {
+	return &rotatingCredentials{id: id, secret: secret}
+}
+
+// GetCredentials 返回当前密钥的快照，同一次签名内读到的 ID 和 Secret 总是配对的
+func (rc *rotatingCredentials) GetCredentials() oss.Credentials {
+	id, secret := rc.get()
+	return staticCredentials{id: id, secret: secret}
+}
+
+func (rc *rotatingCredentials) get() (string, string) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.id, rc.secret
+}
+
+func (rc *rotatingCredentials) set(id, secret string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.id, rc.secret = id, secret
+}
+
+// credentialTarget 替换密钥前需要验证能访问的存储桶
+type credentialTarget struct {
+	endpoint   string
+	bucketName string
+}
+
+// 先用新密钥逐个验证 targets 中的存储桶，全部通过后才替换
+// 任何一个验证失败时保持原来的密钥不变
+func (rc *rotatingCredentials) rotate(id, secret string, targets []credentialTarget, options ...oss.ClientOption) error {
+	rc.rotating.Lock()
+	defer rc.rotating.Unlock()
+	for _, target := range targets {
+		client, err := oss.New(target.endpoint, id, secret, options...)
+		if err != nil {
+			return fmt.Errorf("failed to create OSS client for %s: %v", target.endpoint, err)
+		}
+		if _, err := client.GetBucketInfo(target.bucketName); err != nil {
+			return fmt.Errorf("new credentials cannot access bucket '%s' at %s: %v", target.bucketName, target.endpoint, err)
+		}
+	}
+	rc.set(id, secret)
+	return nil
+}
+
+type staticCredentials struct {
+	id     string
+	secret string
+}
+
+func (s staticCredentials) GetAccessKeyID() string     { return s.id }
+func (s staticCredentials) GetAccessKeySecret() string { return s.secret }
+func (s staticCredentials) GetSecurityToken() string   { return "" }
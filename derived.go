@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 派生对象（缩略图、转码结果）的命名规则，与 thumbnailKey、transcodeOutputKey 对应，清理时只用来筛选候选对象，
+// 是否真的是派生对象以 derived-from 标记为准；每条规则的第一个捕获组是源对象去掉扩展名后的名字，多条规则用 ";" 分隔
+const defaultDerivedKeyPatterns = `^(.+)_\d+x\d+\.(?:jpg|png)$;^(.+)_transcoded\.[A-Za-z0-9]+$;^(.+)_preview_[\d.]+s_[\d.]+s\.[A-Za-z0-9]+$`
+
+func parseDerivedPatterns(value string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, expr := range strings.Split(value, ";") {
+		if expr = strings.TrimSpace(expr); expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", expr, err)
+		}
+		if re.NumSubexp() < 1 {
+			return nil, fmt.Errorf("pattern %q must capture the source name in a group", expr)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// 按命名规则解析出源对象（去掉扩展名）的名字，不是派生对象时返回 false
+func derivedSource(key string, patterns []*regexp.Regexp) (string, bool) {
+	for _, re := range patterns {
+		if m := re.FindStringSubmatch(key); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// 写入派生对象时记录源对象名（PathEscape 后）的元数据，清理时只处理带有这个标记的对象
+const derivedFromMetaKey = "derived-from"
+
+// 写入派生对象时附加的标记
+func derivedFromOption(source string) oss.Option {
+	return oss.Meta(derivedFromMetaKey, url.PathEscape(source))
+}
+
+// derivedSweepResult 一次清理的统计，keys 最多列出 100 个孤立对象
+// unmarked 为名字符合派生规则、但没有 derived-from 标记的对象数，这些对象可能是用户自己的文件，不会被清理
+type derivedSweepResult struct {
+	Scanned  int      `json:"scanned"`
+	Unmarked int      `json:"unmarked"`
+	Orphaned int      `json:"orphaned"`
+	Deleted  int      `json:"deleted"`
+	Keys     []string `json:"keys"`
+}
+
+// 清理源对象已不存在的派生对象：列举 prefix 下的全部对象（跳过 skip 中的前缀），名字符合派生规则的对象
+// 再读取元数据，只有带 derived-from 标记的才是本服务写入的派生对象；标记中的源对象 HEAD 返回不存在时视为孤立
+// 源对象不必在 prefix 下。trashPrefix 不为空时（开启了软删除）孤立对象移到回收站，否则直接删除
+// dryRun 时只统计不删除；deleted 在每个对象删除后调用，trashed 为回收站中的对象名（直接删除时为空）
+func sweepDerivedObjects(bucket *oss.Bucket, patterns []*regexp.Regexp, prefix string, skip []string, dryRun bool, trashPrefix string, deleted func(key, trashed string)) (derivedSweepResult, error) {
+	var result derivedSweepResult
+	var orphans []string
+	marker := ""
+	for {
+		res, err := bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000))
+		if err != nil {
+			return result, fmt.Errorf("failed to list objects: %v", err)
+		}
+		for _, object := range res.Objects {
+			if hasAnyPrefix(object.Key, skip) {
+				continue
+			}
+			result.Scanned++
+			if _, ok := derivedSource(object.Key, patterns); !ok {
+				continue
+			}
+			orphaned, marked, err := derivedOrphaned(bucket, object.Key)
+			if err != nil {
+				return result, err
+			}
+			if !marked {
+				result.Unmarked++
+			} else if orphaned {
+				orphans = append(orphans, object.Key)
+			}
+		}
+		if !res.IsTruncated {
+			break
+		}
+		marker = res.NextMarker
+	}
+
+	sort.Strings(orphans)
+	result.Orphaned = len(orphans)
+	for i, key := range orphans {
+		if i < 100 {
+			result.Keys = append(result.Keys, key)
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+	if trashPrefix != "" {
+		for _, key := range orphans {
+			trashed, err := moveToTrash(bucket, key, trashPrefix)
+			if isNoSuchKey(err) {
+				continue
+			}
+			if err != nil {
+				return result, fmt.Errorf("failed to move %s to trash: %v", key, err)
+			}
+			result.Deleted++
+			deleted(key, trashed)
+		}
+		return result, nil
+	}
+	for start := 0; start < len(orphans); start += 1000 {
+		batch := orphans[start:min(start+1000, len(orphans))]
+		res, err := bucket.DeleteObjects(batch)
+		if err != nil {
+			return result, fmt.Errorf("failed to delete objects: %v", err)
+		}
+		for _, key := range res.DeletedObjects {
+			result.Deleted++
+			deleted(key, "")
+		}
+	}
+	return result, nil
+}
+
+// 读取派生对象的 derived-from 标记并检查源对象是否还存在；对象在列举后被删除时视为未标记
+func derivedOrphaned(bucket *oss.Bucket, key string) (orphaned, marked bool, err error) {
+	meta, err := bucket.GetObjectDetailedMeta(key)
+	if isNoSuchKey(err) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to get metadata of %s: %v", key, err)
+	}
+	source, err := url.PathUnescape(meta.Get(oss.HTTPHeaderOssMetaPrefix + derivedFromMetaKey))
+	if err != nil || source == "" {
+		return false, false, nil
+	}
+	exists, err := bucket.IsObjectExist(source)
+	if err != nil {
+		return false, true, fmt.Errorf("failed to check source %s of %s: %v", source, key, err)
+	}
+	return !exists, true, nil
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if p != "" && strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// 定期清理孤立的派生对象，interval 为 0 时不启动
+func startDerivedSweeper(ctx context.Context, bucket *oss.Bucket, patterns []*regexp.Regexp, skip []string, interval time.Duration, trashPrefix string, deleted func(key, trashed string)) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			result, err := sweepDerivedObjects(bucket, patterns, "", skip, false, trashPrefix, deleted)
+			if err != nil {
+				log.Printf("Failed to sweep orphaned derived objects: %v", err)
+			}
+			if result.Deleted > 0 {
+				log.Printf("Deleted %d orphaned derived object(s)", result.Deleted)
+			}
+		}
+	}()
+}
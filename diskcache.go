@@ -0,0 +1,164 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// downloadCache 把下载过的对象缓存在本地磁盘，按总大小做 LRU 淘汰
+// 缓存条目记录对象的 ETag，ETag 变化说明对象已被覆盖，此时丢弃旧文件重新从 OSS 获取
+// 索引只保存在内存中，启动时会清理上次运行留下的缓存文件
+type downloadCache struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // 队头是最近使用的条目
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	etag string
+	path string
+	size int64
+}
+
+// 未配置缓存目录时返回 nil，nil 的缓存所有查询都视为未命中
+func newDownloadCache(dir string, maxSize int64) (*downloadCache, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	// 只清理缓存自己生成的文件（64 位十六进制文件名或 fill- 临时文件），不误删目录中的其他内容
+	names, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range names {
+		name := entry.Name()
+		if _, hexErr := hex.DecodeString(name); (hexErr == nil && len(name) == 64) || strings.HasPrefix(name, "fill-") {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+	return &downloadCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}, nil
+}
+
+// 返回与 etag 一致的缓存文件，文件已打开供读取；ETag 不一致时淘汰旧条目并返回未命中
+func (dc *downloadCache) open(key, etag string) (*os.File, bool) {
+	if dc == nil {
+		return nil, false
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	elem, ok := dc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.etag != etag {
+		dc.removeLocked(elem)
+		return nil, false
+	}
+	f, err := os.Open(entry.path)
+	if err != nil {
+		dc.removeLocked(elem)
+		return nil, false
+	}
+	dc.lru.MoveToFront(elem)
+	return f, true
+}
+
+// 把对象内容写入缓存，成功后返回已打开的缓存文件
+// 先写临时文件再重命名，读取失败时不会留下不完整的缓存
+func (dc *downloadCache) fill(key, etag string, body io.Reader) (*os.File, error) {
+	sum := sha256.Sum256([]byte(key))
+	path := filepath.Join(dc.dir, hex.EncodeToString(sum[:]))
+	tmp, err := os.CreateTemp(dc.dir, "fill-*")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to fill cache: %v", err)
+	}
+	if size > dc.maxSize {
+		// 比整个缓存还大的对象不缓存，直接从临时文件返回，关闭后删除
+		f, err := os.Open(tmp.Name())
+		os.Remove(tmp.Name())
+		return f, err
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if elem, ok := dc.entries[key]; ok {
+		dc.removeLocked(elem)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	dc.entries[key] = dc.lru.PushFront(&cacheEntry{key: key, etag: etag, path: path, size: size})
+	dc.size += size
+	for dc.size > dc.maxSize {
+		dc.removeLocked(dc.lru.Back())
+	}
+	return os.Open(path)
+}
+
+// 调用方需持有锁；已打开的文件在 Linux 上删除后仍可继续读取
+func (dc *downloadCache) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	dc.lru.Remove(elem)
+	delete(dc.entries, entry.key)
+	dc.size -= entry.size
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove cache file %s: %v", entry.path, err)
+	}
+}
+
+// 丢弃 key 的缓存条目，对象被覆盖或删除后调用，不必等到下次下载时才发现 ETag 变化
+func (dc *downloadCache) purge(key string) {
+	if dc == nil {
+		return
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if elem, ok := dc.entries[key]; ok {
+		dc.removeLocked(elem)
+	}
+}
+
+// 丢弃 prefix 下所有对象的缓存条目
+func (dc *downloadCache) purgePrefix(prefix string) {
+	if dc == nil {
+		return
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	for key, elem := range dc.entries {
+		if strings.HasPrefix(key, prefix) {
+			dc.removeLocked(elem)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// 默认允许浏览器内联展示的类型；SVG 可以携带脚本，不在默认列表中
+const defaultInlineContentTypes = "image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain"
+
+// inlineTypes MIME 类型列表，支持 "image/*" 这样的通配；用于允许内联展示的类型和需要补充字符集的类型
+type inlineTypes []string
+
+func parseInlineTypes(value string) inlineTypes {
+	var types inlineTypes
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// 根据对象存储的 Content-Type 决定 inline 还是 attachment；无法识别的类型一律作为附件下载
+func (types inlineTypes) disposition(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !types.contains(mediaType) {
+		return "attachment"
+	}
+	return "inline"
+}
+
+func (types inlineTypes) contains(mediaType string) bool {
+	for _, t := range types {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// 生成 Content-Disposition 头，所有设置该头的地方都应使用它而不是直接拼接文件名：
+// 文件名可能来自对象名，去掉控制字符（CR/LF 会导致头部注入）后，filename 参数只保留 ASCII 并转义引号和反斜杠，
+// 包含非 ASCII 字符时再按 RFC 6266（RFC 5987 编码）附加 filename*，浏览器优先使用后者
+func contentDisposition(dispositionType, filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+	fallback := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return '_'
+		}
+		return r
+	}, filename)
+	value := dispositionType + `; filename="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(fallback) + `"`
+	if fallback != filename {
+		// PathEscape 不转义 ":"、"="、"@"，它们不属于 RFC 5987 的 attr-char
+		encoded := strings.NewReplacer(":", "%3A", "=", "%3D", "@", "%40").Replace(url.PathEscape(filename))
+		value += "; filename*=UTF-8''" + encoded
+	}
+	return value
+}
+
+// 默认补充 charset=utf-8 的文本类类型
+const defaultCharsetContentTypes = "text/*,application/json,application/javascript,application/xml,image/svg+xml"
+
+// 上传时没有声明类型的对象在 OSS 中的 Content-Type 为空或 application/octet-stream，不能说明对象的真实类型
+func isGenericContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err != nil || mediaType == "application/octet-stream"
+}
+
+// 下载时返回的 Content-Type：优先使用对象保存的类型，缺失或为通用类型时才按扩展名猜测
+func downloadContentType(meta http.Header, ext string) string {
+	if stored := meta.Get("Content-Type"); !isGenericContentType(stored) {
+		return stored
+	}
+	if guessed := mime.TypeByExtension(ext); guessed != "" {
+		return guessed
+	}
+	return "application/octet-stream"
+}
+
+// 给下载的 Content-Type 补上字符集，避免浏览器按其他编码显示 UTF-8 文本：
+// 已带 charset 时不变；否则优先使用元数据 x-oss-meta-charset，其次是存储的 Content-Type 中的 charset，
+// 都没有且类型在 charsetTypes 中时使用 utf-8
+func withCharset(contentType string, meta http.Header, charsetTypes inlineTypes) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["charset"] != "" {
+		return contentType
+	}
+	charset := meta.Get("X-Oss-Meta-Charset")
+	if charset == "" {
+		if _, stored, err := mime.ParseMediaType(meta.Get("Content-Type")); err == nil {
+			charset = stored["charset"]
+		}
+	}
+	if charset == "" && charsetTypes.contains(mediaType) {
+		charset = "utf-8"
+	}
+	if charset == "" {
+		return contentType
+	}
+	params["charset"] = charset
+	return mime.FormatMediaType(mediaType, params)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name, filename, want string
+	}{
+		{"plain", "report.pdf", `attachment; filename="report.pdf"`},
+		{"CR/LF removed", "a\r\nb.txt", `attachment; filename="ab.txt"`},
+		{"other control characters removed", "a\x00\tb.txt", `attachment; filename="ab.txt"`},
+		{"header injection", "\"\r\nSet-Cookie: x=1", `attachment; filename="\"Set-Cookie: x=1"`},
+		{"quote escaped", `a"b.txt`, `attachment; filename="a\"b.txt"`},
+		{"backslash escaped", `a\b.txt`, `attachment; filename="a\\b.txt"`},
+		{"non-ASCII", "报告.pdf", `attachment; filename="__.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.pdf`},
+		{"filename* escapes non attr-char", "é 1=2@x:y.txt", `attachment; filename="_ 1=2@x:y.txt"; filename*=UTF-8''%C3%A9%201%3D2%40x%3Ay.txt`},
+		{"filename* escapes quote", `é".txt`, `attachment; filename="_\".txt"; filename*=UTF-8''%C3%A9%22.txt`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := contentDisposition("attachment", tt.filename)
+			if got != tt.want {
+				t.Errorf("contentDisposition(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+			if strings.ContainsAny(got, "\r\n") {
+				t.Errorf("contentDisposition(%q) contains CR or LF", tt.filename)
+			}
+		})
+	}
+}
+
+func TestContentDispositionInline(t *testing.T) {
+	if got, want := contentDisposition("inline", "a.png"), `inline; filename="a.png"`; got != want {
+		t.Errorf("contentDisposition = %q, want %q", got, want)
+	}
+}
+
+func TestDownloadContentType(t *testing.T) {
+	tests := []struct {
+		name, stored, ext, want string
+	}{
+		{"stored type wins", "text/markdown", ".txt", "text/markdown"},
+		{"stored type keeps parameters", "text/plain; charset=gbk", ".txt", "text/plain; charset=gbk"},
+		{"missing type guessed from extension", "", ".json", "application/json"},
+		{"generic type guessed from extension", "application/octet-stream", ".pdf", "application/pdf"},
+		{"invalid type guessed from extension", "not a type", ".pdf", "application/pdf"},
+		{"unknown extension", "", ".unknownext", "application/octet-stream"},
+		{"generic and no extension", "application/octet-stream", "", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		meta := http.Header{}
+		if tt.stored != "" {
+			meta.Set("Content-Type", tt.stored)
+		}
+		if got := downloadContentType(meta, tt.ext); got != tt.want {
+			t.Errorf("%s: downloadContentType(%q, %q) = %q, want %q", tt.name, tt.stored, tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestWithCharset(t *testing.T) {
+	charsets := parseInlineTypes(defaultCharsetContentTypes)
+	tests := []struct {
+		name, contentType, stored, metaCharset, want string
+	}{
+		{"text gets utf-8", "text/plain", "", "", "text/plain; charset=utf-8"},
+		{"wildcard match", "text/csv", "", "", "text/csv; charset=utf-8"},
+		{"json gets utf-8", "application/json", "", "", "application/json; charset=utf-8"},
+		{"svg gets utf-8", "image/svg+xml", "", "", "image/svg+xml; charset=utf-8"},
+		{"existing charset kept", "text/plain; charset=gbk", "", "utf-8", "text/plain; charset=gbk"},
+		{"meta charset preferred", "text/plain", "text/plain; charset=big5", "gbk", "text/plain; charset=gbk"},
+		{"stored charset used", "text/plain", "text/plain; charset=big5", "", "text/plain; charset=big5"},
+		{"meta charset applies to any type", "application/octet-stream", "", "shift_jis", "application/octet-stream; charset=shift_jis"},
+		{"binary type unchanged", "image/png", "", "", "image/png"},
+		{"invalid type unchanged", "not a type", "", "", "not a type"},
+	}
+	for _, tt := range tests {
+		meta := http.Header{}
+		if tt.stored != "" {
+			meta.Set("Content-Type", tt.stored)
+		}
+		if tt.metaCharset != "" {
+			meta.Set("X-Oss-Meta-Charset", tt.metaCharset)
+		}
+		if got := withCharset(tt.contentType, meta, charsets); got != tt.want {
+			t.Errorf("%s: withCharset(%q) = %q, want %q", tt.name, tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// duplicateGroup 内容相同的一组对象；hash 为 sha256:<元数据中的 SHA-256> 或 etag:<单次上传对象的 ETag>
+type duplicateGroup struct {
+	Hash string   `json:"hash"`
+	Size int64    `json:"size"`
+	Keys []string `json:"keys"`
+}
+
+// duplicateReport 重复对象扫描结果，Reclaimable 为每组只保留一个对象时可以释放的字节数
+// Unhashed 为既没有 SHA-256 元数据、又是分片上传（ETag 不是内容 MD5）而无法判断的对象数
+type duplicateReport struct {
+	Prefix      string           `json:"prefix"`
+	Scanned     int              `json:"scanned"`
+	Unhashed    int              `json:"unhashed"`
+	Reclaimable int64            `json:"reclaimable"`
+	Groups      []duplicateGroup `json:"groups"`
+}
+
+// 重复对象报告的对象名：<manifestPrefix>duplicates-<UTC 时间戳>.json
+func duplicatesReportKey(manifestPrefix string, now time.Time) string {
+	return manifestPrefix + "duplicates-" + now.UTC().Format("20060102T150405Z") + ".json"
+}
+
+// 后台扫描重复对象，完成后把报告上传到 key，任务的 output 为报告的对象名
+func runDuplicatesJob(bucket *oss.Bucket, jobs *jobStore, id, prefix string, skip []string, key string) {
+	var report duplicateReport
+	err := runReportJob(bucket, jobs, id, key, func() (any, error) {
+		var err error
+		report, err = findDuplicates(bucket, prefix, skip)
+		return report, err
+	})
+	if err != nil {
+		log.Printf("Duplicates job %s failed: %v", id, err)
+		return
+	}
+	log.Printf("Duplicates job %s found %d group(s) among %d object(s)", id, len(report.Groups), report.Scanned)
+}
+
+// 内容相同的对象大小必然相同：先按列举结果中的大小分组，只对大小相同的对象逐个读取元数据取得内容摘要
+func findDuplicates(bucket *oss.Bucket, prefix string, skip []string) (duplicateReport, error) {
+	report := duplicateReport{Prefix: prefix, Groups: []duplicateGroup{}}
+	bySize := make(map[int64][]oss.ObjectProperties)
+	marker := ""
+	for {
+		res, err := bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000))
+		if err != nil {
+			return report, fmt.Errorf("failed to list objects: %v", err)
+		}
+		for _, object := range res.Objects {
+			// 目录标记都是 0 字节，不算重复内容
+			if hasAnyPrefix(object.Key, skip) || isDirectoryMarker(object) {
+				continue
+			}
+			report.Scanned++
+			bySize[object.Size] = append(bySize[object.Size], object)
+		}
+		if !res.IsTruncated {
+			break
+		}
+		marker = res.NextMarker
+	}
+
+	for size, objects := range bySize {
+		if len(objects) < 2 {
+			continue
+		}
+		byHash := make(map[string][]string)
+		for _, object := range objects {
+			hash, err := contentHash(bucket, object)
+			if err != nil {
+				return report, fmt.Errorf("failed to get metadata of %s: %v", object.Key, err)
+			}
+			if hash == "" {
+				report.Unhashed++
+				continue
+			}
+			byHash[hash] = append(byHash[hash], object.Key)
+		}
+		for hash, keys := range byHash {
+			if len(keys) < 2 {
+				continue
+			}
+			sort.Strings(keys)
+			report.Groups = append(report.Groups, duplicateGroup{Hash: hash, Size: size, Keys: keys})
+			report.Reclaimable += size * int64(len(keys)-1)
+		}
+	}
+	// 浪费空间最多的组排在前面
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if wa, wb := a.Size*int64(len(a.Keys)-1), b.Size*int64(len(b.Keys)-1); wa != wb {
+			return wa > wb
+		}
+		return a.Keys[0] < b.Keys[0]
+	})
+	return report, nil
+}
+
+// 优先使用上传时保存的 SHA-256；没有时退回到 ETag，但分片上传的 ETag（带 "-"）不是内容的 MD5，无法使用
+func contentHash(bucket *oss.Bucket, object oss.ObjectProperties) (string, error) {
+	meta, err := bucket.GetObjectDetailedMeta(object.Key)
+	if err != nil {
+		return "", err
+	}
+	if sum := meta.Get(checksumMetaHeader); sum != "" {
+		return "sha256:" + sum, nil
+	}
+	if etag := normalizeETag(object.ETag); etag != "" && !strings.Contains(etag, "-") {
+		return "etag:" + etag, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// exportOptions 导出任务的配置
+type exportOptions struct {
+	volumeSize     int64 // 每个 tar 卷的目标大小，写满后开始下一卷
+	bandwidth      int64 // 读取对象内容的速率上限（字节/秒），为 0 时不限制
+	parts          partSizeOptions
+	manifestPrefix string // 清单不包含这个前缀下的对象，导出文件本身也保存在其下
+}
+
+// exportVolume 一个已完成的 tar 卷，包含清单中从 First 开始的 Entries 个条目（含被跳过的）
+type exportVolume struct {
+	Key     string `json:"key"`
+	First   int    `json:"first"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// exportSkipped 无法读取而被跳过的对象；读取到一半失败的对象仍在卷中，剩余内容以 0 填充
+type exportSkipped struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// exportReport 导出任务的报告；任务中途失败时，以相同的 manifest 和 NextOffset 重新导出即可从未完成的卷继续
+type exportReport struct {
+	Prefix     string          `json:"prefix"`
+	Manifest   string          `json:"manifest"`
+	Offset     int             `json:"offset"`
+	NextOffset int             `json:"nextOffset"`
+	Total      int             `json:"total"`
+	Bytes      int64           `json:"bytes"`
+	Volumes    []exportVolume  `json:"volumes"`
+	Skipped    []exportSkipped `json:"skipped"`
+}
+
+// 导出文件的基础对象名：<manifestPrefix>exports/<UTC 时间戳>，清单、各卷和报告都以此为前缀
+func exportBaseKey(manifestPrefix string, now time.Time) string {
+	return manifestPrefix + "exports/" + now.UTC().Format("20060102T150405Z")
+}
+
+// 后台导出：manifestKey 为空时先为 prefix 生成清单（<base>.ndjson），再从清单的第 offset 个条目开始，
+// 把对象依次写入 <base>-00001.tar、<base>-00002.tar 等卷，每卷以分片上传流式写入 OSS；报告写入 <base>.json
+// 每完成一卷就持久化一次进度，任务失败（包括服务重启）后按报错中的 offset 续传，已完成的卷不必重新导出
+func runExportJob(bucket *oss.Bucket, jobs *jobStore, id, prefix, manifestKey string, offset int, base string, opts exportOptions) {
+	var report exportReport
+	err := runReportJob(bucket, jobs, id, base+".json", func() (any, error) {
+		var err error
+		report, err = exportPrefix(bucket, jobs, id, prefix, manifestKey, offset, base, opts)
+		return report, err
+	})
+	if err != nil {
+		log.Printf("Export job %s failed: %v", id, err)
+		return
+	}
+	log.Printf("Export job %s wrote %d volume(s), %d bytes, skipped %d object(s)", id, len(report.Volumes), report.Bytes, len(report.Skipped))
+}
+
+func exportPrefix(bucket *oss.Bucket, jobs *jobStore, id, prefix, manifestKey string, offset int, base string, opts exportOptions) (exportReport, error) {
+	report := exportReport{Prefix: prefix, Manifest: manifestKey, Offset: offset, Volumes: []exportVolume{}, Skipped: []exportSkipped{}}
+	if manifestKey == "" {
+		report.Manifest = base + ".ndjson"
+		if _, err := buildManifest(bucket, prefix, opts.manifestPrefix, report.Manifest); err != nil {
+			return report, err
+		}
+	}
+	entries, err := readManifest(bucket, report.Manifest)
+	if err != nil {
+		return report, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	if offset > len(entries) {
+		return report, fmt.Errorf("offset %d is beyond the %d manifest entries", offset, len(entries))
+	}
+	report.Total = len(entries)
+	var total int64
+	for _, entry := range entries[offset:] {
+		total += entry.Size
+	}
+	limiter := newByteRateLimiter(opts.bandwidth)
+	next := offset
+	for next < len(entries) {
+		key := fmt.Sprintf("%s-%05d.tar", base, len(report.Volumes)+1)
+		volume, skipped, err := writeExportVolume(bucket, key, entries, next, opts, limiter, func(n int64) {
+			jobs.setProgress(id, report.Bytes+n, total)
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to write %s, resume with manifest=%s offset=%d: %v", key, report.Manifest, next, err)
+		}
+		next += volume.Entries
+		report.Volumes = append(report.Volumes, volume)
+		report.Skipped = append(report.Skipped, skipped...)
+		report.Bytes += volume.Bytes
+		report.NextOffset = next
+		jobs.update(id, func(job *Job) {
+			job.Progress = &JobProgress{Bytes: report.Bytes, Total: total, Items: next}
+		})
+	}
+	report.NextOffset = next
+	return report, nil
+}
+
+// 写入一卷：从 entries[first] 开始，至少写入一个条目，写满 volumeSize 后停止；返回的 Bytes 为卷中对象内容的字节数
+// 对象读取失败时跳过（开始读取前）或以 0 填充剩余内容（读取中途），只有写入 OSS 失败才返回错误
+func writeExportVolume(bucket *oss.Bucket, key string, entries []manifestEntry, first int, opts exportOptions, limiter *byteRateLimiter, progress func(n int64)) (exportVolume, []exportSkipped, error) {
+	volume := exportVolume{Key: key, First: first}
+	var skipped []exportSkipped
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := func() error {
+			for i := first; i < len(entries) && (i == first || volume.Bytes < opts.volumeSize); i++ {
+				n, skip, err := writeExportEntry(tw, bucket, entries[i], limiter, func(n int64) { progress(volume.Bytes + n) })
+				if err != nil {
+					return err
+				}
+				if skip != nil {
+					skipped = append(skipped, *skip)
+				}
+				volume.Bytes += n
+				volume.Entries++
+			}
+			return tw.Close()
+		}()
+		pw.CloseWithError(err)
+		done <- err
+	}()
+	_, err := multipartUpload(bucket, key, pr, -1, opts.parts, []oss.Option{oss.ContentType("application/x-tar")}, nil)
+	// 上传失败时让写入方的下一次写入立即返回，而不是一直阻塞
+	pr.CloseWithError(fmt.Errorf("upload aborted: %v", err))
+	if writeErr := <-done; err == nil {
+		err = writeErr
+	}
+	return volume, skipped, err
+}
+
+// 写入一个 tar 条目，返回写入的内容字节数；对象无法读取时返回 skip，写入 tw 出错时返回 err
+func writeExportEntry(tw *tar.Writer, bucket *oss.Bucket, entry manifestEntry, limiter *byteRateLimiter, progress func(n int64)) (int64, *exportSkipped, error) {
+	if isDirectoryKey(entry.Key) {
+		return 0, nil, tw.WriteHeader(&tar.Header{Name: entry.Key, Typeflag: tar.TypeDir, Mode: 0755, ModTime: entry.LastModified})
+	}
+	// 以清单中的 ETag 为条件读取，保证写入的内容与 tar 头中的大小一致
+	body, err := bucket.GetObject(entry.Key, oss.IfMatch("\""+entry.ETag+"\""))
+	if err != nil {
+		return 0, &exportSkipped{Key: entry.Key, Error: err.Error()}, nil
+	}
+	defer body.Close()
+	if err := tw.WriteHeader(&tar.Header{Name: entry.Key, Typeflag: tar.TypeReg, Mode: 0644, Size: entry.Size, ModTime: entry.LastModified}); err != nil {
+		return 0, nil, err
+	}
+	src := io.LimitReader(body, entry.Size)
+	buf := make([]byte, 32*1024)
+	var written int64
+	var skip *exportSkipped
+	for written < entry.Size {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			limiter.wait(n)
+			if _, err := tw.Write(buf[:n]); err != nil {
+				return written, nil, err
+			}
+			written += int64(n)
+			progress(written)
+		}
+		if readErr != nil && written < entry.Size {
+			skip = &exportSkipped{Key: entry.Key, Error: fmt.Sprintf("read failed after %d of %d bytes, rest zero-filled: %v", written, entry.Size, readErr)}
+			break
+		}
+	}
+	if written < entry.Size {
+		if _, err := io.CopyN(tw, zeroReader{}, entry.Size-written); err != nil {
+			return written, nil, err
+		}
+	}
+	return entry.Size, skip, nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// byteRateLimiter 把平均读取速率限制在 rate 字节/秒以内，rate 为 0 时不限制；只在单个 goroutine 中使用
+type byteRateLimiter struct {
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+func newByteRateLimiter(rate int64) *byteRateLimiter {
+	return &byteRateLimiter{rate: rate, start: time.Now()}
+}
+
+// 记录读取了 n 字节，超出速率时等待
+func (l *byteRateLimiter) wait(n int) {
+	if l.rate <= 0 {
+		return
+	}
+	l.n += int64(n)
+	expected := time.Duration(float64(l.n) / float64(l.rate) * float64(time.Second))
+	if d := expected - time.Since(l.start); d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 跨地域读故障转移：主存储桶返回连接错误或 5xx 时，在备用地域的复制存储桶上重试一次
+// NoSuchKey 等 4xx 错误说明请求本身已被正常处理，不会转移；未配置备用存储桶时只访问主存储桶
+type failoverReads struct {
+	primary         *oss.Bucket
+	secondary       *oss.Bucket // 为 nil 时不启用故障转移
+	primaryRegion   string
+	secondaryRegion string
+}
+
+// 在主存储桶上执行 fn，需要时改到备用存储桶上重试，返回实际完成请求的存储桶，后续读取应使用同一个存储桶
+// 启用故障转移时记录每个请求由哪个地域返回
+func (f *failoverReads) run(ctx context.Context, object string, fn func(*oss.Bucket) error) (*oss.Bucket, error) {
+	err := fn(f.primary)
+	if f.secondary == nil {
+		return f.primary, err
+	}
+	if !shouldFailover(ctx, err) {
+		log.Printf("Read of %s served by %s", object, f.primaryRegion)
+		return f.primary, err
+	}
+	log.Printf("Read of %s failed in %s, failing over to %s: %v", object, f.primaryRegion, f.secondaryRegion, err)
+	if err := fn(f.secondary); err != nil {
+		return f.secondary, err
+	}
+	log.Printf("Read of %s served by %s", object, f.secondaryRegion)
+	return f.secondary, nil
+}
+
+// 连接错误（没有 OSS 响应）和 5xx 值得换个地域重试；客户端取消的请求不重试
+func shouldFailover(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if ossErr, ok := asServiceError(err); ok {
+		return ossErr.StatusCode >= 500
+	}
+	var unexpected oss.UnexpectedStatusCodeError
+	if errors.As(err, &unexpected) {
+		return unexpected.Got() >= 500
+	}
+	return true
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// fakeOSS 测试用的内存 OSS，只实现本服务用到的对象和分片上传接口；IP 地址的 endpoint 使用路径形式 /<bucket>/<key>
+type fakeOSS struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	uploads map[string]*fakeUpload
+	nextID  int
+	aborted []string // 已取消的分片上传 ID
+	// 在处理每个请求前调用，返回 false 时请求已被处理（例如注入错误或延迟）
+	intercept func(w http.ResponseWriter, r *http.Request) bool
+}
+
+type fakeObject struct {
+	data   []byte
+	header http.Header
+}
+
+type fakeUpload struct {
+	key       string
+	header    http.Header
+	parts     map[int][]byte
+	initiated time.Time
+}
+
+func newFakeOSS(t *testing.T) *fakeOSS {
+	f := &fakeOSS{objects: map[string]fakeObject{}, uploads: map[string]*fakeUpload{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeOSS) bucket(t *testing.T) *oss.Bucket {
+	client, err := oss.New(f.server.URL, "test-access-key", "test-secret")
+	if err != nil {
+		t.Fatalf("oss.New: %v", err)
+	}
+	bucket, err := client.Bucket("test")
+	if err != nil {
+		t.Fatalf("client.Bucket: %v", err)
+	}
+	return bucket
+}
+
+func (f *fakeOSS) put(key string, data []byte, header http.Header) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if header == nil {
+		header = http.Header{}
+	}
+	f.objects[key] = fakeObject{data: data, header: header}
+}
+
+func (f *fakeOSS) object(key string) (fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[key]
+	return obj, ok
+}
+
+func (f *fakeOSS) abortedUploads() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.aborted...)
+}
+
+func (f *fakeOSS) openUploads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.uploads)
+}
+
+// 把分片上传的发起时间提前 age
+func (f *fakeOSS) ageUpload(id string, age time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploads[id].initiated = f.uploads[id].initiated.Add(-age)
+}
+
+func fakeETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + strings.ToUpper(hex.EncodeToString(sum[:])) + `"`
+}
+
+func fakeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code><Message>%s</Message><RequestId>fake</RequestId></Error>", code, code)
+}
+
+func (f *fakeOSS) serve(w http.ResponseWriter, r *http.Request) {
+	if f.intercept != nil && !f.intercept(w, r) {
+		return
+	}
+	// /<bucket>/<key>
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	query := r.URL.Query()
+	if len(parts) < 2 || parts[1] == "" {
+		if r.Method == http.MethodGet && query.Has("uploads") {
+			f.listUploads(w, query)
+			return
+		}
+		if r.Method == http.MethodGet {
+			f.list(w, query)
+			return
+		}
+		fakeError(w, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+	key := parts[1]
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextID++
+		id := fmt.Sprintf("upload-%d", f.nextID)
+		f.uploads[id] = &fakeUpload{key: key, header: storedHeader(r.Header), parts: map[int][]byte{}, initiated: time.Now()}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>test</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		upload, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		if source := r.Header.Get("X-Oss-Copy-Source"); source != "" {
+			srcKey, _ := url.QueryUnescape(strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)[1])
+			src, ok := f.objects[srcKey]
+			if !ok {
+				fakeError(w, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			if match := r.Header.Get("X-Oss-Copy-Source-If-Match"); match != "" && match != fakeETag(src.data) {
+				fakeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+				return
+			}
+			var start, end int
+			fmt.Sscanf(r.Header.Get("X-Oss-Copy-Source-Range"), "bytes=%d-%d", &start, &end)
+			upload.parts[number] = src.data[start : end+1]
+			fmt.Fprintf(w, "<CopyPartResult><ETag>%s</ETag></CopyPartResult>", fakeETag(upload.parts[number]))
+			return
+		}
+		upload.parts[number] = body
+		w.Header().Set("ETag", fakeETag(body))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		id := query.Get("uploadId")
+		upload, ok := f.uploads[id]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		if _, exists := f.objects[upload.key]; exists && r.Header.Get("X-Oss-Forbid-Overwrite") == "true" {
+			fakeError(w, http.StatusConflict, "FileAlreadyExists")
+			return
+		}
+		var data []byte
+		for i := 1; i <= len(upload.parts); i++ {
+			data = append(data, upload.parts[i]...)
+		}
+		delete(f.uploads, id)
+		f.objects[upload.key] = fakeObject{data: data, header: upload.header}
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>test</Bucket><Key>%s</Key><ETag>%s</ETag></CompleteMultipartUploadResult>", upload.key, fakeETag(data))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		id := query.Get("uploadId")
+		if _, ok := f.uploads[id]; !ok {
+			fakeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		delete(f.uploads, id)
+		f.aborted = append(f.aborted, id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Oss-Copy-Source") != "":
+		source := r.Header.Get("X-Oss-Copy-Source")
+		srcKey, _ := url.QueryUnescape(strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)[1])
+		src, ok := f.objects[srcKey]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if match := r.Header.Get("X-Oss-Copy-Source-If-Match"); match != "" && match != fakeETag(src.data) {
+			fakeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		if _, exists := f.objects[key]; exists && r.Header.Get("X-Oss-Forbid-Overwrite") == "true" {
+			fakeError(w, http.StatusConflict, "FileAlreadyExists")
+			return
+		}
+		header := src.header
+		if strings.EqualFold(r.Header.Get("X-Oss-Metadata-Directive"), "REPLACE") {
+			header = storedHeader(r.Header)
+		}
+		f.objects[key] = fakeObject{data: src.data, header: header}
+		fmt.Fprintf(w, "<CopyObjectResult><LastModified>2026-01-01T00:00:00.000Z</LastModified><ETag>%s</ETag></CopyObjectResult>", fakeETag(src.data))
+	case r.Method == http.MethodPut:
+		if _, exists := f.objects[key]; exists && r.Header.Get("X-Oss-Forbid-Overwrite") == "true" {
+			fakeError(w, http.StatusConflict, "FileAlreadyExists")
+			return
+		}
+		f.objects[key] = fakeObject{data: body, header: storedHeader(r.Header)}
+		w.Header().Set("ETag", fakeETag(body))
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		etag := fakeETag(obj.data)
+		if match := r.Header.Get("If-Match"); match != "" && match != etag {
+			fakeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		// 没有保存类型时不让 net/http 按内容猜测
+		w.Header()["Content-Type"] = nil
+		for name, values := range obj.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("ETag", etag)
+		data := obj.data
+		status := http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start, end int
+			if n, _ := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); n < 2 {
+				end = len(data) - 1
+			}
+			end = min(end, len(data)-1)
+			data, status = data[start:end+1], http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.data)))
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			io.Copy(w, bytes.NewReader(data))
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// ListObjects：支持 prefix、marker、max-keys 和 delimiter；SDK 总是带 encoding-type=url，结果中的名字按查询参数规则编码
+func (f *fakeOSS) list(w http.ResponseWriter, query url.Values) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prefix, marker, delimiter := query.Get("prefix"), query.Get("marker"), query.Get("delimiter")
+	maxKeys, err := strconv.Atoi(query.Get("max-keys"))
+	if err != nil || maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	encode := func(s string) string { return s }
+	if query.Get("encoding-type") == "url" {
+		encode = url.QueryEscape
+	}
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var contents, prefixes strings.Builder
+	seen := map[string]bool{}
+	count, next, truncated := 0, "", false
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+		if count == maxKeys {
+			truncated = true
+			break
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if !seen[common] {
+					seen[common] = true
+					count++
+					next = key
+					fmt.Fprintf(&prefixes, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", encode(common))
+				}
+				continue
+			}
+		}
+		obj := f.objects[key]
+		count++
+		next = key
+		fmt.Fprintf(&contents, "<Contents><Key>%s</Key><LastModified>2026-01-01T00:00:00.000Z</LastModified><ETag>%s</ETag><Type>Normal</Type><Size>%d</Size><StorageClass>Standard</StorageClass></Contents>",
+			encode(key), fakeETag(obj.data), len(obj.data))
+	}
+	if !truncated {
+		next = ""
+	}
+	fmt.Fprintf(w, "<ListBucketResult><Name>test</Name><Prefix>%s</Prefix><Marker>%s</Marker><MaxKeys>%d</MaxKeys><Delimiter>%s</Delimiter><IsTruncated>%v</IsTruncated><NextMarker>%s</NextMarker>%s%s</ListBucketResult>",
+		encode(prefix), encode(marker), maxKeys, encode(delimiter), truncated, encode(next), contents.String(), prefixes.String())
+}
+
+// 写入时随对象保存的头：类型、缓存头和用户元数据
+func storedHeader(h http.Header) http.Header {
+	stored := http.Header{}
+	for name, values := range h {
+		canonical := http.CanonicalHeaderKey(name)
+		switch {
+		case canonical == "Content-Type", canonical == "Cache-Control", canonical == "Content-Encoding",
+			strings.HasPrefix(canonical, "X-Oss-Meta-"):
+			stored[canonical] = values
+		}
+	}
+	return stored
+}
+
+// ListMultipartUploads：支持 prefix，一次返回全部结果
+func (f *fakeOSS) listUploads(w http.ResponseWriter, query url.Values) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	encode := func(s string) string { return s }
+	if query.Get("encoding-type") == "url" {
+		encode = url.QueryEscape
+	}
+	ids := make([]string, 0, len(f.uploads))
+	for id := range f.uploads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var uploads strings.Builder
+	for _, id := range ids {
+		upload := f.uploads[id]
+		if !strings.HasPrefix(upload.key, query.Get("prefix")) {
+			continue
+		}
+		fmt.Fprintf(&uploads, "<Upload><Key>%s</Key><UploadId>%s</UploadId><Initiated>%s</Initiated></Upload>",
+			encode(upload.key), id, upload.initiated.UTC().Format("2006-01-02T15:04:05.000Z"))
+	}
+	fmt.Fprintf(w, "<ListMultipartUploadsResult><Bucket>test</Bucket><IsTruncated>false</IsTruncated>%s</ListMultipartUploadsResult>", uploads.String())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求头 Idempotency-Key：客户端重试同一次上传时带上相同的值，服务端直接返回第一次成功的结果
+const idempotencyHeader = "Idempotency-Key"
+
+type idempotencyEntry struct {
+	result   gin.H // 为 nil 表示第一次请求仍在处理中
+	finished time.Time
+}
+
+// idempotencyStore 在 window 时间内记住成功上传的结果，超过 maxEntries 时淘汰最早完成的记录
+// 只记录成功的结果，失败的请求不占用 key，客户端可以用同一个 key 重试
+type idempotencyStore struct {
+	window     time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+// window 为 0 时返回 nil，不启用幂等处理
+func newIdempotencyStore(window time.Duration, maxEntries int) *idempotencyStore {
+	if window <= 0 {
+		return nil
+	}
+	return &idempotencyStore{
+		window:     window,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*idempotencyEntry),
+	}
+}
+
+// 开始处理一个带 key 的请求：
+// 已有成功结果时返回该结果；同一个 key 的请求正在处理时 inProgress 为 true；否则登记为处理中，调用方结束后必须调用 finish
+func (s *idempotencyStore) begin(key string) (result gin.H, inProgress bool) {
+	if s == nil || key == "" {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[key]; ok {
+		if entry.result == nil {
+			return nil, true
+		}
+		if time.Since(entry.finished) <= s.window {
+			return entry.result, false
+		}
+	}
+	s.entries[key] = &idempotencyEntry{}
+	return nil, false
+}
+
+// 记录处理结果；result 为 nil（请求失败）时释放 key
+func (s *idempotencyStore) finish(key string, result gin.H) {
+	if s == nil || key == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if result == nil {
+		delete(s.entries, key)
+		return
+	}
+	s.entries[key] = &idempotencyEntry{result: result, finished: time.Now()}
+	s.evictLocked()
+}
+
+// 清理过期记录，仍超过上限时淘汰最早完成的记录；处理中的记录不淘汰
+func (s *idempotencyStore) evictLocked() {
+	var oldestKey string
+	var oldest time.Time
+	for k, entry := range s.entries {
+		if entry.result == nil {
+			continue
+		}
+		if time.Since(entry.finished) > s.window {
+			delete(s.entries, k)
+			continue
+		}
+		if oldest.IsZero() || entry.finished.Before(oldest) {
+			oldestKey, oldest = k, entry.finished
+		}
+	}
+	if len(s.entries) > s.maxEntries && oldestKey != "" {
+		delete(s.entries, oldestKey)
+	}
+}
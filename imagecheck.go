@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/webp" // 注册 WebP 解码器，JPEG/PNG/GIF 已在缩略图和转码中注册
+)
+
+// 上传校验能够解码的图片类型；SVG、HEIC 等无法解码的类型不做校验
+var decodableImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// imageInfo 校验通过后返回给客户端的图片信息
+type imageInfo struct {
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// 根据扩展名或表单中声明的类型判断上传的文件是否自称为可解码的图片
+func claimsDecodableImage(filename, declaredType string) bool {
+	if mediaType, _, err := mime.ParseMediaType(declaredType); err == nil && decodableImageTypes[mediaType] {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))))
+	return decodableImageTypes[mediaType]
+}
+
+// 只解析图片头部得到格式和尺寸，不解码整张图片；读取后把 r 重置到开头供后续上传
+func checkImage(r io.ReadSeeker) (imageInfo, error) {
+	cfg, format, err := image.DecodeConfig(r)
+	if _, seekErr := r.Seek(0, io.SeekStart); seekErr != nil {
+		return imageInfo{}, seekErr
+	}
+	if err != nil {
+		return imageInfo{}, fmt.Errorf("file is not a decodable image: %v", err)
+	}
+	return imageInfo{Format: format, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// 流式上传校验图片时最多读取的头部字节数，足以越过常见的 EXIF 等元数据段
+const imageHeaderLimit = 1 << 20
+
+// 流式上传时的图片校验：最多读取 imageHeaderLimit 字节解析图片头，返回的 Reader 先重放已读取的部分，再继续读取 r
+func checkImageStream(r io.Reader) (imageInfo, io.Reader, error) {
+	var head bytes.Buffer
+	cfg, format, err := image.DecodeConfig(io.TeeReader(io.LimitReader(r, imageHeaderLimit), &head))
+	rest := io.MultiReader(&head, r)
+	if err != nil {
+		return imageInfo{}, rest, fmt.Errorf("file is not a decodable image: %v", err)
+	}
+	return imageInfo{Format: format, Width: cfg.Width, Height: cfg.Height}, rest, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 导入任务更新进度的最小间隔
+const importProgressInterval = time.Second
+
+// progressReader 统计已读取的字节数，并按 importProgressInterval 节流上报
+type progressReader struct {
+	r      io.Reader
+	n      int64
+	last   time.Time
+	report func(n int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if now := time.Now(); now.Sub(p.last) >= importProgressInterval || err == io.EOF {
+		p.last = now
+		p.report(p.n)
+	}
+	return n, err
+}
+
+// importSizeReader 读取超过 max 字节时返回错误，导入因此失败，分片上传会被取消
+type importSizeReader struct {
+	r   io.Reader
+	max int64
+	n   int64
+}
+
+func (s *importSizeReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	if s.n > s.max {
+		return n, fmt.Errorf("remote file exceeds the limit of %d bytes", s.max)
+	}
+	return n, err
+}
+
+// 后台从 rawURL 下载并写入 key：响应带 Content-Length 且不超过分片阈值时单次上传，否则流式分片上传，
+// 没有 Content-Length 时由 multipartUpload 按逐步增大的分片大小上传；任务的 progress 为已读取的字节数
+// client 应由 outboundPolicy 创建，重定向和实际连接的地址同样受策略约束；imported 在成功后调用
+// maxSize 大于 0 时远端文件超过该大小即中止，任务失败
+func runImportJob(bucket *oss.Bucket, jobs *jobStore, id string, client *http.Client, rawURL, key string, maxSize int64, opts partSizeOptions, putOptions, completeOptions []oss.Option, imported func(key string, size int64)) {
+	jobs.update(id, func(job *Job) {
+		job.Status = JobRunning
+		job.Attempts = append(job.Attempts, JobAttempt{Number: 1, StartedAt: time.Now()})
+	})
+	size, err := importURL(bucket, client, rawURL, key, maxSize, opts, putOptions, completeOptions, func(done, total int64) {
+		jobs.setProgress(id, done, total)
+	})
+	jobs.update(id, func(job *Job) {
+		job.Attempts[len(job.Attempts)-1].FinishedAt = time.Now()
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			job.Attempts[len(job.Attempts)-1].Error = err.Error()
+			return
+		}
+		job.Status = JobSucceeded
+		job.Output = key
+	})
+	if err != nil {
+		log.Printf("Import job %s from %s failed: %v", id, rawURL, err)
+		return
+	}
+	log.Printf("Import job %s wrote %d bytes from %s to %s", id, size, rawURL, key)
+	imported(key, size)
+}
+
+func importURL(bucket *oss.Bucket, client *http.Client, rawURL, key string, maxSize int64, opts partSizeOptions, putOptions, completeOptions []oss.Option, progress func(done, total int64)) (int64, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("failed to fetch %s: remote server returned %s", rawURL, resp.Status)
+	}
+	// 远端声明的类型只在能解析时使用，否则由 OSS 按扩展名判断
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err == nil && validHeaderValue(contentType) {
+			putOptions = append(putOptions, oss.ContentType(contentType))
+		}
+	}
+	total := resp.ContentLength
+	var src io.Reader = resp.Body
+	if maxSize > 0 {
+		// 声明的长度已经超过上限时不必开始上传；没有声明或声明不实时在读取中途中止
+		if total > maxSize {
+			return 0, fmt.Errorf("remote file is %d bytes, exceeds the limit of %d bytes", total, maxSize)
+		}
+		src = &importSizeReader{r: resp.Body, max: maxSize}
+	}
+	body := &progressReader{r: src, report: func(n int64) { progress(n, total) }}
+	progress(0, total)
+	// 远端提前断开时读取会出错，或者因声明的长度与实际不符被 OSS 拒绝，不会留下不完整的对象
+	if total >= 0 && total <= opts.threshold {
+		err = bucket.PutObject(key, body, append(putOptions, oss.ContentLength(total))...)
+	} else {
+		_, err = multipartUpload(bucket, key, body, total, opts, putOptions, completeOptions)
+	}
+	return body.n, err
+}
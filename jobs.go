@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 异步任务的状态
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobRetrying  = "retrying"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job 记录一个异步任务（例如转码）的执行情况
+type Job struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	Status    string       `json:"status"`
+	Input     string       `json:"input"`
+	Output    string       `json:"output,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Attempts  []JobAttempt `json:"attempts,omitempty"`
+	Progress  *JobProgress `json:"progress,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+// JobAttempt 记录任务的一次执行尝试，便于客户端查看重试历史
+type JobAttempt struct {
+	Number     int       `json:"number"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Retryable  bool      `json:"retryable,omitempty"`
+}
+
+// JobProgress 长时间运行的任务（例如从 URL 导入）已处理的字节数，Total 为 -1 表示总量未知
+// Items 为按条目处理的任务已完成的条目数，例如导出任务已写入完成的卷的对象数
+type JobProgress struct {
+	Bytes int64 `json:"bytes"`
+	Total int64 `json:"total"`
+	Items int   `json:"items,omitempty"`
+}
+
+// jobStore 在内存中保存所有任务，并发安全
+// 配置了 backend 时，每次变更后都会把全部任务写入持久化存储，重启后可以恢复
+// 已结束的任务超过 retention 后删除，并且最多保留 maxFinished 个（先删最早结束的），进行中的任务不受影响
+type jobStore struct {
+	mu          sync.RWMutex
+	jobs        map[string]*Job
+	saveMu      sync.Mutex // 保证快照按变更顺序写入
+	backend     jobBackend
+	retention   time.Duration
+	maxFinished int
+}
+
+// jobBackend 任务记录的持久化存储
+type jobBackend interface {
+	// 读取之前保存的数据，尚未保存过时返回 nil, nil
+	load() ([]byte, error)
+	save(data []byte) error
+}
+
+// 创建任务存储；backend 为 nil 时只保存在内存中
+// 从 backend 恢复时，上次重启前仍未结束的任务无法继续执行，统一标记为失败
+func newJobStore(backend jobBackend, retention time.Duration, maxFinished int) (*jobStore, error) {
+	s := &jobStore{jobs: make(map[string]*Job), backend: backend, retention: retention, maxFinished: maxFinished}
+	if backend == nil {
+		return s, nil
+	}
+	data, err := backend.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jobs: %v", err)
+	}
+	if len(data) == 0 {
+		return s, nil
+	}
+	var saved []Job
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to decode jobs: %v", err)
+	}
+	interrupted := 0
+	for i := range saved {
+		job := saved[i]
+		if job.Status == JobPending || job.Status == JobRunning || job.Status == JobRetrying {
+			job.Status = JobFailed
+			job.Error = "interrupted by service restart"
+			job.UpdatedAt = time.Now()
+			interrupted++
+		}
+		s.jobs[job.ID] = &job
+	}
+	s.mu.Lock()
+	pruned := s.pruneLocked(time.Now())
+	s.mu.Unlock()
+	log.Printf("Restored %d job(s), %d marked as interrupted, %d expired", len(saved), interrupted, pruned)
+	if interrupted > 0 || pruned > 0 {
+		s.persist()
+	}
+	return s, nil
+}
+
+func (j *Job) finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// 删除超过保留期限或超出数量上限的已结束任务，返回删除的数量；调用方持有写锁
+func (s *jobStore) pruneLocked(now time.Time) int {
+	var finished []*Job
+	removed := 0
+	for id, job := range s.jobs {
+		if !job.finished() {
+			continue
+		}
+		if s.retention > 0 && now.Sub(job.UpdatedAt) > s.retention {
+			delete(s.jobs, id)
+			removed++
+			continue
+		}
+		finished = append(finished, job)
+	}
+	if s.maxFinished > 0 && len(finished) > s.maxFinished {
+		sort.Slice(finished, func(i, j int) bool { return finished[i].UpdatedAt.Before(finished[j].UpdatedAt) })
+		for _, job := range finished[:len(finished)-s.maxFinished] {
+			delete(s.jobs, job.ID)
+			removed++
+		}
+	}
+	return removed
+}
+
+// 创建一个处于 pending 状态的新任务
+func (s *jobStore) create(jobType, input string) Job {
+	now := time.Now()
+	job := &Job{
+		ID:        newJobID(),
+		Type:      jobType,
+		Status:    JobPending,
+		Input:     input,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.mu.Lock()
+	s.pruneLocked(now)
+	s.jobs[job.ID] = job
+	cp := job.copy()
+	s.mu.Unlock()
+	s.persist()
+	return cp
+}
+
+// 返回任务的副本，避免调用方与执行中的任务产生数据竞争
+func (s *jobStore) get(id string) (Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.copy(), true
+}
+
+// 执行只运行一次的报告类任务：build 生成报告，成功后以 JSON 上传到 key，任务的 output 为报告的对象名
+// 返回 build 或上传的错误，调用方负责记录日志
+func runReportJob(bucket *oss.Bucket, jobs *jobStore, id, key string, build func() (any, error)) error {
+	jobs.update(id, func(job *Job) {
+		job.Status = JobRunning
+		job.Attempts = append(job.Attempts, JobAttempt{Number: 1, StartedAt: time.Now()})
+	})
+	report, err := build()
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(report); err == nil {
+			err = bucket.PutObject(key, bytes.NewReader(data), oss.ContentType("application/json"))
+		}
+	}
+	jobs.update(id, func(job *Job) {
+		job.Attempts[len(job.Attempts)-1].FinishedAt = time.Now()
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			job.Attempts[len(job.Attempts)-1].Error = err.Error()
+			return
+		}
+		job.Status = JobSucceeded
+		job.Output = key
+	})
+	return err
+}
+
+// 在锁内修改任务，并刷新更新时间
+func (s *jobStore) update(id string, fn func(job *Job)) {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if ok {
+		fn(job)
+		job.UpdatedAt = time.Now()
+	}
+	s.mu.Unlock()
+	if ok {
+		s.persist()
+	}
+}
+
+// 更新任务进度；进度变化频繁且重启后任务会被标记为失败，因此只更新内存，不写入持久化存储
+func (s *jobStore) setProgress(id string, done, total int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok {
+		job.Progress = &JobProgress{Bytes: done, Total: total}
+		job.UpdatedAt = time.Now()
+	}
+}
+
+// 把当前所有任务的快照写入持久化存储，写入失败只记录日志，不影响任务执行
+func (s *jobStore) persist() {
+	if s.backend == nil {
+		return
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.RLock()
+	snapshot := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		snapshot = append(snapshot, job.copy())
+	}
+	s.mu.RUnlock()
+	data, err := json.Marshal(snapshot)
+	if err == nil {
+		err = s.backend.save(data)
+	}
+	if err != nil {
+		log.Printf("Failed to persist jobs: %v", err)
+	}
+}
+
+func (j *Job) copy() Job {
+	cp := *j
+	cp.Attempts = append([]JobAttempt(nil), j.Attempts...)
+	if j.Progress != nil {
+		progress := *j.Progress
+		cp.Progress = &progress
+	}
+	return cp
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// fileJobBackend 把任务保存到本地 JSON 文件，先写临时文件再重命名，避免写到一半时崩溃导致文件损坏
+type fileJobBackend struct {
+	path string
+}
+
+func (b fileJobBackend) load() ([]byte, error) {
+	data, err := os.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (b fileJobBackend) save(data []byte) error {
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// ossJobBackend 把任务保存为存储桶中的一个对象，适合多实例或无本地磁盘的部署
+type ossJobBackend struct {
+	bucket *oss.Bucket
+	key    string
+}
+
+func (b ossJobBackend) load() ([]byte, error) {
+	body, err := b.bucket.GetObject(b.key)
+	if err != nil {
+		if isNoSuchKey(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (b ossJobBackend) save(data []byte) error {
+	return b.bucket.PutObject(b.key, bytes.NewReader(data), oss.ContentType("application/json"))
+}
+
+// 根据配置选择任务的持久化方式：memory（默认，不持久化）、file 或 oss
+func newJobBackend(kind, path, key string, bucket *oss.Bucket) (jobBackend, error) {
+	switch kind {
+	case "", "memory":
+		return nil, nil
+	case "file":
+		return fileJobBackend{path: path}, nil
+	case "oss":
+		return ossJobBackend{bucket: bucket, key: key}, nil
+	default:
+		return nil, fmt.Errorf("unknown job store %q", kind)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// memoryJobBackend 保存最近一次写入的快照
+type memoryJobBackend struct {
+	data []byte
+}
+
+func (b *memoryJobBackend) load() ([]byte, error) { return b.data, nil }
+
+func (b *memoryJobBackend) save(data []byte) error {
+	b.data = data
+	return nil
+}
+
+func finishJob(s *jobStore, id, status string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[id].Status = status
+	s.jobs[id].UpdatedAt = at
+}
+
+func TestJobStoreRetention(t *testing.T) {
+	s, err := newJobStore(nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := s.create("transcode", "a.mp4")
+	recent := s.create("transcode", "b.mp4")
+	running := s.create("transcode", "c.mp4")
+	finishJob(s, expired.ID, JobSucceeded, time.Now().Add(-2*time.Hour))
+	finishJob(s, recent.ID, JobFailed, time.Now().Add(-time.Minute))
+	finishJob(s, running.ID, JobRunning, time.Now().Add(-2*time.Hour))
+	s.create("transcode", "d.mp4")
+	if _, ok := s.get(expired.ID); ok {
+		t.Errorf("finished job older than the retention was kept")
+	}
+	for _, id := range []string{recent.ID, running.ID} {
+		if _, ok := s.get(id); !ok {
+			t.Errorf("job %s was removed", id)
+		}
+	}
+}
+
+func TestJobStoreMaxFinished(t *testing.T) {
+	s, err := newJobStore(nil, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := 0; i < 4; i++ {
+		job := s.create("import", "x")
+		finishJob(s, job.ID, JobSucceeded, time.Now().Add(time.Duration(i-10)*time.Minute))
+		ids = append(ids, job.ID)
+	}
+	pending := s.create("import", "y")
+	// 最早结束的两个被删除，进行中的任务不计入上限
+	for i, id := range ids {
+		if _, ok := s.get(id); ok != (i >= 2) {
+			t.Errorf("job %d kept = %v, want %v", i, ok, i >= 2)
+		}
+	}
+	if _, ok := s.get(pending.ID); !ok {
+		t.Errorf("pending job was removed")
+	}
+}
+
+// 重启恢复时删除已过期的任务并写回持久化存储
+func TestJobStoreRestorePrunes(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	data, _ := json.Marshal([]Job{
+		{ID: "old", Status: JobSucceeded, UpdatedAt: old},
+		{ID: "new", Status: JobFailed, UpdatedAt: time.Now()},
+	})
+	backend := &memoryJobBackend{data: data}
+	s, err := newJobStore(backend, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.get("old"); ok {
+		t.Errorf("expired job was restored")
+	}
+	var saved []Job
+	if err := json.Unmarshal(backend.data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].ID != "new" {
+		t.Errorf("persisted jobs = %+v, want only the unexpired job", saved)
+	}
+}
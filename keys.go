@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// OSS 对象名最长 1023 字节（UTF-8 编码）
+const maxOSSKeyLength = 1023
+
+// 对象名过长时的处理方式
+const (
+	KeyLengthReject   = "reject"
+	KeyLengthTruncate = "truncate"
+)
+
+// 检查对象名长度，超过 maxLen 字节时按 strategy 拒绝或截断
+// 截断时保留目录部分和扩展名，只缩短文件名主体，并追加完整对象名哈希的前 8 位，避免截断后不同的长名字冲突
+func fitKeyLength(key string, maxLen int, strategy string) (string, error) {
+	if len(key) <= maxLen {
+		return key, nil
+	}
+	if strategy != KeyLengthTruncate {
+		return "", fmt.Errorf("object key is %d bytes, exceeds the limit of %d bytes", len(key), maxLen)
+	}
+	dir, base := path.Split(key)
+	ext := path.Ext(base)
+	stem := base[:len(base)-len(ext)]
+	sum := sha256.Sum256([]byte(key))
+	suffix := "-" + hex.EncodeToString(sum[:4]) + ext
+	keep := maxLen - len(dir) - len(suffix)
+	if keep < 1 || keep >= len(stem) {
+		// 目录部分或扩展名本身已经太长，截断文件名也无济于事
+		return "", fmt.Errorf("object key is %d bytes and cannot be truncated to %d bytes", len(key), maxLen)
+	}
+	// 不在多字节字符中间截断
+	for keep > 0 && !utf8.RuneStart(stem[keep]) {
+		keep--
+	}
+	return dir + stem[:keep] + suffix, nil
+}
+
+// 在 key 所在的目录下查找名字只有大小写不同的对象，最多检查 limit 个对象
+// 只比较目录下的直接子对象，目录部分的大小写必须一致；找到多个候选时无法判断客户端想要哪一个，按找不到处理
+func findCaseInsensitiveKey(bucket *oss.Bucket, key string, limit int, options ...oss.Option) (string, error) {
+	dir, _ := path.Split(key)
+	lower := strings.ToLower(key)
+	match, scanned, marker := "", 0, ""
+	for scanned < limit {
+		res, err := bucket.ListObjects(append(options, oss.Prefix(dir), oss.Delimiter("/"), oss.Marker(marker), oss.MaxKeys(min(1000, limit-scanned)))...)
+		if err != nil {
+			return "", err
+		}
+		for _, object := range res.Objects {
+			if object.Key != key && strings.ToLower(object.Key) == lower {
+				if match != "" {
+					return "", nil
+				}
+				match = object.Key
+			}
+		}
+		scanned += len(res.Objects)
+		if !res.IsTruncated {
+			break
+		}
+		marker = res.NextMarker
+	}
+	return match, nil
+}
+
+// 对象名中百分号编码的处理方式：off 原样保存，normalize 解码为规范形式后保存，reject 拒绝含有百分号编码的对象名
+const (
+	KeyEncodingOff       = "off"
+	KeyEncodingNormalize = "normalize"
+	KeyEncodingReject    = "reject"
+)
+
+// 对象名的规范形式：反复解码百分号编码直到不再变化，"a%20b.txt" 和 "a%2520b.txt" 都对应 "a b.txt"
+// 不是合法编码的 "%"（例如 "100%.txt"）原样保留；"+" 不当作空格，它在路径中没有特殊含义
+func canonicalKey(key string) string {
+	for strings.Contains(key, "%") {
+		decoded, err := url.PathUnescape(key)
+		if err != nil || decoded == key {
+			break
+		}
+		key = decoded
+	}
+	return key
+}
+
+// 与规范形式只有编码不同、客户端最可能误传的另一种写法：逐段百分号编码后的对象名；没有需要编码的字符时返回空字符串
+func encodedKeyVariant(canonical string) string {
+	segments := strings.Split(canonical, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	if encoded := strings.Join(segments, "/"); encoded != canonical {
+		return encoded
+	}
+	return ""
+}
+
+// 按 strategy 处理上传的对象名，返回实际使用的对象名，以及需要检查是否已存在的编码变体（为空时不必检查）
+// reject 时对象名含有可解码的百分号编码即返回错误
+func applyKeyEncoding(key, strategy string) (string, string, error) {
+	if strategy == KeyEncodingOff {
+		return key, "", nil
+	}
+	canonical := canonicalKey(key)
+	if strategy == KeyEncodingReject && canonical != key {
+		return "", "", fmt.Errorf("object key %q contains percent-encoding, send the decoded name %q instead", key, canonical)
+	}
+	return canonical, encodedKeyVariant(canonical), nil
+}
+
+// uploadKey 上传接口处理后的对象名：name 为实际使用的对象名，requested 为客户端传入的原始对象名，
+// warning 不为空时说明已存在以编码形式保存的同名对象（normalize 时照常上传，在响应中提示）
+type uploadKey struct {
+	name      string
+	requested string
+	variant   string
+	warning   string
+}
+
+// 上传类接口共用的对象名处理：按 KEY_ENCODING_STRATEGY 解码或拒绝百分号编码，按 KEY_LENGTH_STRATEGY 检查长度，
+// 再检查编码变体是否已存在，reject 时变体已存在返回 409，其余错误返回 400
+func resolveUploadKey(bucket *oss.Bucket, key string, maxLen int, lengthStrategy, encodingStrategy string, options ...oss.Option) (uploadKey, int, error) {
+	result := uploadKey{requested: key}
+	canonical, variant, err := applyKeyEncoding(key, encodingStrategy)
+	if err != nil {
+		return result, http.StatusBadRequest, err
+	}
+	if result.name, err = fitKeyLength(canonical, maxLen, lengthStrategy); err != nil {
+		return result, http.StatusBadRequest, err
+	}
+	if variant == "" {
+		return result, 0, nil
+	}
+	exists, err := bucket.IsObjectExist(variant, options...)
+	switch {
+	case err != nil:
+		// 检查失败不影响上传，只是无法提示
+		log.Printf("Failed to check encoded variant %s: %v", variant, err)
+	case exists && encodingStrategy == KeyEncodingReject:
+		result.variant = variant
+		return result, http.StatusConflict, fmt.Errorf("Object '%s' already exists under the encoded name '%s'", result.name, variant)
+	case exists:
+		result.variant = variant
+		result.warning = fmt.Sprintf("an object with the encoded name '%s' also exists", variant)
+		log.Printf("Upload of %s: %s", result.name, result.warning)
+	}
+	return result, 0, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCanonicalKey(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"a b", "a b"},
+		{"a%20b", "a b"},
+		{"a%2520b", "a b"},
+		{"dir%2Fname", "dir/name"},
+		{"100%.txt", "100%.txt"},
+		{"100%25.txt", "100%.txt"},
+		{"a+b", "a+b"},
+		{"a%2Bb", "a+b"},
+	}
+	for _, tt := range tests {
+		if got := canonicalKey(tt.key); got != tt.want {
+			t.Errorf("canonicalKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestEncodedKeyVariant(t *testing.T) {
+	tests := []struct {
+		canonical, want string
+	}{
+		{"plain.txt", ""},
+		{"a b", "a%20b"},
+		{"dir/a b", "dir/a%20b"},
+		{"100%.txt", "100%25.txt"},
+		{"a+b", ""},
+	}
+	for _, tt := range tests {
+		if got := encodedKeyVariant(tt.canonical); got != tt.want {
+			t.Errorf("encodedKeyVariant(%q) = %q, want %q", tt.canonical, got, tt.want)
+		}
+	}
+}
+
+func TestApplyKeyEncoding(t *testing.T) {
+	tests := []struct {
+		key, strategy string
+		want, variant string
+		wantErr       bool
+	}{
+		{"a%20b", KeyEncodingOff, "a%20b", "", false},
+		{"a%20b", KeyEncodingNormalize, "a b", "a%20b", false},
+		{"a%2520b", KeyEncodingNormalize, "a b", "a%20b", false},
+		{"100%.txt", KeyEncodingNormalize, "100%.txt", "100%25.txt", false},
+		{"a+b", KeyEncodingNormalize, "a+b", "", false},
+		{"a%20b", KeyEncodingReject, "", "", true},
+		{"a%2520b", KeyEncodingReject, "", "", true},
+		{"100%.txt", KeyEncodingReject, "100%.txt", "100%25.txt", false},
+		{"a b", KeyEncodingReject, "a b", "a%20b", false},
+		{"a+b", KeyEncodingReject, "a+b", "", false},
+	}
+	for _, tt := range tests {
+		got, variant, err := applyKeyEncoding(tt.key, tt.strategy)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("applyKeyEncoding(%q, %q) error = %v, wantErr %v", tt.key, tt.strategy, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want || variant != tt.variant {
+			t.Errorf("applyKeyEncoding(%q, %q) = %q, %q, want %q, %q", tt.key, tt.strategy, got, variant, tt.want, tt.variant)
+		}
+	}
+}
+
+func TestFitKeyLength(t *testing.T) {
+	const maxLen = 32
+	tests := []struct {
+		name, key, strategy string
+		wantErr             bool
+	}{
+		{"below limit", "dir/" + strings.Repeat("a", 20) + ".txt", KeyLengthReject, false},
+		{"at limit", "dir/" + strings.Repeat("a", maxLen-8) + ".txt", KeyLengthReject, false},
+		{"one byte over rejected", "dir/" + strings.Repeat("a", maxLen-7) + ".txt", KeyLengthReject, true},
+		{"far over rejected", strings.Repeat("a", 2*maxLen), KeyLengthReject, true},
+		{"at limit not truncated", "dir/" + strings.Repeat("a", maxLen-8) + ".txt", KeyLengthTruncate, false},
+		{"one byte over truncated", "dir/" + strings.Repeat("a", maxLen-7) + ".txt", KeyLengthTruncate, false},
+		{"far over truncated", "dir/" + strings.Repeat("a", 4*maxLen) + ".txt", KeyLengthTruncate, false},
+		{"multibyte not split", "d/" + strings.Repeat("文", maxLen) + ".txt", KeyLengthTruncate, false},
+		{"directory too long", strings.Repeat("d", maxLen) + "/a.txt", KeyLengthTruncate, true},
+		{"extension too long", "a." + strings.Repeat("e", maxLen), KeyLengthTruncate, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fitKeyLength(tt.key, maxLen, tt.strategy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fitKeyLength(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got) > maxLen {
+				t.Errorf("fitKeyLength(%q) = %q, %d bytes, want at most %d", tt.key, got, len(got), maxLen)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("fitKeyLength(%q) = %q, not valid UTF-8", tt.key, got)
+			}
+			if len(tt.key) <= maxLen {
+				if got != tt.key {
+					t.Errorf("fitKeyLength(%q) = %q, want unchanged", tt.key, got)
+				}
+				return
+			}
+			// 截断后保留目录和扩展名，扩展名前是完整对象名哈希的前 8 位
+			dir, base := path.Split(tt.key)
+			ext := path.Ext(base)
+			sum := sha256.Sum256([]byte(tt.key))
+			suffix := "-" + hex.EncodeToString(sum[:4]) + ext
+			if !strings.HasPrefix(got, dir) || !strings.HasSuffix(got, suffix) {
+				t.Errorf("fitKeyLength(%q) = %q, want prefix %q and suffix %q", tt.key, got, dir, suffix)
+			}
+			stem := strings.TrimSuffix(strings.TrimPrefix(got, dir), suffix)
+			if stem == "" || !strings.HasPrefix(base, stem) {
+				t.Errorf("fitKeyLength(%q) = %q, want a prefix of the original name before the hash", tt.key, got)
+			}
+		})
+	}
+}
+
+// 截断后的名字仍然不同：只有末尾不同的长名字不会冲突
+func TestFitKeyLengthDistinct(t *testing.T) {
+	prefix := strings.Repeat("a", 100)
+	a, err := fitKeyLength(prefix+"1.txt", 32, KeyLengthTruncate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fitKeyLength(prefix+"2.txt", 32, KeyLengthTruncate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("fitKeyLength truncated different keys to the same name %q", a)
+	}
+}
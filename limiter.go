@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ossSemaphore 限制同时进行的 OSS 操作数量，limit 为 0 表示不限制
+type ossSemaphore struct {
+	slots    chan struct{}
+	limit    int
+	rejected atomic.Int64
+}
+
+func newOSSSemaphore(limit int) *ossSemaphore {
+	s := &ossSemaphore{limit: limit}
+	if limit > 0 {
+		s.slots = make(chan struct{}, limit)
+	}
+	return s
+}
+
+// 在 wait 时间内尝试获取一个名额，获取失败返回 false
+func (s *ossSemaphore) acquire(wait time.Duration) bool {
+	return s.acquireContext(context.Background(), wait) == nil
+}
+
+// 与 acquire 相同，但 ctx 结束时提前返回 ctx 的错误；wait 为负数表示一直等待
+// wait 内没有空出名额时返回 errOSSBusy
+func (s *ossSemaphore) acquireContext(ctx context.Context, wait time.Duration) error {
+	if s.slots == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if wait != 0 {
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case s.slots <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+		}
+	}
+	s.rejected.Add(1)
+	return errOSSBusy
+}
+
+func (s *ossSemaphore) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+func (s *ossSemaphore) stats() gin.H {
+	return gin.H{
+		"inUse":    len(s.slots),
+		"limit":    s.limit,
+		"rejected": s.rejected.Load(),
+	}
+}
+
+// 传输层在 wait 内没有等到名额时返回的错误
+var errOSSBusy = errors.New("too many concurrent OSS operations")
+
+// ossLimiter 把 OSS 操作分为读、写两个独立的名额池，避免大量上传占满名额后连存在性检查都无法执行
+// 名额在 OSS 客户端的传输层按每次 OSS 请求占用（包括后台任务、清理、导入导出的调用）：
+// 经过中间件的请求发起的 OSS 调用最多等待 wait，之后返回 errOSSBusy，处理函数的 5xx 响应改为 503 和 Retry-After；
+// 后台任务没有等待上限，一直排队直到取得名额或自己的 context 结束
+type ossLimiter struct {
+	read       *ossSemaphore
+	write      *ossSemaphore
+	wait       time.Duration // 名额不足时请求入口最多等待的时间
+	retryAfter time.Duration // 返回 503 时建议客户端等待的时间
+	exempt     map[string]bool
+}
+
+func newOSSLimiter(maxRead, maxWrite int, wait, retryAfter time.Duration) *ossLimiter {
+	return &ossLimiter{
+		read:       newOSSSemaphore(maxRead),
+		write:      newOSSSemaphore(maxWrite),
+		wait:       wait,
+		retryAfter: retryAfter,
+		exempt:     make(map[string]bool),
+	}
+}
+
+// 不访问 OSS 的路由（例如本地状态查询）不占用名额
+func (l *ossLimiter) skip(paths ...string) {
+	for _, path := range paths {
+		l.exempt[path] = true
+	}
+}
+
+// GET/HEAD 请求占用读名额，其余请求占用写名额
+func (l *ossLimiter) pool(method string) (*ossSemaphore, string) {
+	if method == http.MethodGet || method == http.MethodHead {
+		return l.read, "read"
+	}
+	return l.write, "write"
+}
+
+// ossBusyMarker 记录请求发起的 OSS 调用是否因为没有名额被拒绝，经由请求的 context 传给传输层
+// （ossCtx 去掉了取消信号，但保留 context 中的值）
+type ossBusyMarker struct {
+	rejected   atomic.Bool
+	pool       atomic.Value // 被拒绝的名额池，"read" 或 "write"
+	retryAfter time.Duration
+}
+
+type ossBusyMarkerKey struct{}
+
+func ossBusyMarkerFrom(ctx context.Context) *ossBusyMarker {
+	marker, _ := ctx.Value(ossBusyMarkerKey{}).(*ossBusyMarker)
+	return marker
+}
+
+// 请求发起的 OSS 调用曾因没有名额被拒绝时，把处理函数的 5xx 响应改为 503 和 Retry-After；返回新的状态码和响应体
+func ossBusyResponse(c *gin.Context, code int, obj any) (int, any) {
+	if code < http.StatusInternalServerError {
+		return code, obj
+	}
+	marker := ossBusyMarkerFrom(c.Request.Context())
+	if marker == nil || !marker.rejected.Load() {
+		return code, obj
+	}
+	pool, _ := marker.pool.Load().(string)
+	c.Header("Retry-After", strconv.Itoa(max(1, int(marker.retryAfter.Seconds()))))
+	return http.StatusServiceUnavailable, gin.H{
+		"status":  "error",
+		"message": fmt.Sprintf("Too many concurrent OSS %s operations, please retry later", pool),
+	}
+}
+
+// 中间件：名额耗尽且 wait 内没有空出时直接返回 503 和 Retry-After，不再排队等待 OSS 调用
+// 入口只检查是否有空闲名额，并不占用；真正的名额由之后每次 OSS 调用在传输层占用，最多等待 wait
+func (l *ossLimiter) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l.exempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+		pool, name := l.pool(c.Request.Method)
+		if !pool.acquire(l.wait) {
+			c.Header("Retry-After", strconv.Itoa(max(1, int(l.retryAfter.Seconds()))))
+			abortRespond(c, http.StatusServiceUnavailable, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Too many concurrent OSS %s operations, please retry later", name),
+			})
+			return
+		}
+		pool.release()
+		marker := &ossBusyMarker{retryAfter: l.retryAfter}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), ossBusyMarkerKey{}, marker))
+		c.Next()
+	}
+}
+
+func (l *ossLimiter) stats() gin.H {
+	return gin.H{
+		"read":  l.read.stats(),
+		"write": l.write.stats(),
+	}
+}
+
+// limiterTransport 在 OSS 客户端的传输层为每次 OSS 请求占用一个名额，名额不足时排队等待：
+// 经过中间件的请求最多等待 wait，之后返回 errOSSBusy 并在请求的 ossBusyMarker 上记录；其他调用没有等待上限
+// 名额只覆盖发出请求（包括上传请求体）到收到响应头的时间：流式下载读取响应体期间不占用名额
+type limiterTransport struct {
+	base    http.RoundTripper
+	limiter *ossLimiter
+}
+
+func (t limiterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pool, name := t.limiter.pool(req.Method)
+	if pool.slots != nil {
+		marker := ossBusyMarkerFrom(req.Context())
+		wait := time.Duration(-1)
+		if marker != nil {
+			wait = t.limiter.wait
+		}
+		if err := pool.acquireContext(req.Context(), wait); err != nil {
+			if errors.Is(err, errOSSBusy) {
+				marker.pool.Store(name)
+				marker.rejected.Store(true)
+			}
+			return nil, err
+		}
+		defer pool.release()
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 同时进行的 OSS 请求不超过名额，读、写名额互不占用
+func TestLimiterTransportCapsConcurrentRequests(t *testing.T) {
+	var inFlight, peak atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(server.Close)
+	limiter := newOSSLimiter(2, 1, 0, time.Second)
+	client := ossHTTPClient(testTransportConfig(), nil, nil, limiter)
+	runConcurrentRequests(t, client, server.URL, 8, 32)
+	if got := peak.Load(); got > 2 {
+		t.Errorf("peak concurrent reads = %d, want at most 2", got)
+	}
+	if inUse := len(limiter.read.slots); inUse != 0 {
+		t.Errorf("read slots in use after all requests = %d, want 0", inUse)
+	}
+}
+
+// 名额在收到响应头后释放，读取响应体期间不占用：一个未读完的下载不会阻塞下一次请求
+func TestLimiterTransportReleasesBeforeBody(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-release
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	limiter := newOSSLimiter(1, 1, 0, time.Second)
+	client := ossHTTPClient(testTransportConfig(), nil, nil, limiter)
+	slow, err := client.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Body.Close()
+	done := make(chan error, 1)
+	go func() {
+		resp, err := client.Get(server.URL + "/fast")
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("second request blocked while the first response body was still open")
+	}
+}
+
+// 上传请求体发送期间占用写名额
+func TestLimiterTransportHoldsWriteSlotDuringUpload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	t.Cleanup(server.Close)
+	limiter := newOSSLimiter(1, 1, 0, time.Second)
+	client := ossHTTPClient(testTransportConfig(), nil, nil, limiter)
+	body, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req, _ := http.NewRequest(http.MethodPut, server.URL+"/object", body)
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	io.WriteString(writer, strings.Repeat("x", 1024))
+	if inUse := len(limiter.write.slots); inUse != 1 {
+		t.Errorf("write slots in use during upload = %d, want 1", inUse)
+	}
+	if inUse := len(limiter.read.slots); inUse != 0 {
+		t.Errorf("read slots in use during upload = %d, want 0", inUse)
+	}
+	writer.Close()
+	<-done
+	if inUse := len(limiter.write.slots); inUse != 0 {
+		t.Errorf("write slots in use after upload = %d, want 0", inUse)
+	}
+}
+
+// 名额一直被占用时，请求发起的 OSS 调用最多等待 wait，处理函数的 500 改为 503 和 Retry-After；
+// 后台调用（没有经过中间件）继续排队，直到取得名额
+func TestLimiterTransportBoundsRequestWait(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(server.Close)
+	limiter := newOSSLimiter(1, 1, 50*time.Millisecond, 3*time.Second)
+	client := ossHTTPClient(testTransportConfig(), nil, nil, limiter)
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		if resp, err := client.Get(server.URL + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	for len(limiter.read.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// 中间件入口只检查名额，这里模拟入口检查之后名额被占满：直接挂上标记，由处理函数发起 OSS 调用
+	router := gin.New()
+	router.GET("/object", func(c *gin.Context) {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), ossBusyMarkerKey{}, &ossBusyMarker{retryAfter: limiter.retryAfter}))
+		req, _ := http.NewRequestWithContext(context.WithoutCancel(c.Request.Context()), http.MethodGet, server.URL+"/fast", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			if !errors.Is(err, errOSSBusy) {
+				t.Errorf("OSS call error = %v, want errOSSBusy", err)
+			}
+			respond(c, http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to get object"})
+			return
+		}
+		resp.Body.Close()
+		respond(c, http.StatusOK, gin.H{"status": "success"})
+	})
+	start := time.Now()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/object", nil))
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request waited %s for a slot, want about %s", elapsed, limiter.wait)
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "3" {
+		t.Errorf("response = %d, Retry-After %q, want 503 and 3", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	background := make(chan error, 1)
+	go func() {
+		resp, err := client.Get(server.URL + "/fast")
+		if err == nil {
+			resp.Body.Close()
+		}
+		background <- err
+	}()
+	select {
+	case err := <-background:
+		t.Fatalf("background call returned %v while the slot was still held", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	<-slowDone
+	if err := <-background; err != nil {
+		t.Errorf("background call = %v, want success once the slot is free", err)
+	}
+}
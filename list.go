@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/gin-gonic/gin"
+)
+
+// /list 支持的排序方式，前缀 "-" 表示降序
+var listSortOrders = map[string]bool{
+	"key": true, "-key": true,
+	"modified": true, "-modified": true,
+	"size": true, "-size": true,
+}
+
+// 按指定方式对列举结果排序
+// OSS 只按对象名字典序返回结果，按其他字段排序必须先把结果缓存在内存里（全量列举时是整个结果集），
+// 所以对象很多时按 modified/size 排序会占用更多内存
+func sortObjects(objects []oss.ObjectProperties, order string) error {
+	if !listSortOrders[order] {
+		return fmt.Errorf("invalid sort order %q", order)
+	}
+	desc := order[0] == '-'
+	field := order
+	if desc {
+		field = order[1:]
+	}
+	less := func(a, b oss.ObjectProperties) bool {
+		switch field {
+		case "modified":
+			if !a.LastModified.Equal(b.LastModified) {
+				return a.LastModified.Before(b.LastModified)
+			}
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		}
+		return a.Key < b.Key
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		if desc {
+			return less(objects[j], objects[i])
+		}
+		return less(objects[i], objects[j])
+	})
+	return nil
+}
+
+// 所有列举类接口统一的分页结构：items 为本页结果，nextMarker 非空且 isTruncated 为 true 时带上它继续请求下一页
+// 各接口可以在返回的 gin.H 上追加自己的字段
+func listEnvelope[T any](items []T, nextMarker string, truncated bool) gin.H {
+	if items == nil {
+		items = []T{}
+	}
+	return gin.H{
+		"items":       items,
+		"nextMarker":  nextMarker,
+		"isTruncated": truncated,
+		"count":       len(items),
+	}
+}
+
+// objectInfo 列举结果中单个对象的信息
+type objectInfo struct {
+	Key          string       `json:"key"`
+	Size         int64        `json:"size"`
+	LastModified time.Time    `json:"lastModified"`
+	ETag         string       `json:"etag"`
+	StorageClass string       `json:"storageClass,omitempty"`
+	Owner        *objectOwner `json:"owner,omitempty"`
+}
+
+type objectOwner struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+func toObjectInfo(p oss.ObjectProperties) objectInfo {
+	info := objectInfo{
+		Key:          p.Key,
+		Size:         p.Size,
+		LastModified: p.LastModified,
+		ETag:         normalizeETag(p.ETag),
+		StorageClass: p.StorageClass,
+	}
+	if p.Owner.ID != "" {
+		info.Owner = &objectOwner{ID: p.Owner.ID, DisplayName: p.Owner.DisplayName}
+	}
+	return info
+}
+
+// sizeFilter 按对象大小过滤列举结果，未设置的边界为 -1
+type sizeFilter struct {
+	min, max int64
+}
+
+func parseSizeFilter(minValue, maxValue string) (sizeFilter, error) {
+	f := sizeFilter{min: -1, max: -1}
+	for _, bound := range []struct {
+		name, value string
+		dst         *int64
+	}{{"minSize", minValue, &f.min}, {"maxSize", maxValue, &f.max}} {
+		if bound.value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(bound.value, 10, 64)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("%s must be a non-negative integer, got %q", bound.name, bound.value)
+		}
+		*bound.dst = n
+	}
+	if f.min >= 0 && f.max >= 0 && f.min > f.max {
+		return f, fmt.Errorf("minSize must not exceed maxSize")
+	}
+	return f, nil
+}
+
+func (f sizeFilter) match(size int64) bool {
+	return (f.min < 0 || size >= f.min) && (f.max < 0 || size <= f.max)
+}
+
+// 目录标记：以 "/" 结尾的 0 字节对象，由控制台或客户端创建，用来表示一个"文件夹"
+func isDirectoryMarker(object oss.ObjectProperties) bool {
+	return strings.HasSuffix(object.Key, "/") && object.Size == 0
+}
+
+// 以 "/" 结尾的对象名只能是目录（或目录标记），不能当作文件下载
+func isDirectoryKey(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+// listPage 一页列举结果，ListObjects 和 ListObjectsV2 的返回统一成同一结构
+type listPage struct {
+	objects   []oss.ObjectProperties
+	prefixes  []string
+	next      string // V1 的 NextMarker 或 V2 的 NextContinuationToken
+	truncated bool
+}
+
+// objectLister 按配置选择列举接口：
+// V1 的 ListObjects 用 marker 分页；V2 的 ListObjectsV2 用 continuation token 分页，并通过 fetch-owner 返回对象的所有者
+// cache 不为 nil 时每一页结果按 (prefix, delimiter, token) 缓存
+type objectLister struct {
+	bucket *oss.Bucket
+	useV2  bool
+	cache  *listCache
+}
+
+// 获取一页结果，token 为上一页返回的 next，第一页传空字符串；hit 表示结果来自缓存
+func (l objectLister) page(prefix, delimiter, token string) (page listPage, hit bool, err error) {
+	return l.pageAfter(prefix, delimiter, "", token)
+}
+
+// 与 page 相同，但第一页从 start 之后（不含 start）开始；extra 为附加的请求选项，例如 oss.WithContext
+func (l objectLister) pageAfter(prefix, delimiter, start, token string, extra ...oss.Option) (page listPage, hit bool, err error) {
+	key := listCacheKey{prefix: prefix, delimiter: delimiter, start: start, token: token}
+	if page, ok := l.cache.get(key); ok {
+		return page, true, nil
+	}
+	options := append([]oss.Option{oss.Prefix(prefix), oss.Delimiter(delimiter)}, extra...)
+	if l.useV2 {
+		options = append(options, oss.FetchOwner(true))
+		if token != "" {
+			options = append(options, oss.ContinuationToken(token))
+		} else if start != "" {
+			options = append(options, oss.StartAfter(start))
+		}
+		res, err := l.bucket.ListObjectsV2(options...)
+		if err != nil {
+			return listPage{}, false, err
+		}
+		page = listPage{res.Objects, res.CommonPrefixes, res.NextContinuationToken, res.IsTruncated}
+	} else {
+		if token == "" {
+			token = start
+		}
+		options = append(options, oss.Marker(token))
+		res, err := l.bucket.ListObjects(options...)
+		if err != nil {
+			return listPage{}, false, err
+		}
+		page = listPage{res.Objects, res.CommonPrefixes, res.NextMarker, res.IsTruncated}
+	}
+	l.cache.put(key, page)
+	return page, false, nil
+}
+
+// 带截止时间获取一页：截止时间前没有返回时取消仍在进行的请求，timedOut 为 true
+// deadline 为零值时不设截止时间；调用方应让第一页不设截止时间，否则 OSS 较慢时每次请求都停在第一页，游标永远不会前进
+func (l objectLister) pageBefore(deadline time.Time, prefix, delimiter, token string) (page listPage, hit, timedOut bool, err error) {
+	if deadline.IsZero() {
+		page, hit, err = l.page(prefix, delimiter, token)
+		return page, hit, false, err
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	page, hit, err = l.pageAfter(prefix, delimiter, "", token, oss.WithContext(ctx))
+	if err != nil && ctx.Err() != nil {
+		return listPage{}, false, true, nil
+	}
+	return page, hit, false, err
+}
+
+// 分区并行列举的默认分界：按对象名（去掉 prefix 后）的首字符划分
+var defaultListPartitions = strings.Split("0,1,2,3,4,5,6,7,8,9,A,B,C,D,E,F,G,H,I,J,K,L,M,N,O,P,Q,R,S,T,U,V,W,X,Y,Z,"+
+	"a,b,c,d,e,f,g,h,i,j,k,l,m,n,o,p,q,r,s,t,u,v,w,x,y,z", ",")
+
+// 把 prefix 下的键空间按分界点切成互不重叠的区间，由 workers 个 goroutine 并行列举
+// 分界点 b1 < b2 < ... 对应区间 [开头, b1]、(b1, b2]、...、(bn, 结尾)，每个区间用 marker/start-after 从左端开始列举，
+// 越过右端即停止；合并时按区间顺序拼接，结果与顺序列举一样按对象名排序
+// 只有对象名能被分界点大致均匀地分开时才会变快，集中在一个区间里的对象仍然是逐页顺序列举的
+func listPartitioned(l objectLister, prefix string, boundaries []string, workers int) (pages []listPage, hits, misses int, err error) {
+	points := make([]string, 0, len(boundaries))
+	for _, b := range boundaries {
+		if b != "" {
+			points = append(points, prefix+b)
+		}
+	}
+	sort.Strings(points)
+	points = slices.Compact(points)
+
+	type result struct {
+		pages        []listPage
+		hits, misses int
+		err          error
+	}
+	results := make([]result, len(points)+1)
+	ranges := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ranges {
+				start, end := "", ""
+				if i > 0 {
+					start = points[i-1]
+				}
+				if i < len(points) {
+					end = points[i]
+				}
+				r := &results[i]
+				r.pages, r.hits, r.misses, r.err = listRange(l, prefix, start, end)
+			}
+		}()
+	}
+	for i := range results {
+		ranges <- i
+	}
+	close(ranges)
+	wg.Wait()
+
+	for _, r := range results {
+		if r.err != nil {
+			return nil, 0, 0, r.err
+		}
+		pages = append(pages, r.pages...)
+		hits += r.hits
+		misses += r.misses
+	}
+	return pages, hits, misses, nil
+}
+
+// 列举 (start, end] 区间内的对象，end 为空表示直到结尾；最后一页中超出 end 的对象会被去掉
+func listRange(l objectLister, prefix, start, end string) (pages []listPage, hits, misses int, err error) {
+	token := ""
+	for {
+		page, hit, err := l.pageAfter(prefix, "", start, token)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if hit {
+			hits++
+		} else {
+			misses++
+		}
+		done := !page.truncated
+		if end != "" {
+			n := sort.Search(len(page.objects), func(i int) bool { return page.objects[i].Key > end })
+			if n < len(page.objects) {
+				page.objects = page.objects[:n]
+				done = true
+			}
+		}
+		pages = append(pages, page)
+		if done {
+			return pages, hits, misses, nil
+		}
+		token = page.next
+	}
+}
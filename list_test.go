@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 截止时间到达时取消仍在进行的列举请求，而不是留在后台继续执行
+func TestPageBeforeCancelsAtDeadline(t *testing.T) {
+	fake := newFakeOSS(t)
+	fake.put("a.txt", []byte("a"), nil)
+	canceled := make(chan struct{}, 1)
+	fake.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/test") {
+			return true
+		}
+		select {
+		case <-time.After(2 * time.Second):
+			return true
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+			return false
+		}
+	}
+	lister := objectLister{bucket: fake.bucket(t)}
+	start := time.Now()
+	_, _, timedOut, err := lister.pageBefore(time.Now().Add(50*time.Millisecond), "", "", "")
+	if err != nil || !timedOut {
+		t.Fatalf("pageBefore() timedOut = %v, err = %v, want a timeout", timedOut, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("pageBefore() returned after %s, want about 50ms", elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("list request was not canceled at the deadline")
+	}
+}
+
+func TestPageBeforeWithoutDeadline(t *testing.T) {
+	fake := newFakeOSS(t)
+	fake.put("a.txt", []byte("a"), nil)
+	fake.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		time.Sleep(100 * time.Millisecond)
+		return true
+	}
+	lister := objectLister{bucket: fake.bucket(t)}
+	page, _, timedOut, err := lister.pageBefore(time.Time{}, "", "", "")
+	if err != nil || timedOut {
+		t.Fatalf("pageBefore() timedOut = %v, err = %v", timedOut, err)
+	}
+	if len(page.objects) != 1 || page.objects[0].Key != "a.txt" {
+		t.Errorf("pageBefore() objects = %+v, want a.txt", page.objects)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// listCacheKey 一页列举结果的缓存键，start 为分区列举时的起始位置
+type listCacheKey struct {
+	prefix, delimiter, start, token string
+}
+
+type listCacheEntry struct {
+	page    listPage
+	created time.Time
+}
+
+// listCache 短时间缓存列举结果，文件浏览界面反复列举同一个前缀时不必每次都请求 OSS
+// 通过本服务上传、删除对象时会立即清除受影响前缀的缓存；其他途径的修改要等 TTL 过期才可见
+type listCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[listCacheKey]listCacheEntry
+}
+
+// ttl 为 0 时返回 nil，nil 的缓存所有查询都视为未命中
+func newListCache(ttl time.Duration, maxEntries int) *listCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &listCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[listCacheKey]listCacheEntry),
+	}
+}
+
+func (lc *listCache) get(key listCacheKey) (listPage, bool) {
+	if lc == nil {
+		return listPage{}, false
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	entry, ok := lc.entries[key]
+	if !ok {
+		return listPage{}, false
+	}
+	if time.Since(entry.created) > lc.ttl {
+		delete(lc.entries, key)
+		return listPage{}, false
+	}
+	return entry.page, true
+}
+
+// 缓存已满时先清理过期条目，仍然满则淘汰最早写入的条目
+func (lc *listCache) put(key listCacheKey, page listPage) {
+	if lc == nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if _, ok := lc.entries[key]; !ok && len(lc.entries) >= lc.maxEntries {
+		var oldestKey listCacheKey
+		var oldest time.Time
+		for k, entry := range lc.entries {
+			if time.Since(entry.created) > lc.ttl {
+				delete(lc.entries, k)
+				continue
+			}
+			if oldest.IsZero() || entry.created.Before(oldest) {
+				oldestKey, oldest = k, entry.created
+			}
+		}
+		if len(lc.entries) >= lc.maxEntries {
+			delete(lc.entries, oldestKey)
+		}
+	}
+	lc.entries[key] = listCacheEntry{page: page, created: time.Now()}
+}
+
+// 对象 key 发生变化后，清除所有可能包含它的列举结果（缓存前缀是 key 的前缀）
+func (lc *listCache) invalidate(key string) {
+	lc.invalidateWhere(func(k listCacheKey) bool {
+		return strings.HasPrefix(key, k.prefix)
+	})
+}
+
+// 按前缀批量删除后，除了包含该前缀的列举，更深层前缀的列举也都失效
+func (lc *listCache) invalidatePrefix(prefix string) {
+	lc.invalidateWhere(func(k listCacheKey) bool {
+		return strings.HasPrefix(prefix, k.prefix) || strings.HasPrefix(k.prefix, prefix)
+	})
+}
+
+func (lc *listCache) invalidateWhere(match func(listCacheKey) bool) {
+	if lc == nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	for k := range lc.entries {
+		if match(k) {
+			delete(lc.entries, k)
+		}
+	}
+}
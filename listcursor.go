@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 当前的游标格式版本，格式变化时递增，旧版本的游标返回 400 而不是被误解析
+const listCursorVersion = 1
+
+var (
+	errMalformedCursor = errors.New("malformed cursor")
+	errExpiredCursor   = errors.New("cursor has expired, restart the listing")
+)
+
+// listCursor /list 返回给客户端的续传游标，编码为 base64 的 JSON，客户端只需原样传回
+// 除了 OSS 的分页标记外还记录了列举参数，续传时沿用游标中的参数，客户端不必（也不能）再传一遍
+// 游标不做签名：篡改只会得到另一个合法的列举请求，不会越过其他接口已有的检查
+type listCursor struct {
+	Version   int    `json:"v"`
+	V2        bool   `json:"v2,omitempty"` // 分页标记来自 ListObjectsV2，与 V1 的 marker 不能混用
+	Token     string `json:"t"`
+	Prefix    string `json:"p,omitempty"`
+	Delimiter string `json:"d,omitempty"`
+	Sort      string `json:"s,omitempty"`
+	MinSize   int64  `json:"min"`
+	MaxSize   int64  `json:"max"`
+	IssuedAt  int64  `json:"iat"`
+}
+
+func (c listCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func (c listCursor) sizes() sizeFilter {
+	return sizeFilter{min: c.MinSize, max: c.MaxSize}
+}
+
+// 解析客户端传回的游标；ttl 为 0 时不检查过期，useV2 为当前配置的列举接口
+func decodeListCursor(value string, ttl time.Duration, useV2 bool) (listCursor, error) {
+	var c listCursor
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(raw, &c) != nil {
+		return c, errMalformedCursor
+	}
+	if c.Version != listCursorVersion {
+		return c, fmt.Errorf("unsupported cursor version %d", c.Version)
+	}
+	if !listSortOrders[c.Sort] || c.MinSize < -1 || c.MaxSize < -1 {
+		return c, errMalformedCursor
+	}
+	if c.V2 != useV2 {
+		return c, errors.New("cursor was issued for a different listing API, restart the listing")
+	}
+	if ttl > 0 && time.Since(time.Unix(c.IssuedAt, 0)) > ttl {
+		return c, errExpiredCursor
+	}
+	return c, nil
+}
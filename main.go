@@ -1,279 +1,3664 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"math/rand"
 	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
-	// 自动创建 .env 文件（如果不存在的话）
-	createEnvFileIfNotExist()
-	// 加载 .env 文件中的环境变量
+	// 加载 .env 文件中的环境变量；已经在进程环境中设置的变量不会被覆盖
+	// 容器部署通常直接注入环境变量而没有 .env，加载失败时继续使用进程环境，缺少必填项时由 loadConfig 报告
+	// 不会自动生成带占位值的 .env：占位的访问密钥和存储桶名会绕过必填项检查，使服务连到不存在的存储桶
 	err := godotenv.Load(".env")
-	endpoint := os.Getenv("OSS_ENDPOINT")
-	accessKeyID := os.Getenv("OSS_ACCESS_KEY_ID")
-	accessKeySecret := os.Getenv("OSS_ACCESS_KEY_SECRET")
-	bucketName := os.Getenv("OSS_BUCKET_NAME")
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Printf("Could not load .env file (%v), using process environment only", err)
 	}
+	// 读取并校验全部配置，有问题时一次性列出后退出
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	// 收到 SIGINT/SIGTERM 时取消，HTTP 服务和后台清理任务据此退出
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// 转码任务配置：失败后按指数退避自动重试
+	transcodeOpts := transcodeOptions{
+		ffmpegPath:     cfg.FFmpegPath,
+		ffprobePath:    cfg.FFprobePath,
+		maxAttempts:    cfg.TranscodeMaxAttempts,
+		retryBackoff:   cfg.TranscodeRetryBackoff,
+		ffmpegTimeout:  cfg.FFmpegTimeout,
+		ffprobeTimeout: cfg.FFprobeTimeout,
+
+		thumbnailMaxBytes:  cfg.ThumbnailMaxSourceSize,
+		thumbnailMaxPixels: cfg.ThumbnailMaxPixels,
+	}
+	// 启动时检测 ffmpeg，不可用时音视频转码直接返回 501，图片仍可用纯 Go 处理
+	if path, err := exec.LookPath(transcodeOpts.ffmpegPath); err == nil {
+		transcodeOpts.ffmpegPath = path
+		transcodeOpts.ffmpegAvailable = true
+	} else {
+		log.Printf("ffmpeg not found (%v), audio/video transcoding is disabled", err)
+	}
+	if path, err := exec.LookPath(transcodeOpts.ffprobePath); err == nil {
+		transcodeOpts.ffprobePath = path
+		transcodeOpts.ffprobeAvailable = true
+	} else {
+		log.Printf("ffprobe not found (%v), preview ranges are not checked against the media duration", err)
+	}
+	// 转码在固定数量的 worker 中执行，排队的任务超过 TRANSCODE_QUEUE_SIZE 时返回 429
+	transcodes := newTranscodePool(cfg.TranscodeWorkers, cfg.TranscodeQueueSize)
+	// 上传成功后返回的对象地址配置
+	urlOpts := objectURLOptions{
+		endpoint:   cfg.Endpoint,
+		bucketName: cfg.BucketName,
+		cdnBaseURL: cfg.CDNBaseURL,
+		public:     cfg.BucketPublic,
+		expiry:     cfg.PresignExpiry,
+		maxExpiry:  cfg.PresignMaxExpiry,
+	}
+	// 下载时按存储的 Content-Type 选择 inline 或 attachment
+	inline := parseInlineTypes(cfg.InlineContentTypes)
+	charsets := parseInlineTypes(cfg.CharsetContentTypes)
+	// 字符集已在 validate 中校验过
+	randomCharset, _ := parseRandomCharset(cfg.RandomNameCharset)
+	filenames := filenameGenerator{template: cfg.DownloadFilenameTemplate, randomLength: cfg.RandomNameLength, randomCharset: randomCharset}
+	gzipOpts := downloadGzip{enabled: cfg.DownloadGzip, minSize: cfg.DownloadGzipMinSize, level: cfg.DownloadGzipLevel}
+	// 分片上传的分片大小配置
+	partOpts := partSizeOptions{
+		threshold:   cfg.MultipartThreshold,
+		minSize:     cfg.MultipartMinPartSize,
+		maxSize:     cfg.MultipartMaxPartSize,
+		defaultSize: cfg.MultipartDefaultPartSize,
+	}
+	// 配置了 OTEL_EXPORTER_OTLP_ENDPOINT 时启用 OpenTelemetry：每个 HTTP 请求一个 span，其中的每次 OSS 调用一个子 span
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		log.Fatal("Failed to initialize tracing: ", err)
+	}
+	// 所有 OSS 客户端共用同一份可替换的访问密钥，POST /admin/rotate-credentials 替换后立即生效
+	credentials := newRotatingCredentials(cfg.AccessKeyID, cfg.AccessKeySecret)
+	clientOptions := append(cfg.clientOptions(), oss.SetCredentialsProvider(credentials))
+	// 备用地域的客户端不经过熔断器，主地域故障时仍可用于故障转移
+	failoverOptions := append(cfg.clientOptions(), oss.SetCredentialsProvider(credentials))
+	if tracingEnabled() {
+		failoverOptions = append(failoverOptions, oss.HTTPClient(ossHTTPClient(cfg, nil, nil, nil)))
+	}
+	// OSS 连续失败 OSS_BREAKER_THRESHOLD 次后熔断 OSS_BREAKER_COOLDOWN，期间请求直接返回 503
+	breaker := newOSSBreaker(cfg.OSSBreakerThreshold, cfg.OSSBreakerCooldown)
+	clientBreaker := breaker
+	if !breaker.enabled() {
+		clientBreaker = nil
+	}
+	// OSS 限流时按 Retry-After 退避重试，并在 OSS_THROTTLE_WINDOW 内把并发收紧到 OSS_THROTTLE_CONCURRENCY
+	throttle := newOSSThrottle(cfg.OSSThrottleRetries, cfg.OSSThrottleBackoff, cfg.OSSThrottleWindow, cfg.OSSThrottleConcurrency)
+	// 限制同时进行的 OSS 读、写请求数量，所有经过主客户端的调用（包括后台任务）都占用名额；请求入口名额耗尽时返回 503
+	limiter := newOSSLimiter(cfg.OSSMaxReadConcurrency, cfg.OSSMaxWriteConcurrency, cfg.OSSAcquireTimeout, cfg.OSSRetryAfter)
+	clientOptions = append(clientOptions, oss.HTTPClient(ossHTTPClient(cfg, clientBreaker, throttle, limiter)))
 	// region := "oss-cn-hangzhou"
-	client, err := oss.New(endpoint, accessKeyID, accessKeySecret)
+	client, err := oss.New(cfg.Endpoint, cfg.AccessKeyID, cfg.AccessKeySecret, clientOptions...)
 	if err != nil {
 		log.Fatal("Failed to create OSS client: ", err)
 	}
 	// 获取 Bucket 对象
-	bucket, err := client.Bucket(bucketName)
+	bucket, err := client.Bucket(cfg.BucketName)
 	if err != nil {
 		log.Fatal("Failed to get bucket: ", err)
 	}
+	// X-OSS-Bucket 可选择的其他存储桶
+	buckets, err := newBucketSet(client, bucket, parseBucketNames(cfg.AllowedBuckets))
+	if err != nil {
+		log.Fatal("Failed to get allowed buckets: ", err)
+	}
+	// /download 和 /meta 的读故障转移，配置了 OSS_FAILOVER_ENDPOINT 时启用
+	reads := &failoverReads{primary: bucket, primaryRegion: cfg.Endpoint}
+	if cfg.FailoverEndpoint != "" {
+		failoverClient, err := oss.New(cfg.FailoverEndpoint, cfg.AccessKeyID, cfg.AccessKeySecret, failoverOptions...)
+		if err != nil {
+			log.Fatal("Failed to create failover OSS client: ", err)
+		}
+		if reads.secondary, err = failoverClient.Bucket(cfg.FailoverBucketName); err != nil {
+			log.Fatal("Failed to get failover bucket: ", err)
+		}
+		reads.secondaryRegion = cfg.FailoverEndpoint
+		// 熔断时这两个接口仍可由备用地域返回
+		breaker.skip("/download/:object", "/files/*object", "/meta/:object")
+	}
+	// 设置了 MULTIPART_SWEEP_INTERVAL 时定期取消 MULTIPART_SWEEP_PREFIX 下超过 MULTIPART_UPLOAD_TTL 仍未完成的分片上传
+	startUploadSweeper(ctx, bucket, cfg.MultipartSweepPrefix, cfg.MultipartUploadTTL, cfg.MultipartSweepInterval)
+	// 通过 /multipart/presign 发起的上传超过 MULTIPART_UPLOAD_TTL 仍未完成时自动取消
+	uploads := newUploadTracker(cfg.MultipartUploadTTL)
+	uploads.start(ctx)
+	// 下载的本地磁盘缓存，DOWNLOAD_CACHE_DIR 为空时不启用
+	cache, err := newDownloadCache(cfg.DownloadCacheDir, cfg.DownloadCacheMaxSize)
+	if err != nil {
+		log.Fatal("Failed to initialize download cache: ", err)
+	}
+	// 列举接口，LIST_USE_V2 开启时使用 ListObjectsV2；LIST_CACHE_TTL 大于 0 时短时间缓存列举结果
+	listings := newListCache(cfg.ListCacheTTL, cfg.ListCacheMaxEntries)
+	lister := objectLister{bucket: bucket, useV2: cfg.ListUseV2, cache: listings}
+	// 上传、删除成功后异步推送 webhook 事件
+	// 出站请求（webhook 等）的目标限制，默认禁止访问内网地址
+	outbound, err := newOutboundPolicy(cfg)
+	if err != nil {
+		log.Fatal("Invalid outbound policy: ", err)
+	}
+	webhooks, err := newWebhookNotifier(cfg, outbound)
+	if err != nil {
+		log.Fatal("Invalid webhook configuration: ", err)
+	}
+	// 上传的 Idempotency-Key 记录，IDEMPOTENCY_WINDOW 为 0 时不启用
+	idempotency := newIdempotencyStore(cfg.IdempotencyWindow, cfg.IdempotencyMaxEntries)
+	// 定期删除上传时指定了 ttl 且已到期的对象
+	startExpirySweeper(ctx, bucket, cfg.ObjectTTLIndexPrefix, cfg.ObjectTTLSweepInterval, func(key string) {
+		listings.invalidate(key)
+		webhooks.notify(EventDelete, key, 0)
+	})
+	// 服务自身使用的前缀（回收站、过期索引、清单），扫描存储桶内容时跳过
+	internalPrefixes := []string{cfg.TrashPrefix, cfg.ObjectTTLIndexPrefix, cfg.ManifestPrefix}
+	// 定期删除源对象已不存在的缩略图、转码结果
+	derivedPatterns, _ := parseDerivedPatterns(cfg.DerivedKeyPatterns)
+	derivedDeleted := func(key, trashed string) {
+		listings.invalidate(key)
+		cache.purge(key)
+		if trashed != "" {
+			listings.invalidate(trashed)
+		}
+		webhooks.notify(EventDelete, key, 0)
+	}
+	// 开启软删除时孤立的派生对象同样移到回收站
+	derivedTrash := ""
+	if cfg.SoftDelete {
+		derivedTrash = cfg.TrashPrefix
+	}
+	startDerivedSweeper(ctx, bucket, derivedPatterns, internalPrefixes, cfg.DerivedSweepInterval, derivedTrash, derivedDeleted)
+	// 异步任务记录，可通过 JOB_STORE 选择持久化到本地文件或 OSS 对象，重启后仍可查询
+	jobPersistence, err := newJobBackend(cfg.JobStore, cfg.JobStorePath, cfg.JobStoreKey, bucket)
+	if err != nil {
+		log.Fatal("Invalid job store: ", err)
+	}
+	jobs, err := newJobStore(jobPersistence, cfg.JobRetention, cfg.JobMaxFinished)
+	if err != nil {
+		log.Fatal("Failed to load job store: ", err)
+	}
+	confirmations := newConfirmationStore(cfg.ConfirmationTTL)
+	downloadSessions := newDownloadSessionStore(cfg.DownloadSessionTTL)
+	usage := newUsageCache(cfg.UsageCacheTTL)
 
 	// 创建一个默认的 Gin 路由引擎
 	r := gin.Default()
+	r.MaxMultipartMemory = cfg.MaxMultipartMemory
+	// 按原始（未解码）路径匹配路由，再对参数做一次 URL 解码：对象名中的 "/" 编码为 %2F 后不会被当成路径分隔符，
+	// "+" 在路径中始终是字面的加号，"%25" 解码为 "%"，因此已经编码过的对象名只需按路径规则再编码一次即可原样往返
+	// 注意查询参数（例如 /list 的 prefix）按表单规则解码，其中的 "+" 表示空格，字面的加号需要写成 %2B
+	// gin 对参数的解码会把 "+" 变成空格，因此服务时用 literalPlusPath 包装路由
+	r.UseRawPath = true
+	// 从请求头中提取上游的 trace context，未启用追踪时不做任何事
+	if tracingEnabled() {
+		r.Use(otelgin.Middleware(tracingServiceName))
+	}
+	// OSS 读、写名额耗尽时直接返回 503
+	limiter.skip("/", "/metrics", "/healthz", "/jobs/:id", "/debug/config")
+	r.Use(limiter.middleware())
+	breaker.skip("/", "/metrics", "/healthz", "/jobs/:id", "/debug/config")
+	r.Use(breaker.middleware())
+	// 对象相关的接口按 X-OSS-Bucket 选择存储桶
+	r.Use(buckets.middleware())
 
 	// 定义一个 GET 路由
 	r.GET("/", func(c *gin.Context) {
-		c.JSON(200, gin.H{
+		respond(c, 200, gin.H{
 			"message": "Hello, Gin!",
 		})
 	})
 
+	// 运行时指标，目前包括 OSS 并发名额的使用情况、熔断器状态、OSS 限流情况和转码队列
+	r.GET("/metrics", func(c *gin.Context) {
+		respond(c, 200, gin.H{
+			"ossConcurrency": limiter.stats(),
+			"ossBreaker":     breaker.stats(),
+			"ossThrottling":  throttle.stats(),
+			"transcodeQueue": transcodes.stats(),
+		})
+	})
+	// 健康检查：OSS 熔断器打开时返回 503，负载均衡可据此暂时摘除实例
+	r.GET("/healthz", func(c *gin.Context) {
+		stats := breaker.stats()
+		if stats["state"] == BreakerOpen {
+			respond(c, http.StatusServiceUnavailable, gin.H{"status": "unavailable", "ossBreaker": stats})
+			return
+		}
+		respond(c, 200, gin.H{"status": "ok", "ossBreaker": stats})
+	})
+
+	// 查看最终生效的配置及每项的来源（环境变量或默认值），密钥只显示最后 4 个字符
+	r.GET("/debug/config", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		respond(c, 200, gin.H{
+			"config": cfg.redactedEntries(),
+		})
+	})
+
+	// 为存储桶（或 prefix 下的对象）生成 NDJSON 清单并上传到 MANIFEST_PREFIX 下，耗时较长，作为后台任务执行
+	// 下面的管理任务都作用于 X-OSS-Bucket 选择的存储桶，报告也写入该存储桶
+	r.POST("/admin/manifest", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		prefix := formOrQuery(c, "prefix")
+		key := manifestKey(cfg.ManifestPrefix, time.Now())
+		job := jobs.create("manifest", prefix)
+		go runManifestJob(bucket, jobs, job.ID, prefix, cfg.ManifestPrefix, key)
+		respond(c, 202, gin.H{
+			"message": "manifest job accepted",
+			"jobId":   job.ID,
+			"key":     key,
+		})
+	})
+
+	// 把 prefix 下的对象导出为 tar 卷，用于整体备份；在后台执行，返回 202 和任务 ID，通过 /jobs/:id 查看进度
+	// 先生成清单，再按清单顺序写入 MANIFEST_PREFIX/exports/ 下的各个卷（每卷约 EXPORT_VOLUME_SIZE），读取速率不超过 EXPORT_BANDWIDTH
+	// 无法读取的对象跳过并记录在报告中；任务失败后带上报错中的 manifest 和 offset 重新提交即可从未完成的卷继续
+	r.POST("/export", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		var req struct {
+			Prefix   string `json:"prefix"`
+			Manifest string `json:"manifest"`
+			Offset   int    `json:"offset"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{"status": "error", "message": "Invalid request body: " + err.Error()})
+			return
+		}
+		switch {
+		case req.Offset < 0:
+			respond(c, 400, gin.H{"status": "error", "message": "offset must not be negative"})
+			return
+		case req.Manifest == "" && req.Offset > 0:
+			respond(c, 400, gin.H{"status": "error", "message": "offset requires manifest"})
+			return
+		case req.Manifest != "" && !strings.HasPrefix(req.Manifest, cfg.ManifestPrefix):
+			respond(c, 400, gin.H{"status": "error", "message": fmt.Sprintf("manifest must be under %s", cfg.ManifestPrefix)})
+			return
+		}
+		base := exportBaseKey(cfg.ManifestPrefix, time.Now())
+		input := req.Prefix
+		if req.Manifest != "" {
+			input = fmt.Sprintf("%s@%d", req.Manifest, req.Offset)
+		}
+		job := jobs.create("export", input)
+		go runExportJob(bucket, jobs, job.ID, req.Prefix, req.Manifest, req.Offset, base, exportOptions{
+			volumeSize:     cfg.ExportVolumeSize,
+			bandwidth:      cfg.ExportBandwidth,
+			parts:          partOpts,
+			manifestPrefix: cfg.ManifestPrefix,
+		})
+		respond(c, 202, gin.H{
+			"message": "export job accepted",
+			"jobId":   job.ID,
+			"key":     base + ".json",
+		})
+	})
+
+	// 手动清理孤立的派生对象，dryRun=true 时只统计；prefix 限定扫描范围，源对象不在 prefix 下也能正确判断
+	r.POST("/admin/derived/sweep", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		dryRun := formOrQuery(c, "dryRun") == "true"
+		result, err := sweepDerivedObjects(bucket, derivedPatterns, formOrQuery(c, "prefix"), internalPrefixes, dryRun, derivedTrash, derivedDeleted)
+		if err != nil {
+			log.Printf("Failed to sweep derived objects after deleting %d: %v", result.Deleted, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to sweep derived objects: %s", err.Error()),
+				"result":  result,
+			})
+			return
+		}
+		respond(c, 200, gin.H{
+			"status": "success",
+			"dryRun": dryRun,
+			"result": result,
+		})
+	})
+
+	// 按内容摘要查找重复对象：不带 jobId 时启动后台扫描（prefix 限定范围），返回 202 和任务 ID；
+	// 带上 jobId 时返回该任务生成的报告，任务未完成时返回任务状态；报告在扫描的存储桶中，需带上启动扫描时的 X-OSS-Bucket
+	r.GET("/admin/duplicates", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		if id := c.Query("jobId"); id != "" {
+			job, ok := jobs.get(id)
+			if !ok || job.Type != "duplicates" {
+				respond(c, 404, gin.H{"status": "error", "message": fmt.Sprintf("Duplicates job '%s' not found", id)})
+				return
+			}
+			if job.Status != JobSucceeded {
+				respond(c, 200, gin.H{"status": job.Status, "job": job})
+				return
+			}
+			body, err := bucket.GetObject(job.Output, ossCtx(c))
+			if err != nil {
+				if isNoSuchKey(err) {
+					respond(c, 404, gin.H{
+						"status":  "error",
+						"message": fmt.Sprintf("Duplicates report '%s' not found in bucket '%s'", job.Output, bucket.BucketName),
+					})
+					return
+				}
+				log.Printf("Failed to read duplicates report %s: %v", job.Output, err)
+				respond(c, 500, gin.H{"status": "error", "message": "Failed to read duplicates report"})
+				return
+			}
+			defer body.Close()
+			var report duplicateReport
+			if err := json.NewDecoder(body).Decode(&report); err != nil {
+				respond(c, 500, gin.H{"status": "error", "message": "Failed to read duplicates report"})
+				return
+			}
+			resp := listEnvelope(report.Groups, "", false)
+			resp["status"] = job.Status
+			resp["key"] = job.Output
+			// 保留原来的 report 字段，已有的客户端不受统一分页结构影响
+			resp["report"] = report
+			resp["prefix"] = report.Prefix
+			resp["scanned"] = report.Scanned
+			resp["unhashed"] = report.Unhashed
+			resp["reclaimable"] = report.Reclaimable
+			respond(c, 200, resp)
+			return
+		}
+		prefix := c.Query("prefix")
+		key := duplicatesReportKey(cfg.ManifestPrefix, time.Now())
+		job := jobs.create("duplicates", prefix)
+		go runDuplicatesJob(bucket, jobs, job.ID, prefix, internalPrefixes, key)
+		respond(c, 202, gin.H{
+			"message": "duplicates job accepted",
+			"jobId":   job.ID,
+			"key":     key,
+		})
+	})
+
+	// 修复缺失的元数据：重新识别缺失的 Content-Type，补充缺失的 SHA-256 校验值；prefix 限定范围，
+	// dryRun=true 时只报告将要修改的对象；在后台执行，返回 202 和任务 ID，报告写入 manifest 前缀下
+	r.POST("/admin/repair-metadata", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		prefix := formOrQuery(c, "prefix")
+		dryRun := formOrQuery(c, "dryRun") == "true"
+		key := repairReportKey(cfg.ManifestPrefix, time.Now())
+		job := jobs.create("repair-metadata", prefix)
+		go runRepairMetadataJob(bucket, jobs, job.ID, prefix, internalPrefixes, dryRun, key, listings.invalidate)
+		respond(c, 202, gin.H{
+			"message": "repair-metadata job accepted",
+			"jobId":   job.ID,
+			"dryRun":  dryRun,
+			"key":     key,
+		})
+	})
+
+	// 运行时替换 OSS 访问密钥，不需要重启：新密钥先对主存储桶（以及配置了的备用地域存储桶）调用一次 GetBucketInfo，
+	// 全部成功后才替换，之后发起的 OSS 请求使用新密钥；验证失败时返回 400，继续使用原来的密钥
+	// 替换只保存在内存中，重启后仍使用 OSS_ACCESS_KEY_ID / OSS_ACCESS_KEY_SECRET，需同步更新部署配置
+	r.POST("/admin/rotate-credentials", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		var req struct {
+			AccessKeyID     string `json:"accessKeyId" binding:"required"`
+			AccessKeySecret string `json:"accessKeySecret" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		targets := []credentialTarget{{cfg.Endpoint, cfg.BucketName}}
+		if cfg.FailoverEndpoint != "" {
+			targets = append(targets, credentialTarget{cfg.FailoverEndpoint, cfg.FailoverBucketName})
+		}
+		// 错误信息中不包含密钥，只记录 AccessKeyId 的最后 4 个字符
+		if err := credentials.rotate(req.AccessKeyID, req.AccessKeySecret, targets, cfg.clientOptions()...); err != nil {
+			log.Printf("Rejected credential rotation to accessKeyId=%s: %v", redactSecret(req.AccessKeyID), err)
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Credentials were not rotated: %s", err.Error()),
+			})
+			return
+		}
+		log.Printf("Rotated OSS credentials to accessKeyId=%s", redactSecret(req.AccessKeyID))
+		respond(c, 200, gin.H{
+			"status":      "success",
+			"message":     "Credentials rotated",
+			"accessKeyId": redactSecret(req.AccessKeyID),
+		})
+	})
+
+	// 查询存储桶实际所在的地域和 endpoint，与配置的 OSS_ENDPOINT 对照，用于排查 endpoint 配置错误
+	r.GET("/admin/bucket-info", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		res, err := client.GetBucketInfo(cfg.BucketName, ossCtx(c))
+		if err != nil {
+			// endpoint 与存储桶地域不一致时 OSS 拒绝请求，并在错误中给出应该使用的 endpoint
+			if ossErr, ok := asServiceError(err); ok && ossErr.Endpoint != "" {
+				respond(c, http.StatusBadGateway, gin.H{
+					"status":             "error",
+					"message":            fmt.Sprintf("Bucket '%s' must be accessed through endpoint '%s', but OSS_ENDPOINT is '%s'", cfg.BucketName, ossErr.Endpoint, cfg.Endpoint),
+					"configuredEndpoint": cfg.Endpoint,
+					"bucketEndpoint":     ossErr.Endpoint,
+				})
+				return
+			}
+			log.Printf("Failed to get bucket info: %v", err)
+			respond(c, http.StatusBadGateway, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to get bucket info: %s", err.Error()),
+			})
+			return
+		}
+		info := res.BucketInfo
+		// 配置的 endpoint 去掉协议后应与外网或内网 endpoint 一致；使用自定义域名时会显示为不一致
+		configured := strings.TrimPrefix(strings.TrimPrefix(cfg.Endpoint, "https://"), "http://")
+		respond(c, 200, gin.H{
+			"status":             "success",
+			"name":               info.Name,
+			"location":           info.Location,
+			"creationDate":       info.CreationDate,
+			"storageClass":       info.StorageClass,
+			"redundancyType":     info.RedundancyType,
+			"acl":                info.ACL,
+			"versioning":         info.Versioning,
+			"extranetEndpoint":   info.ExtranetEndpoint,
+			"intranetEndpoint":   info.IntranetEndpoint,
+			"configuredEndpoint": cfg.Endpoint,
+			"endpointMatches":    configured == info.ExtranetEndpoint || configured == info.IntranetEndpoint,
+		})
+	})
+
 	// 定义一个带参数的 GET 路由
 	r.GET("/isexist/:name", func(c *gin.Context) {
+		bucket := buckets.of(c)
 		name := c.Param("name") // 获取 URL 路径参数
-		_, err := bucket.GetObjectMeta(name)
+		_, err := bucket.GetObjectMeta(name, ossCtx(c))
 		if err != nil {
-			if ossError, ok := err.(*oss.ServiceError); ok {
+			// SDK 返回的是 oss.ServiceError 值而不是指针，需要用 asServiceError 判断
+			if ossError, ok := asServiceError(err); ok {
 				// 如果是 404 错误，表示对象不存在
-				if ossError.Code == "NoSuchKey" {
-					c.JSON(http.StatusOK, gin.H{
+				if isNoSuchKey(err) {
+					respond(c, http.StatusOK, gin.H{
 						"message": fmt.Sprintf("Object '%s' does not exist", name),
 					})
 				} else {
 					// 其他错误
-					c.JSON(http.StatusInternalServerError, gin.H{
+					respond(c, http.StatusInternalServerError, gin.H{
 						"message": "Error checking object: " + ossError.Message,
 					})
 				}
 			} else {
 				// 如果出现非 OSS 错误
-				c.JSON(http.StatusInternalServerError, gin.H{
+				respond(c, http.StatusInternalServerError, gin.H{
 					"message": "Error: " + err.Error(),
 				})
 			}
 		} else {
 			// 如果没有错误，表示对象存在
-			c.JSON(http.StatusOK, gin.H{
+			respond(c, http.StatusOK, gin.H{
 				"message": fmt.Sprintf("Object '%s' exists", name),
 			})
 		}
 	})
 
 	// 路由处理文件下载
-	r.GET("/download/:object", func(c *gin.Context) {
+	downloadObject := func(c *gin.Context) {
+		selected := buckets.of(c)
+		reads := reads.forBucket(selected)
 		objectName := c.Param("object") // 从URL参数获取对象名
+		// 以 "/" 结尾的前缀返回其下的索引对象（例如 some/path/index.html），不存在时返回 404
+		if isDirectoryKey(objectName) && cfg.IndexDocument != "" {
+			objectName += cfg.IndexDocument
+		} else if isDirectoryKey(objectName) {
+			respond(c, 400, gin.H{
+				"message": fmt.Sprintf("'%s' is a directory, not a file", objectName),
+			})
+			return
+		}
 		ext := filepath.Ext(objectName)
 		if ext == "" {
 			// 如果没有扩展名，可以选择给它一个默认的扩展名
 			ext = ".bin"
 		}
-		// 获取文件元数据，查看文件大小
-		meta, err := bucket.GetObjectMeta(objectName)
+		// fresh=true 用于覆盖对象后立即下载最新内容：只读主存储桶（备用地域的复制可能滞后），不使用磁盘缓存，
+		// 并禁止浏览器和 CDN 缓存这次响应
+		fresh := c.Query("fresh") == "true"
+		// 获取文件元数据，查看文件大小和缓存头；主存储桶不可用时改读备用存储桶，之后的读取都使用同一个存储桶
+		var meta http.Header
+		var err error
+		readBucket := selected
+		if fresh {
+			meta, err = selected.GetObjectDetailedMeta(objectName, ossCtx(c))
+		} else {
+			readBucket, err = reads.run(c.Request.Context(), objectName, func(b *oss.Bucket) (err error) {
+				meta, err = b.GetObjectDetailedMeta(objectName, ossCtx(c))
+				return err
+			})
+		}
+		if isNoSuchKey(err) && cfg.CaseInsensitiveLookup {
+			if match := caseInsensitiveMatch(c, readBucket, objectName, cfg.CaseInsensitiveScanLimit); match != "" {
+				objectName = match
+				meta, err = readBucket.GetObjectDetailedMeta(objectName, ossCtx(c))
+			}
+		}
 		if err != nil {
+			// 对象不存在返回 404，只有 OSS 本身出错才返回 500，便于监控和客户端决定是否重试
+			if isNoSuchKey(err) {
+				respond(c, 404, gin.H{
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
 			log.Printf("Failed to get object metadata: %v", err)
-			c.JSON(500, gin.H{
+			respond(c, 500, gin.H{
 				"message": "Failed to get object metadata",
 			})
 			return
 		}
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
 
 		// 获取文件大小
-		fileSize := meta["Content-Length"] // 从 metadata 中获取文件大小
-		// 获取文件流
-		body, err := bucket.GetObject(objectName)
+		fileSize := meta.Get("Content-Length") // 从 metadata 中获取文件大小
+		filename := filenames.generate(objectName, ext)
+
+		// 开启磁盘缓存且未要求校验时，从本地缓存文件返回，ETag 变化时重新获取
+		// 未命中时先把对象完整写入缓存再返回；http.ServeContent 自动处理 Range 和 If-Modified-Since
+		if cache != nil && c.Query("verify") == "" && !fresh && selected == bucket {
+			etag := normalizeETag(meta.Get("ETag"))
+			f, hit := cache.open(objectName, etag)
+			if !hit {
+				body, err := readBucket.GetObject(objectName, ossCtx(c))
+				if isNoSuchKey(err) {
+					respond(c, 404, gin.H{
+						"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+					})
+					return
+				}
+				if err != nil {
+					log.Printf("Failed to get object: %v", err)
+					respond(c, 500, gin.H{
+						"message": "Failed to get object",
+					})
+					return
+				}
+				f, err = cache.fill(objectName, etag, body)
+				body.Close()
+				if err != nil {
+					log.Printf("Failed to cache object %s: %v", objectName, err)
+					respond(c, 500, gin.H{
+						"message": "Failed to get object",
+					})
+					return
+				}
+			}
+			defer f.Close()
+			if hit {
+				c.Header("X-Cache", "HIT")
+			} else {
+				c.Header("X-Cache", "MISS")
+			}
+			c.Header("ETag", meta.Get("ETag"))
+			setDownloadHeaders(c, meta, filename, ext, inline, charsets)
+			modTime, _ := http.ParseTime(meta.Get("Last-Modified"))
+			http.ServeContent(c.Writer, c.Request, filename, modTime, f)
+			return
+		}
+
+		// 获取文件流；对象可能在读取元数据之后被删除
+		body, err := readBucket.GetObject(objectName, ossCtx(c))
+		if isNoSuchKey(err) {
+			respond(c, 404, gin.H{
+				"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+			})
+			return
+		}
 		if err != nil {
-			log.Fatalf("Failed to get object: %v", err)
-			c.JSON(500, gin.H{
+			log.Printf("Failed to get object: %v", err)
+			respond(c, 500, gin.H{
 				"message": "Failed to get object",
 			})
+			return
 		}
 		defer body.Close()
-		filename := generateRandomFilename(ext)
+
+		// 校验模式：
+		//   verify=true   边传输边计算 SHA-256，结束后通过 trailer 告知结果；数据已经发出，不一致时只能事后告知并记录日志
+		//   verify=strict 先把对象写入临时文件并校验，一致后才开始发送，代价是额外的磁盘占用和更长的首字节延迟
+		// 对象没有存储校验值时两种模式都退化为普通下载
+		var src io.Reader = body
+		verify := c.Query("verify")
+		expectedSum := meta.Get(checksumMetaHeader)
+		var hasher hash.Hash
+		if expectedSum != "" && verify == "strict" {
+			tmp, err := bufferAndVerify(body, expectedSum)
+			if err != nil {
+				log.Printf("Checksum verification failed for %s: %v", objectName, err)
+				respond(c, 502, gin.H{
+					"message": "Object failed checksum verification: " + err.Error(),
+				})
+				return
+			}
+			defer os.Remove(tmp.Name())
+			defer tmp.Close()
+			src = tmp
+		} else if expectedSum != "" && verify == "true" {
+			hasher = sha256.New()
+			src = io.TeeReader(body, hasher)
+			// trailer 只能通过分块传输发送，因此不设置 Content-Length
+			c.Header("Trailer", checksumTrailer)
+			fileSize = ""
+		} else if verify == "true" {
+			c.Header(checksumTrailer, "unavailable")
+		}
+
 		// 设置响应头
-		c.Header("Content-Disposition", "attachment; filename="+filename)
-		c.Header("Content-Type", mime.TypeByExtension(ext))     // 根据扩展名设置 MIME 类型
-		c.Header("Content-Length", fmt.Sprintf("%d", fileSize)) // 设置文件大小
+		setDownloadHeaders(c, meta, filename, ext, inline, charsets)
+		if fresh {
+			setNoCacheHeaders(c, meta.Get("ETag"))
+		}
+		// 开启 DOWNLOAD_GZIP 时按 Accept-Encoding 压缩文本类对象，压缩后长度未知，不设置 Content-Length
+		var dst io.Writer = c.Writer
+		if gzipOpts.enabled {
+			c.Header("Vary", "Accept-Encoding")
+		}
+		size, _ := strconv.ParseInt(meta.Get("Content-Length"), 10, 64)
+		if gzipOpts.applies(c.GetHeader("Accept-Encoding"), meta.Get("Content-Encoding"), meta.Get("Content-Type"), size) {
+			gz, _ := gzip.NewWriterLevel(c.Writer, gzipOpts.level)
+			defer gz.Close()
+			dst = gz
+			c.Header("Content-Encoding", "gzip")
+			c.Header("ETag", gzipETag(c.Writer.Header().Get("ETag")))
+			fileSize = ""
+		}
+		if fileSize != "" {
+			c.Header("Content-Length", fileSize) // 设置文件大小
+		}
 
+		// 客户端中途取消时关闭 OSS 响应体，让阻塞中的读取立即返回，不再浪费 OSS 流量
+		ctx := c.Request.Context()
+		stop := context.AfterFunc(ctx, func() { body.Close() })
+		defer stop()
 		// 流式传输文件内容返回给客户端
-		_, err = io.Copy(c.Writer, body)
+		// 响应头和部分内容已经发出，出错时无法再返回 JSON，只记录日志
+		written, err := copyWithContext(ctx, dst, src)
 		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Download aborted by client: %s (%d bytes sent)", objectName, written)
+				return
+			}
 			log.Printf("Failed to send file to client: %v", err)
-			c.JSON(500, gin.H{
-				"message": "Failed to send file to client",
-			})
 			return
 		}
+		if hasher != nil {
+			status := "ok"
+			if hex.EncodeToString(hasher.Sum(nil)) != expectedSum {
+				status = "mismatch"
+				log.Printf("Checksum mismatch for %s: expected %s", objectName, expectedSum)
+			}
+			c.Writer.Header().Set(checksumTrailer, status)
+		}
 		log.Println("File downloaded successfully:", filename)
-		c.JSON(200, gin.H{
-			"message": "File downloaded successfully",
-			"file":    filename,
-		})
+	}
+	// /download/:object 只匹配一段路径，对象名中的 "/" 需要编码为 %2F；/files/*object 接受原样的多级路径，
+	// 例如 GET /files/some/path/ 返回 some/path/index.html（需要配置 INDEX_DOCUMENT）
+	// /download 下已有 session、concat 等子路由，不能改用通配路由
+	r.GET("/download/:object", downloadObject)
+	r.GET("/files/*object", func(c *gin.Context) {
+		// 通配参数以 "/" 开头
+		for i := range c.Params {
+			if c.Params[i].Key == "object" {
+				c.Params[i].Value = strings.TrimPrefix(c.Params[i].Value, "/")
+			}
+		}
+		downloadObject(c)
 	})
 
-	r.POST("/upload", func(c *gin.Context) {
-		// 获取上传的文件
-		file, err := c.FormFile("file")
+	// 创建可续传的下载会话，返回绑定对象当前 ETag 的令牌，之后通过 GET /download/session/:token 下载
+	r.POST("/download/session/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object")
+		meta, err := bucket.GetObjectDetailedMeta(objectName, ossCtx(c))
 		if err != nil {
-			log.Printf("Failed to get file from form: %v", err)
-			c.JSON(400, gin.H{"message": "Failed to get file"})
+			if isNoSuchKey(err) {
+				respond(c, 404, gin.H{
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
+			log.Printf("Failed to get object metadata: %v", err)
+			respond(c, 500, gin.H{
+				"message": "Failed to get object metadata",
+			})
 			return
 		}
-		// 指定要上传到 OSS 的文件路径（可以使用文件名或自定义路径）
-		objectName := file.Filename
-		src, err := file.Open()
-		if err != nil {
-			log.Fatalf("Failed to open file: %v", err)
-			c.JSON(400, gin.H{"message": "Failed to open file"})
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
 			return
 		}
-		defer src.Close()
-		// 指定待上传的网络流。
-		// 从网络流中读取数据，并将其上传至 OSS。
-		err = bucket.PutObject(objectName, src)
+		size, _ := strconv.ParseInt(meta.Get("Content-Length"), 10, 64)
+		token, session := downloadSessions.create(bucket, objectName, size, meta)
+		respond(c, 200, gin.H{
+			"token":     token,
+			"key":       objectName,
+			"etag":      normalizeETag(session.etag),
+			"size":      size,
+			"expiresAt": session.expires.UTC(),
+			"download":  "/download/session/" + token,
+		})
+	})
+	// 按会话下载，offset 为起始字节（默认 0）；以创建会话时的 ETag 为条件读取，对象已被修改时返回 409，需重新创建会话
+	// 注意：名为 "session/..." 且未编码 "/" 的对象会被这个路由拦截，需通过 %2F 编码后的对象名下载
+	r.GET("/download/session/:token", func(c *gin.Context) {
+		session, ok := downloadSessions.get(c.Param("token"))
+		if !ok {
+			respond(c, 404, gin.H{"message": "Download session not found or expired"})
+			return
+		}
+		var offset int64
+		if value := c.Query("offset"); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				respond(c, 400, gin.H{"message": fmt.Sprintf("invalid offset %q", value)})
+				return
+			}
+			offset = n
+		}
+		if offset > 0 && offset >= session.size {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", session.size))
+			respond(c, http.StatusRequestedRangeNotSatisfiable, gin.H{
+				"message": fmt.Sprintf("offset %d is beyond the object size %d", offset, session.size),
+			})
+			return
+		}
+		options := []oss.Option{oss.IfMatch(session.etag), ossCtx(c)}
+		if offset > 0 {
+			options = append(options, oss.NormalizedRange(fmt.Sprintf("%d-", offset)))
+		}
+		body, err := session.bucket.GetObject(session.key, options...)
 		if err != nil {
-			log.Fatalf("Failed to fetch URL: %v", err)
-			c.JSON(500, gin.H{"message": "Failed to upload file to OSS"})
+			switch {
+			case isPreconditionFailed(err), isNoSuchKey(err):
+				respond(c, http.StatusConflict, gin.H{
+					"message": fmt.Sprintf("Object '%s' has changed since the session was created, create a new session", session.key),
+				})
+			default:
+				log.Printf("Failed to get object: %v", err)
+				respond(c, 500, gin.H{
+					"message": "Failed to get object",
+				})
+			}
 			return
 		}
+		defer body.Close()
 
-		log.Println("File uploaded successfully.")
-		c.JSON(200, gin.H{"message": "File uploaded successfully"})
-	})
-	// 定义一个 POST 路由
-	r.DELETE("/delete/:object", func(c *gin.Context) {
-		objectName := c.Param("object") // 从URL参数获取对象名
-		// 调用 OSS DeleteObject 方法删除对象
-		err := bucket.DeleteObject(objectName)
+		ext := filepath.Ext(session.key)
+		if ext == "" {
+			ext = ".bin"
+		}
+		setDownloadHeaders(c, session.meta, filenames.generate(session.key, ext), ext, inline, charsets)
+		c.Header("ETag", session.etag)
+		c.Header("Content-Length", strconv.FormatInt(session.size-offset, 10))
+		if offset > 0 {
+			c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, session.size-1, session.size))
+			c.Status(http.StatusPartialContent)
+		}
+		ctx := c.Request.Context()
+		stop := context.AfterFunc(ctx, func() { body.Close() })
+		defer stop()
+		written, err := copyWithContext(ctx, c.Writer, body)
 		if err != nil {
-			// 如果发生错误，返回失败响应
-			c.JSON(500, gin.H{
-				"status":  "error",
-				"message": fmt.Sprintf("Failed to delete object: %s", err.Error()),
+			log.Printf("Session download of %s stopped at offset %d: %v", session.key, offset+written, err)
+		}
+	})
+
+	// 把多个对象按给定顺序首尾相接作为一个文件下载，例如客户端分块上传的日志片段；所有对象的大小都已知时返回 Content-Length
+	// 开始发送前检查所有对象，任何一个不存在或不可读都直接返回错误；发送过程中出错时响应会被截断，只记录日志
+	r.POST("/download/concat", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		var req struct {
+			Keys     []string `json:"keys" binding:"required"`
+			Filename string   `json:"filename"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{
+				"message": "Invalid request body: " + err.Error(),
 			})
 			return
 		}
-
-		// 如果删除成功，返回成功响应
-		c.JSON(200, gin.H{
-			"status":  "success",
-			"message": fmt.Sprintf("Object '%s' deleted successfully", objectName),
-		})
-	})
-	r.GET("/list", func(c *gin.Context) {
-		// 假设你已经设置好了 OSS 客户端和存储桶
-		var allObjects []string
-		marker := ""
-		for {
-			lsRes, err := bucket.ListObjects(oss.Marker(marker))
-			if err != nil {
-				log.Fatalf("Failed to list objects: %v", err)
-				c.JSON(500, gin.H{
-					"status":  "error",
-					"message": fmt.Sprintf("Failed to list objects: %s", err.Error()),
+		if len(req.Keys) == 0 || len(req.Keys) > cfg.ConcatMaxObjects {
+			respond(c, 400, gin.H{
+				"message": fmt.Sprintf("keys must contain between 1 and %d objects", cfg.ConcatMaxObjects),
+			})
+			return
+		}
+		for _, key := range req.Keys {
+			if key == "" || isDirectoryKey(key) {
+				respond(c, 400, gin.H{
+					"message": fmt.Sprintf("'%s' is not a file", key),
 				})
+				return
 			}
-
-			// 打印列举结果。默认情况下，一次返回100条记录。
-			for _, object := range lsRes.Objects {
-				allObjects = append(allObjects, object.Key)
+		}
+		parts, total, failed, err := statConcatParts(bucket, req.Keys, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, 404, gin.H{
+					"message": fmt.Sprintf("Object '%s' does not exist", failed),
+					"key":     failed,
+				})
+				return
 			}
-
-			// 如果还有更多对象需要列举，则更新marker并继续循环。
-			if lsRes.IsTruncated {
-				marker = lsRes.NextMarker
-			} else {
-				break
+			log.Printf("Failed to get object metadata for %s: %v", failed, err)
+			respond(c, 500, gin.H{
+				"message": "Failed to get object metadata",
+			})
+			return
+		}
+		for _, part := range parts {
+			if !allowObjectRead(c, part.meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+				return
 			}
 		}
 
-		log.Println("All objects have been listed.")
-		c.JSON(200, gin.H{
-			"status":  "success",
-			"message": "All objects have been listed",
-			"objects": allObjects,
-		})
-
-	})
-	r.GET("/invertcode/:audio", func(c *gin.Context) {
-		audio := c.Param("audio")
-		// 调用 OSS GetObject 方法获取对象
-		object, err := bucket.GetObject(audio)
+		// 文件名默认按 DOWNLOAD_FILENAME_TEMPLATE 由第一个对象生成
+		filename := req.Filename
+		if filename == "" {
+			ext := filepath.Ext(req.Keys[0])
+			if ext == "" {
+				ext = ".bin"
+			}
+			filename = filenames.generate(req.Keys[0], ext)
+		}
+		c.Header("Content-Disposition", contentDisposition("attachment", filename))
+		c.Header("Content-Type", "application/octet-stream")
+		if total >= 0 {
+			c.Header("Content-Length", strconv.FormatInt(total, 10))
+		}
+		c.Status(200)
+		written, err := streamConcat(c.Request.Context(), c.Writer, bucket, parts, ossCtx(c))
 		if err != nil {
-			log.Println("Error getting object:", err)
-			c.JSON(500, gin.H{
-				"status":  "error",
-				"message": "Failed to get object",
-			})
+			log.Printf("Concatenated download stopped after %d bytes: %v", written, err)
 			return
 		}
-		// 转码操作 TODO!
-		c.JSON(200, gin.H{
-			"message": "invertcode success",
-			"file":    object,
-		})
-		defer object.Close()
+		log.Printf("Concatenated download of %d object(s) sent (%d bytes)", len(parts), written)
 	})
-	// 启动服务器，监听端口 8080
-	r.Run(":8080")
-}
-
-func generateRandomFilename(ext string) string {
-	// 设置随机数种子为当前时间戳
-	rand.Seed(time.Now().UnixNano())
 
-	// 生成一个随机字符串
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	length := 10 // 文件名长度
-	var filename []byte
-	for i := 0; i < length; i++ {
-		filename = append(filename, charset[rand.Intn(len(charset))])
+	// 上传类接口共用的对象名处理（见 resolveUploadKey），出错时已写入响应并返回 false
+	// 已有以编码形式保存的同名对象时，reject 拒绝上传，normalize 照常上传并在响应中提示
+	resolveKey := func(c *gin.Context, bucket *oss.Bucket, key string) (uploadKey, bool) {
+		uk, status, err := resolveUploadKey(bucket, key, cfg.MaxKeyLength, cfg.KeyLengthStrategy, cfg.KeyEncodingStrategy, ossCtx(c))
+		if err != nil {
+			resp := gin.H{"message": err.Error()}
+			if uk.variant != "" {
+				resp["variant"] = uk.variant
+			}
+			respond(c, status, resp)
+			return uk, false
+		}
+		return uk, true
 	}
-
-	// 使用时间戳作为文件名的一部分
-	timestamp := time.Now().Unix()
-
-	// 组合随机字符串和时间戳来生成文件名
-	return fmt.Sprintf("%d_%s%s", timestamp, string(filename), ext)
-}
-
-// 自动创建 .env 文件并设置默认值
-func createEnvFileIfNotExist() {
-	// 检查 .env 文件是否存在
-	if _, err := os.Stat(".env"); os.IsNotExist(err) {
-		// 如果文件不存在，创建并写入默认值
-		envContent := `OSS_ENDPOINT=oss-cn-hangzhou.aliyuncs.com
-OSS_ACCESS_KEY_ID=your-access-key-id
-OSS_ACCESS_KEY_SECRET=your-access-key-secret
-OSS_BUCKET_NAME=your-bucket-name`
-
-		// 创建文件
-		err := os.WriteFile(".env", []byte(envContent), 0644)
+	// 上传类接口的请求体读取超时，见 UPLOAD_IDLE_TIMEOUT、UPLOAD_READ_TIMEOUT
+	readTimeout := uploadReadTimeout(cfg.UploadIdleTimeout, cfg.UploadReadTimeout)
+	r.POST("/upload", readTimeout, func(c *gin.Context) {
+		bucket := buckets.of(c)
+		urlOpts := urlOpts.forBucket(bucket)
+		// 带 Idempotency-Key 的重试直接返回第一次成功上传的结果，不会重复上传
+		idempotencyKey := c.GetHeader(idempotencyHeader)
+		if cached, inProgress := idempotency.begin(idempotencyKey); cached != nil {
+			c.Header("Idempotent-Replayed", "true")
+			respond(c, 200, cached)
+			return
+		} else if inProgress {
+			respond(c, http.StatusConflict, gin.H{"message": "A request with this Idempotency-Key is still in progress"})
+			return
+		}
+		var result gin.H
+		defer func() { idempotency.finish(idempotencyKey, result) }()
+		// 限制请求体大小，超出部分在读取时直接报错
+		if cfg.MaxUploadBodySize > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxUploadBodySize)
+		}
+		// 先解析表单并检查字段数量和大小，再读取文件
+		if status, err := checkMultipartForm(c.Request, cfg.MaxMultipartMemory, cfg.MaxFormParts, cfg.MaxFormFieldSize); err != nil {
+			if uploadStalled(c) {
+				status, err = http.StatusRequestTimeout, errUploadStalled
+			}
+			log.Printf("Rejected multipart form: %v", err)
+			respond(c, status, gin.H{"message": err.Error()})
+			return
+		}
+		// 上传成功后返回的地址类型：公共读存储桶默认返回公共地址，否则返回签名地址
+		// 客户端可通过 urlType=public|signed 指定类型，urlExpires 指定签名有效期（秒）
+		signed := !urlOpts.public
+		switch c.Query("urlType") {
+		case "":
+		case "public":
+			signed = false
+		case "signed":
+			signed = true
+		default:
+			respond(c, 400, gin.H{"message": "urlType must be 'public' or 'signed'"})
+			return
+		}
+		expiry, err := parseExpiry(c.Query("urlExpires"), urlOpts)
+		if err != nil {
+			respond(c, 400, gin.H{"message": err.Error()})
+			return
+		}
+		// responseContentDisposition/responseContentType 签入返回的地址，只有签名地址支持，指定后默认返回签名地址
+		overrides, err := parseResponseOverrides(c.Query("responseContentDisposition"), c.Query("responseContentType"))
 		if err != nil {
-			log.Fatalf("Failed to create .env file: %v", err)
+			respond(c, 400, gin.H{"message": err.Error()})
+			return
+		}
+		if len(overrides) > 0 {
+			if c.Query("urlType") == "public" {
+				respond(c, 400, gin.H{"message": "response header overrides require urlType=signed"})
+				return
+			}
+			signed = true
+		}
+		// 可选参数（缓存头、ttl、overwrite、acl、validateImage 等）见 uploadOptions
+		params, status, err := uploadOptions(c, func(name string) string { return formOrQuery(c, name) }, cfg, bucket == buckets.defaultBucket)
+		if err != nil {
+			respond(c, status, gin.H{"message": err.Error()})
+			return
+		}
+		// 获取上传的文件
+		file, err := c.FormFile("file")
+		if err != nil {
+			log.Printf("Failed to get file from form: %v", err)
+			respond(c, 400, gin.H{"message": "Failed to get file"})
+			return
+		}
+		// 指定要上传到 OSS 的文件路径（可以使用文件名或自定义路径）
+		// 文件名会被 multipart 解析去掉目录部分，需要包含 "/" 等特殊字符的对象名通过 key 字段原样指定
+		// 超过长度上限时按 KEY_LENGTH_STRATEGY 拒绝或截断，而不是等 OSS 返回难以理解的错误
+		key := c.PostForm("key")
+		if key == "" {
+			key = file.Filename
+		}
+		uk, ok := resolveKey(c, bucket, key)
+		if !ok {
+			return
+		}
+		objectName := uk.name
+		src, err := file.Open()
+		if err != nil {
+			log.Printf("Failed to open file: %v", err)
+			respond(c, 400, gin.H{"message": "Failed to open file"})
+			return
+		}
+		defer src.Close()
+		// 一次读取计算 SHA-256、MD5 和 CRC32 并在响应中返回；SHA-256 作为元数据保存，下载时可据此做端到端校验
+		digests, err := computeDigests(src)
+		if err != nil {
+			log.Printf("Failed to compute checksum: %v", err)
+			respond(c, 500, gin.H{"message": "Failed to read file"})
+			return
+		}
+		checksum := digests.SHA256
+		putOptions := append(params.putOptions(), oss.Meta(checksumMetaKey, checksum))
+		// 可选的 expectedMd5：与服务端收到的内容的 MD5 不一致时返回 422，不写入对象
+		if value := formOrQuery(c, "expectedMd5"); value != "" {
+			expected, err := parseExpectedMD5(value)
+			if err != nil {
+				respond(c, 400, gin.H{"message": err.Error()})
+				return
+			}
+			if expected != digests.MD5 {
+				respond(c, http.StatusUnprocessableEntity, gin.H{
+					"message":  "Uploaded content does not match expectedMd5",
+					"expected": expected,
+					"actual":   digests.MD5,
+				})
+				return
+			}
+		}
+		// 可选的图片校验：自称图片（扩展名或声明的类型）的文件必须能解析出图片头，否则返回 422
+		var imgInfo *imageInfo
+		if params.validateImage && claimsDecodableImage(file.Filename, file.Header.Get("Content-Type")) {
+			info, err := checkImage(src)
+			if err != nil {
+				respond(c, http.StatusUnprocessableEntity, gin.H{"message": err.Error()})
+				return
+			}
+			imgInfo = &info
+		}
+		// 先写过期索引再上传：上传失败时留下的索引会在清理时因找不到对象而被删除，
+		// 反过来如果上传成功而索引写入失败，对象就永远不会过期
+		if !params.ttlExpiresAt.IsZero() {
+			if err := scheduleExpiry(bucket, cfg.ObjectTTLIndexPrefix, objectName, params.ttlExpiresAt); err != nil {
+				log.Printf("Failed to schedule expiry for %s: %v", objectName, err)
+				respond(c, 500, gin.H{"message": "Failed to schedule object expiry"})
+				return
+			}
+		}
+		// 指定待上传的网络流。
+		// 从网络流中读取数据，并将其上传至 OSS；大文件使用分片上传，分片大小根据文件大小自动计算
+		// 返回 OSS 保存的 ETag：单次上传时是内容的 MD5（十六进制），分片上传时由各分片的 MD5 计算得到，不是内容的 MD5
+		var etag string
+		multipart := file.Size > partOpts.threshold
+		if multipart {
+			var complete oss.CompleteMultipartUploadResult
+			complete, err = multipartUpload(bucket, objectName, src, file.Size, partOpts, putOptions, params.completeOptions())
+			etag = complete.ETag
+		} else {
+			// 单次上传带上 Content-MD5，内容在传输中损坏时由 OSS 拒绝写入；分片上传由 SDK 按分片做 CRC 校验
+			var header http.Header
+			err = bucket.PutObject(objectName, src, append(putOptions, oss.ContentMD5(digests.contentMD5()), oss.GetResponseHeader(&header), ossCtx(c))...)
+			etag = header.Get("ETag")
+		}
+		if err != nil {
+			status, message := params.failure(err, objectName)
+			if status == http.StatusInternalServerError {
+				log.Printf("Failed to upload file to OSS: %v", err)
+			}
+			respond(c, status, gin.H{"message": message})
+			return
+		}
+
+		log.Println("File uploaded successfully.")
+		listings.invalidate(objectName)
+		cache.purge(objectName)
+		webhooks.notify(EventUpload, objectName, file.Size)
+		// 返回可直接使用的访问地址
+		resp := gin.H{
+			"message": "File uploaded successfully",
+			"key":     objectName,
+			"sha256":  checksum,
+			"digests": digests,
+			"acl":     params.acl,
+			"etag":    normalizeETag(etag),
+		}
+		if multipart {
+			resp["note"] = "ETag of multipart objects is not the MD5 of the content"
+		}
+		if imgInfo != nil {
+			resp["image"] = imgInfo
+		}
+		if objectName != uk.requested {
+			resp["requestedKey"] = uk.requested
+		}
+		if uk.warning != "" {
+			resp["warning"] = uk.warning
+		}
+		if !params.ttlExpiresAt.IsZero() {
+			resp["ttlExpiresAt"] = params.ttlExpiresAt.UTC().Format(time.RFC3339)
+		}
+		objectURL, err := buildObjectURL(bucket, urlOpts, objectName, signed, expiry, overrides...)
+		if err != nil {
+			// 地址生成失败不影响上传结果，只是不返回地址
+			log.Printf("Failed to build object URL: %v", err)
+		} else {
+			resp["url"] = objectURL
+			if signed {
+				resp["urlType"] = "signed"
+				resp["expiresAt"] = time.Now().Add(expiry).UTC().Format(time.RFC3339)
+			} else {
+				resp["urlType"] = "public"
+			}
+		}
+		result = resp
+		respond(c, 200, resp)
+	})
+
+	// 原始请求体上传：请求体就是文件内容，必须声明 Content-Length，边读边写入 OSS，不经过内存或磁盘缓冲
+	// 不超过 MULTIPART_THRESHOLD 时单次上传，否则按声明的长度计算分片大小流式分片上传；实际长度与声明不符时返回 400，不写入对象
+	// 对象类型取自 Content-Type，其余可选参数与 POST /upload 相同（见 uploadOptions），只从查询参数读取
+	// SHA-256 边传输边计算，内容写入后才知道结果，因此上传完成后再通过原地复制写入元数据（以 ETag 为条件，不会写到并发上传的对象上）；
+	// 写入失败时对象照常保留，响应中 checksumStored 为 false，下载时 verify 校验对该对象不可用；
+	// 超过 1GB 的对象无法原地复制（CopyObject 的上限），不写入校验值，同样返回 checksumStored 为 false
+	r.PUT("/upload/:object", readTimeout, func(c *gin.Context) {
+		bucket := buckets.of(c)
+		size := c.Request.ContentLength
+		if size < 0 {
+			respond(c, http.StatusLengthRequired, gin.H{"message": "Content-Length is required, use POST /upload for chunked uploads"})
+			return
+		}
+		if cfg.MaxUploadBodySize > 0 && size > cfg.MaxUploadBodySize {
+			respond(c, http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("Request body exceeds %d bytes", cfg.MaxUploadBodySize)})
+			return
+		}
+		uk, ok := resolveKey(c, bucket, c.Param("object"))
+		if !ok {
+			return
+		}
+		objectName := uk.name
+		if isDirectoryKey(objectName) {
+			respond(c, 400, gin.H{"message": fmt.Sprintf("'%s' is a directory, not a file", objectName)})
+			return
+		}
+		params, status, err := uploadOptions(c, c.Query, cfg, bucket == buckets.defaultBucket)
+		if err != nil {
+			respond(c, status, gin.H{"message": err.Error()})
+			return
+		}
+		contentType := c.GetHeader("Content-Type")
+		if contentType != "" {
+			if _, _, err := mime.ParseMediaType(contentType); err != nil || !validHeaderValue(contentType) {
+				respond(c, 400, gin.H{"message": fmt.Sprintf("invalid Content-Type %q", contentType)})
+				return
+			}
+			params.options = append(params.options, oss.ContentType(contentType))
+		}
+
+		body := &declaredLengthReader{r: c.Request.Body, declared: size}
+		var src io.Reader = body
+		var imgInfo *imageInfo
+		if params.validateImage && claimsDecodableImage(objectName, contentType) {
+			info, rest, err := checkImageStream(body)
+			switch {
+			case uploadStalled(c):
+				respond(c, http.StatusRequestTimeout, gin.H{"message": "Request body read timed out"})
+				return
+			case body.err != nil:
+				respond(c, 400, gin.H{"message": body.err.Error()})
+				return
+			case err != nil:
+				respond(c, http.StatusUnprocessableEntity, gin.H{"message": err.Error()})
+				return
+			}
+			imgInfo, src = &info, rest
+		}
+		hasher := sha256.New()
+		src = io.TeeReader(src, hasher)
+		if !params.ttlExpiresAt.IsZero() {
+			if err := scheduleExpiry(bucket, cfg.ObjectTTLIndexPrefix, objectName, params.ttlExpiresAt); err != nil {
+				log.Printf("Failed to schedule expiry for %s: %v", objectName, err)
+				respond(c, 500, gin.H{"message": "Failed to schedule object expiry"})
+				return
+			}
+		}
+		putOptions := params.putOptions()
+		var etag string
+		multipart := size > partOpts.threshold
+		if multipart {
+			var complete oss.CompleteMultipartUploadResult
+			complete, err = multipartUpload(bucket, objectName, src, size, partOpts, putOptions, params.completeOptions())
+			etag = complete.ETag
+		} else {
+			// 客户端提供的 Content-MD5 原样转给 OSS，内容在传输中损坏时由 OSS 拒绝写入
+			if contentMD5 := c.GetHeader("Content-MD5"); contentMD5 != "" {
+				putOptions = append(putOptions, oss.ContentMD5(contentMD5))
+			}
+			var header http.Header
+			err = bucket.PutObject(objectName, src, append(putOptions, oss.ContentLength(size), oss.GetResponseHeader(&header), ossCtx(c))...)
+			etag = header.Get("ETag")
+		}
+		if err != nil {
+			switch {
+			case uploadStalled(c):
+				respond(c, http.StatusRequestTimeout, gin.H{"message": "Request body read timed out"})
+			case body.err != nil:
+				respond(c, 400, gin.H{"message": body.err.Error()})
+			default:
+				status, message := params.failure(err, objectName)
+				if status == http.StatusInternalServerError {
+					log.Printf("Failed to upload %s to OSS: %v", objectName, err)
+				}
+				respond(c, status, gin.H{"message": message})
+			}
+			return
+		}
+		checksum := hex.EncodeToString(hasher.Sum(nil))
+		checksumStored := size <= maxCopyObjectSize
+		if checksumStored {
+			// 原地复制可能改变分片上传对象的 ETag，以复制结果为准
+			metaOptions := append(params.options, oss.Meta(checksumMetaKey, checksum), oss.MetadataDirective(oss.MetaReplace), oss.CopySourceIfMatch(etag), ossCtx(c))
+			if copied, err := bucket.CopyObject(objectName, objectName, metaOptions...); err != nil {
+				log.Printf("Failed to store checksum of %s: %v", objectName, err)
+				checksumStored = false
+			} else {
+				etag = copied.ETag
+			}
+		}
+
+		log.Printf("Streamed %d bytes to %s", size, objectName)
+		listings.invalidate(objectName)
+		cache.purge(objectName)
+		webhooks.notify(EventUpload, objectName, size)
+		resp := gin.H{
+			"message": "File uploaded successfully",
+			"key":     objectName,
+			"size":    size,
+			"sha256":  checksum,
+			"acl":     params.acl,
+			"etag":    normalizeETag(etag),
+		}
+		if !checksumStored {
+			resp["checksumStored"] = false
+		}
+		if multipart {
+			resp["note"] = "ETag of multipart objects is not the MD5 of the content"
+		}
+		if imgInfo != nil {
+			resp["image"] = imgInfo
+		}
+		if objectName != uk.requested {
+			resp["requestedKey"] = uk.requested
+		}
+		if uk.warning != "" {
+			resp["warning"] = uk.warning
+		}
+		if !params.ttlExpiresAt.IsZero() {
+			resp["ttlExpiresAt"] = params.ttlExpiresAt.UTC().Format(time.RFC3339)
+		}
+		respond(c, 200, resp)
+	})
+
+	// 从远端 URL 导入文件：在后台下载并写入 OSS，大文件或长度未知的响应流式分片上传，不经过本地磁盘
+	// 返回 202 和任务 ID，通过 /jobs/:id 查看进度；目标地址受 OUTBOUND_* 策略限制，key 为空时使用 URL 路径的最后一段
+	// 需要 API_KEY；同时进行的导入不超过 IMPORT_MAX_CONCURRENCY 个，远端文件大小受 MAX_UPLOAD_BODY_SIZE 限制
+	importClient := outbound.client(cfg.ImportTimeout)
+	importSlots := make(chan struct{}, cfg.ImportMaxConcurrency)
+	r.POST("/upload/url", requireAPIKey(cfg.APIKey), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		var req struct {
+			URL string `json:"url" binding:"required"`
+			Key string `json:"key"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{
+				"message": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		if err := outbound.checkURL(req.URL); err != nil {
+			respond(c, 400, gin.H{"message": err.Error()})
+			return
+		}
+		key := req.Key
+		if key == "" {
+			u, _ := url.Parse(req.URL)
+			if key = path.Base(u.Path); key == "/" || key == "." {
+				respond(c, 400, gin.H{"message": "key is required when the URL has no file name"})
+				return
+			}
+		}
+		uk, ok := resolveKey(c, bucket, key)
+		if !ok {
+			return
+		}
+		objectName := uk.name
+		var putOptions, completeOptions []oss.Option
+		if aclType, ok := objectACLs[cfg.DefaultObjectACL]; ok {
+			putOptions = append(putOptions, oss.ObjectACL(aclType))
+		}
+		if cfg.UploadForbidOverwrite {
+			putOptions = append(putOptions, oss.ForbidOverWrite(true))
+			completeOptions = append(completeOptions, oss.ForbidOverWrite(true))
+		}
+		select {
+		case importSlots <- struct{}{}:
+		default:
+			c.Header("Retry-After", "60")
+			respond(c, http.StatusTooManyRequests, gin.H{"message": "Too many imports in progress, please retry later"})
+			return
+		}
+		job := jobs.create("import", req.URL)
+		go func() {
+			defer func() { <-importSlots }()
+			runImportJob(bucket, jobs, job.ID, importClient, req.URL, objectName, cfg.MaxUploadBodySize, partOpts, putOptions, completeOptions, func(key string, size int64) {
+				listings.invalidate(key)
+				cache.purge(key)
+				webhooks.notify(EventUpload, key, size)
+			})
+		}()
+		resp := gin.H{
+			"message": "import job accepted",
+			"jobId":   job.ID,
+			"key":     objectName,
+		}
+		if uk.warning != "" {
+			resp["warning"] = uk.warning
+		}
+		respond(c, 202, resp)
+	})
+
+	// 浏览器表单直传：返回 PostObject 需要的 policy 和签名，文件不经过本服务
+	// 可选的 prefix 把 key 前缀收窄到 POST_POLICY_KEY_PREFIX 下的子目录，maxSize 只能调小上限
+	// 注意：名为 "post" 的对象无法通过 /presign/:object 签名
+	r.GET("/presign/post", func(c *gin.Context) {
+		urlOpts := urlOpts.forBucket(buckets.of(c))
+		keyPrefix := cfg.PostPolicyKeyPrefix
+		if value := c.Query("prefix"); value != "" {
+			if !strings.HasPrefix(value, cfg.PostPolicyKeyPrefix) {
+				respond(c, 400, gin.H{"message": fmt.Sprintf("prefix must start with '%s'", cfg.PostPolicyKeyPrefix)})
+				return
+			}
+			keyPrefix = value
+		}
+		maxSize := cfg.PostPolicyMaxSize
+		if value := c.Query("maxSize"); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n <= 0 {
+				respond(c, 400, gin.H{"message": fmt.Sprintf("invalid maxSize %q", value)})
+				return
+			}
+			maxSize = min(n, maxSize)
+		}
+		accessKeyID, accessKeySecret := credentials.get()
+		policy, err := signPostPolicy(urlOpts, accessKeyID, accessKeySecret, keyPrefix, maxSize, time.Now().Add(cfg.PostPolicyExpiry))
+		if err != nil {
+			log.Printf("Failed to sign post policy: %v", err)
+			respond(c, 500, gin.H{"message": "Failed to sign post policy"})
+			return
+		}
+		respond(c, 200, policy)
+	})
+	// 生成对象的签名删除地址（DELETE 方法），expires 为有效期（秒），默认 PRESIGN_DELETE_EXPIRY，不超过 PRESIGN_DELETE_MAX_EXPIRY
+	// 安全提示：地址在有效期内可被任何持有者使用任意次数，无法撤销，泄露即意味着对象可被删除；
+	// 通过地址的删除不经过本服务，不会进入回收站、不会触发 webhook，也不会使列举缓存失效
+	// 因此只对管理员开放，且不会改写为 CDN 地址
+	r.GET("/presign/delete/:object", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object")
+		expiry, err := parseExpiry(c.Query("expires"), objectURLOptions{expiry: cfg.PresignDeleteExpiry, maxExpiry: cfg.PresignDeleteMaxExpiry})
+		if err != nil {
+			respond(c, 400, gin.H{"message": err.Error()})
+			return
+		}
+		signedURL, err := bucket.SignURL(objectName, oss.HTTPDelete, int64(expiry/time.Second))
+		if err != nil {
+			log.Printf("Failed to sign delete URL for %s: %v", objectName, err)
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to sign URL"})
+			return
+		}
+		log.Printf("Issued presigned delete URL for %s, expires in %s", objectName, expiry)
+		respond(c, 200, gin.H{
+			"key":       objectName,
+			"method":    http.MethodDelete,
+			"url":       signedURL,
+			"expiresAt": time.Now().Add(expiry).UTC().Format(time.RFC3339),
+		})
+	})
+	// 生成对象的签名下载地址，expires 为有效期（秒）
+	// 可选的 responseContentDisposition、responseContentType 签入地址，OSS 返回对象时使用这些响应头，浏览器据此命名文件
+	r.GET("/presign/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		urlOpts := urlOpts.forBucket(bucket)
+		objectName := c.Param("object")
+		expiry, err := parseExpiry(c.Query("expires"), urlOpts)
+		if err != nil {
+			respond(c, 400, gin.H{"message": err.Error()})
+			return
+		}
+		overrides, err := parseResponseOverrides(c.Query("responseContentDisposition"), c.Query("responseContentType"))
+		if err != nil {
+			respond(c, 400, gin.H{"message": err.Error()})
+			return
+		}
+		meta, err := bucket.GetObjectDetailedMeta(objectName, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, http.StatusNotFound, gin.H{
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
+			log.Printf("Failed to get object metadata: %v", err)
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to get object metadata"})
+			return
+		}
+		// 签名地址绕过本服务直接访问 OSS，因此私有对象同样需要 API key
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
+		signedURL, err := buildObjectURL(bucket, urlOpts, objectName, true, expiry, overrides...)
+		if err != nil {
+			log.Printf("Failed to sign URL for %s: %v", objectName, err)
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to sign URL"})
+			return
+		}
+		respond(c, 200, gin.H{
+			"key":       objectName,
+			"url":       signedURL,
+			"expiresAt": time.Now().Add(expiry).UTC().Format(time.RFC3339),
+		})
+	})
+
+	// 检查签名地址：解析签名参数和过期时间，用当前的访问密钥重新计算签名，报告现在使用时 OSS 是否会接受，不会发起请求
+	// method 为地址签名时的方法（默认 GET），PUT 地址签名时带了 Content-Type 或 Content-MD5 的需要一并提供
+	r.POST("/presign/verify", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		var req struct {
+			URL         string `json:"url" binding:"required"`
+			Method      string `json:"method"`
+			ContentType string `json:"contentType"`
+			ContentMD5  string `json:"contentMd5"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{"message": "Invalid request body: " + err.Error()})
+			return
+		}
+		method := strings.ToUpper(req.Method)
+		switch method {
+		case "":
+			method = http.MethodGet
+		case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPost, http.MethodDelete:
+		default:
+			respond(c, 400, gin.H{"message": fmt.Sprintf("invalid method %q", req.Method)})
+			return
+		}
+		accessKeyID, accessKeySecret := credentials.get()
+		check := verifyPresignedURL(req.URL, method, req.ContentType, req.ContentMD5, urlOpts.forBucket(bucket), accessKeyID, accessKeySecret, time.Now())
+		respond(c, 200, check)
+	})
+
+	// 浏览器直传大文件：初始化分片上传并返回每个分片的 PUT 签名地址，分片数据不经过本服务
+	// 签名有效期不超过 MULTIPART_UPLOAD_TTL，超时未完成的上传会被自动取消
+	r.POST("/multipart/presign", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		urlOpts := urlOpts.forBucket(bucket)
+		var req struct {
+			Key     string `json:"key" binding:"required"`
+			Parts   int    `json:"parts" binding:"required"`
+			Expires string `json:"expires"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		if req.Parts < 1 || req.Parts > maxUploadParts {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("parts must be between 1 and %d", maxUploadParts),
+			})
+			return
+		}
+		expiry, err := parseExpiry(req.Expires, urlOpts)
+		if err != nil {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		expiry = min(expiry, cfg.MultipartUploadTTL)
+		uk, ok := resolveKey(c, bucket, req.Key)
+		if !ok {
+			return
+		}
+		imur, err := bucket.InitiateMultipartUpload(uk.name, ossCtx(c))
+		if err != nil {
+			log.Printf("Failed to initiate multipart upload: %v", err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to initiate multipart upload",
+			})
+			return
+		}
+		parts, err := presignUploadParts(bucket, imur, req.Parts, expiry)
+		if err != nil {
+			log.Printf("Failed to presign multipart upload %s: %v", imur.UploadID, err)
+			if abortErr := bucket.AbortMultipartUpload(imur, ossCtx(c)); abortErr != nil {
+				log.Printf("Failed to abort multipart upload %s: %v", imur.UploadID, abortErr)
+			}
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to presign multipart upload",
+			})
+			return
+		}
+		uploads.track(bucket, imur)
+		resp := gin.H{
+			"status":    "success",
+			"key":       imur.Key,
+			"uploadId":  imur.UploadID,
+			"parts":     parts,
+			"expiresAt": time.Now().Add(expiry).UTC().Format(time.RFC3339),
+		}
+		if uk.warning != "" {
+			resp["warning"] = uk.warning
+		}
+		respond(c, 200, resp)
+	})
+
+	// 合并浏览器直传的分片；未提交 parts 时由服务端列举已上传的分片
+	r.POST("/multipart/complete", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		var req struct {
+			Key      string `json:"key" binding:"required"`
+			UploadID string `json:"uploadId" binding:"required"`
+			Parts    []struct {
+				PartNumber int    `json:"partNumber"`
+				ETag       string `json:"etag"`
+			} `json:"parts"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		imur := oss.InitiateMultipartUploadResult{Bucket: bucket.BucketName, Key: req.Key, UploadID: req.UploadID}
+		var parts []oss.UploadPart
+		for _, p := range req.Parts {
+			parts = append(parts, oss.UploadPart{PartNumber: p.PartNumber, ETag: "\"" + normalizeETag(p.ETag) + "\""})
+		}
+		if len(parts) == 0 {
+			var err error
+			if parts, err = listUploadedParts(bucket, imur); err != nil {
+				if svcErr, ok := asServiceError(err); ok && svcErr.Code == "NoSuchUpload" {
+					respond(c, 404, gin.H{
+						"status":  "error",
+						"message": fmt.Sprintf("Upload '%s' does not exist or has expired", req.UploadID),
+					})
+					return
+				}
+				log.Printf("Failed to list uploaded parts: %v", err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": "Failed to list uploaded parts",
+				})
+				return
+			}
+			if len(parts) == 0 {
+				respond(c, 400, gin.H{
+					"status":  "error",
+					"message": "No parts have been uploaded",
+				})
+				return
+			}
+		}
+		var completeOptions []oss.Option
+		if cfg.UploadForbidOverwrite {
+			completeOptions = append(completeOptions, oss.ForbidOverWrite(true))
+		}
+		result, err := bucket.CompleteMultipartUpload(imur, parts, append(completeOptions, ossCtx(c))...)
+		if err != nil {
+			svcErr, _ := asServiceError(err)
+			switch {
+			case svcErr.Code == "NoSuchUpload":
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Upload '%s' does not exist or has expired", req.UploadID),
+				})
+			case isAlreadyExists(err):
+				respond(c, http.StatusConflict, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' already exists", req.Key),
+				})
+			case svcErr.Code == "InvalidPart" || svcErr.Code == "InvalidPartOrder" || svcErr.Code == "EntityTooSmall":
+				respond(c, 400, gin.H{
+					"status":  "error",
+					"message": "Invalid parts: " + svcErr.Message,
+				})
+			default:
+				log.Printf("Failed to complete multipart upload: %v", err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": "Failed to complete multipart upload",
+				})
+			}
+			return
+		}
+		uploads.forget(req.UploadID)
+		listings.invalidate(req.Key)
+		cache.purge(req.Key)
+		webhooks.notify(EventUpload, req.Key, 0)
+		respond(c, 200, gin.H{
+			"status": "success",
+			"key":    req.Key,
+			"etag":   normalizeETag(result.ETag),
+			"parts":  len(parts),
+		})
+	})
+
+	// 取消通过 /multipart/presign 发起的分片上传，已上传的分片随之删除
+	// 只接受本服务记录中的 uploadId；重启前发起的上传无法通过这里取消，需由后台清理任务或 GET /admin/multipart 排查处理
+	// 在发起上传时的存储桶中取消，与本次请求的 X-OSS-Bucket 无关
+	r.DELETE("/upload/:uploadId", func(c *gin.Context) {
+		uploadID := c.Param("uploadId")
+		imur, ok, err := uploads.abort(uploadID, ossCtx(c))
+		if !ok {
+			respond(c, 404, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Upload '%s' is not an in-progress upload", uploadID),
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to abort multipart upload %s: %v", uploadID, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to abort multipart upload",
+			})
+			return
+		}
+		respond(c, 200, gin.H{
+			"status":   "success",
+			"message":  fmt.Sprintf("Upload '%s' aborted", uploadID),
+			"key":      imur.Key,
+			"uploadId": uploadID,
+		})
+	})
+
+	// 列举存储桶中未完成的分片上传（包括客户端放弃、尚未被后台清理的上传），用于排查未完成上传占用的存储
+	// 按 prefix 过滤，每页最多 maxUploads 个（默认 100，上限 1000），带上返回的 nextMarker 和 nextUploadIdMarker 获取下一页
+	r.GET("/admin/multipart", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		maxUploads := 100
+		if value := c.Query("maxUploads"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 1000 {
+				respond(c, 400, gin.H{
+					"status":  "error",
+					"message": "maxUploads must be an integer between 1 and 1000",
+				})
+				return
+			}
+			maxUploads = n
+		}
+		items, result, err := listMultipartUploads(bucket, c.Query("prefix"), c.Query("marker"), c.Query("uploadIdMarker"), maxUploads, func(uploadID string) bool {
+			tracked, _, ok := uploads.get(uploadID)
+			return ok && tracked.BucketName == bucket.BucketName
+		}, ossCtx(c))
+		if err != nil {
+			log.Printf("Failed to list multipart uploads: %v", err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to list multipart uploads",
+			})
+			return
+		}
+		resp := listEnvelope(items, result.NextKeyMarker, result.IsTruncated)
+		resp["status"] = "success"
+		resp["nextUploadIdMarker"] = result.NextUploadIDMarker
+		respond(c, 200, resp)
+	})
+	// 取消任意一个未完成的分片上传，key 取自 GET /admin/multipart 的结果；与 DELETE /upload/:uploadId 不同，
+	// 不要求上传由本服务发起，可以清理重启前或其他客户端留下的上传
+	r.DELETE("/admin/multipart/:uploadId", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		uploadID := c.Param("uploadId")
+		key := c.Query("key")
+		if key == "" {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "key is required",
+			})
+			return
+		}
+		imur := oss.InitiateMultipartUploadResult{Bucket: bucket.BucketName, Key: key, UploadID: uploadID}
+		if err := bucket.AbortMultipartUpload(imur, ossCtx(c)); err != nil {
+			if svcErr, ok := asServiceError(err); ok && svcErr.Code == "NoSuchUpload" {
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Upload '%s' of '%s' does not exist", uploadID, key),
+				})
+				return
+			}
+			log.Printf("Failed to abort multipart upload %s: %v", uploadID, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to abort multipart upload",
+			})
+			return
+		}
+		uploads.forget(uploadID)
+		respond(c, 200, gin.H{
+			"status":   "success",
+			"message":  fmt.Sprintf("Upload '%s' aborted", uploadID),
+			"key":      key,
+			"uploadId": uploadID,
+		})
+	})
+
+	// 改写对象的一段区间：请求体为新数据，offset 为起始位置，offset 等于对象大小时相当于追加
+	// 通过分片复制生成新对象，代价和限制见 patchObject
+	r.PATCH("/patch/:object", readTimeout, func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object")
+		offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+		if err != nil || offset < 0 {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "offset must be a non-negative integer",
+			})
+			return
+		}
+		size := c.Request.ContentLength
+		if size < 0 {
+			respond(c, http.StatusLengthRequired, gin.H{
+				"status":  "error",
+				"message": "Content-Length is required",
+			})
+			return
+		}
+		if size == 0 {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "Request body is empty",
+			})
+			return
+		}
+		if cfg.MaxUploadBodySize > 0 && size > cfg.MaxUploadBodySize {
+			respond(c, http.StatusRequestEntityTooLarge, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Request body exceeds %d bytes", cfg.MaxUploadBodySize),
+			})
+			return
+		}
+		meta, err := bucket.GetObjectDetailedMeta(objectName, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
+			log.Printf("Failed to get object metadata: %v", err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to get object metadata",
+			})
+			return
+		}
+		if objectSize, _ := strconv.ParseInt(meta.Get("Content-Length"), 10, 64); offset > objectSize {
+			respond(c, http.StatusRequestedRangeNotSatisfiable, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("offset %d is beyond the object size %d", offset, objectSize),
+			})
+			return
+		}
+		result, newSize, err := patchObject(bucket, objectName, meta, offset, c.Request.Body, size, partOpts)
+		if err != nil {
+			if isPreconditionFailed(err) {
+				respond(c, http.StatusPreconditionFailed, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' was modified during the patch, please retry", objectName),
+				})
+				return
+			}
+			// 分片上传在 patchObject 中已被取消
+			if uploadStalled(c) {
+				respond(c, http.StatusRequestTimeout, gin.H{
+					"status":  "error",
+					"message": "Request body read timed out",
+				})
+				return
+			}
+			log.Printf("Failed to patch object %s: %v", objectName, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to patch object",
+			})
+			return
+		}
+		listings.invalidate(objectName)
+		cache.purge(objectName)
+		webhooks.notify(EventUpload, objectName, newSize)
+		respond(c, 200, gin.H{
+			"status": "success",
+			"key":    objectName,
+			"size":   newSize,
+			"etag":   normalizeETag(result.ETag),
+		})
+	})
+
+	// 定义一个 POST 路由
+	r.DELETE("/delete/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object") // 从URL参数获取对象名
+		// If-Match：只在对象当前的 ETag 与客户端上次看到的一致时才删除，否则返回 412，避免删掉别人刚写入的新版本
+		// OSS 的 DeleteObject 不支持条件删除，这里先读取元数据再删除，两步之间对象仍可能被覆盖；
+		// 需要完全可靠时应开启存储桶版本控制，被误删的版本可以恢复
+		if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+			meta, err := bucket.GetObjectMeta(objectName, ossCtx(c))
+			if err != nil {
+				if isNoSuchKey(err) {
+					respond(c, 404, gin.H{
+						"status":  "error",
+						"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+					})
+					return
+				}
+				log.Printf("Failed to get object metadata: %v", err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": "Failed to get object metadata",
+				})
+				return
+			}
+			if !etagMatches(ifMatch, meta.Get("ETag")) {
+				respond(c, http.StatusPreconditionFailed, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' has changed, its current ETag does not match If-Match", objectName),
+					"etag":    normalizeETag(meta.Get("ETag")),
+				})
+				return
+			}
+		}
+		// 开启软删除时对象被移到回收站，permanent=true 可以强制直接删除；回收站中的对象总是直接删除
+		soft := cfg.SoftDelete && c.Query("permanent") != "true" && !strings.HasPrefix(objectName, cfg.TrashPrefix)
+		if soft {
+			trashed, err := moveToTrash(bucket, objectName, cfg.TrashPrefix)
+			if err != nil {
+				if isNoSuchKey(err) {
+					respond(c, 404, gin.H{
+						"status":  "error",
+						"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+					})
+					return
+				}
+				log.Printf("Failed to move '%s' to trash: %v", objectName, err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Failed to move object to trash: %s", err.Error()),
+				})
+				return
+			}
+			listings.invalidate(objectName)
+			cache.purge(objectName)
+			listings.invalidate(trashed)
+			webhooks.notify(EventDelete, objectName, 0)
+			respond(c, 200, gin.H{
+				"status":   "success",
+				"message":  fmt.Sprintf("Object '%s' moved to trash", objectName),
+				"trashKey": trashed,
+			})
+			return
+		}
+		// 调用 OSS DeleteObject 方法删除对象
+		err := bucket.DeleteObject(objectName, ossCtx(c))
+		if err != nil {
+			// 如果发生错误，返回失败响应
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to delete object: %s", err.Error()),
+			})
+			return
+		}
+
+		listings.invalidate(objectName)
+		cache.purge(objectName)
+		webhooks.notify(EventDelete, objectName, 0)
+		// 如果删除成功，返回成功响应
+		respond(c, 200, gin.H{
+			"status":  "success",
+			"message": fmt.Sprintf("Object '%s' deleted successfully", objectName),
+		})
+	})
+	// 归档：复制到 ARCHIVE_PREFIX 下并改为 ARCHIVE_STORAGE_CLASS，写入归档时间和 ARCHIVE_METADATA
+	// 可选参数 storageClass 覆盖存储类型，prefix 覆盖目标前缀（为空字符串时原地改存储类型），deleteSource=true 时归档后删除原对象
+	r.POST("/archive/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object")
+		className := cfg.ArchiveStorageClass
+		if value := formOrQuery(c, "storageClass"); value != "" {
+			className = value
+		}
+		class, ok := storageClasses[className]
+		if !ok {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid storageClass '%s'", className),
+			})
+			return
+		}
+		prefix := cfg.ArchivePrefix
+		if value, ok := c.GetQuery("prefix"); ok {
+			prefix = value
+		}
+		dest := prefix + objectName
+		deleteSource := formOrQuery(c, "deleteSource") == "true"
+		if deleteSource && dest == objectName {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "deleteSource requires a destination different from the source",
+			})
+			return
+		}
+		// 归档副本可能位于可见性不同的前缀下，复制前按源对象的可见性检查权限
+		meta, err := bucket.GetObjectDetailedMeta(objectName, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
+			log.Printf("Failed to get object metadata: %v", err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to get object metadata",
+			})
+			return
+		}
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
+		overlay, _ := parseMetadataOverlay(cfg.ArchiveMetadata)
+		storageClass, err := archiveObject(bucket, objectName, dest, class, overlay, ossCtx(c))
+		if err != nil {
+			switch {
+			case isNoSuchKey(err):
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+			case isPreconditionFailed(err):
+				respond(c, http.StatusPreconditionFailed, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' changed while archiving, try again", objectName),
+				})
+			default:
+				log.Printf("Failed to archive %s: %v", objectName, err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Failed to archive object: %s", err.Error()),
+				})
+			}
+			return
+		}
+		listings.invalidate(dest)
+		sourceDeleted := false
+		if deleteSource {
+			if err := bucket.DeleteObject(objectName, ossCtx(c)); err != nil {
+				// 归档副本已经写入，只是原对象没有删掉，返回成功并如实说明
+				log.Printf("Archived %s but failed to delete source: %v", objectName, err)
+			} else {
+				sourceDeleted = true
+				listings.invalidate(objectName)
+				cache.purge(objectName)
+				webhooks.notify(EventDelete, objectName, 0)
+			}
+		}
+		respond(c, 200, gin.H{
+			"status":        "success",
+			"message":       fmt.Sprintf("Object '%s' archived to '%s'", objectName, dest),
+			"source":        objectName,
+			"destination":   dest,
+			"storageClass":  storageClass,
+			"sourceDeleted": sourceDeleted,
+		})
+	})
+	// 刷新对象的 Last-Modified（内容和元数据不变），用于重置按最后修改时间生效的生命周期规则
+	r.POST("/touch/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object")
+		modified, err := touchObject(bucket, objectName, ossCtx(c))
+		if err != nil {
+			switch {
+			case isNoSuchKey(err):
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+			case isPreconditionFailed(err):
+				respond(c, http.StatusPreconditionFailed, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' changed while touching, try again", objectName),
+				})
+			default:
+				log.Printf("Failed to touch %s: %v", objectName, err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Failed to touch object: %s", err.Error()),
+				})
+			}
+			return
+		}
+		listings.invalidate(objectName)
+		respond(c, 200, gin.H{
+			"status":       "success",
+			"key":          objectName,
+			"lastModified": modified.UTC(),
+		})
+	})
+	// 从回收站恢复对象到原来的位置，原位置已有对象时返回 409，overwrite=true 时覆盖
+	r.POST("/restore-trash/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object")
+		restored, err := restoreFromTrash(bucket, objectName, cfg.TrashPrefix, c.Query("overwrite") == "true")
+		if err != nil {
+			switch {
+			case errors.Is(err, errNotInTrash):
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' is not in trash", objectName),
+				})
+			case isAlreadyExists(err):
+				respond(c, http.StatusConflict, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' already exists, use overwrite=true to replace it", objectName),
+				})
+			default:
+				log.Printf("Failed to restore '%s' from trash: %v", objectName, err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Failed to restore object: %s", err.Error()),
+				})
+			}
+			return
+		}
+		listings.invalidate(restored)
+		listings.invalidate(trashKey(cfg.TrashPrefix, objectName))
+		respond(c, 200, gin.H{
+			"status":  "success",
+			"message": fmt.Sprintf("Object '%s' restored", restored),
+			"key":     restored,
+		})
+	})
+	// 清空回收站，需要先取得确认令牌（见 confirmDestructive），dryRun=true 时只统计数量
+	r.DELETE("/trash/empty", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		dryRun := c.Query("dryRun") == "true"
+		if !dryRun && !confirmDestructive(c, confirmations, bucket, "empty-trash", cfg.TrashPrefix) {
+			return
+		}
+		count, sample, err := deleteByPrefix(bucket, cfg.TrashPrefix, dryRun)
+		if !dryRun {
+			listings.invalidatePrefix(cfg.TrashPrefix)
+		}
+		if err != nil {
+			log.Printf("Failed to empty trash after %d objects: %v", count, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to empty trash: %s", err.Error()),
+				"count":   count,
+			})
+			return
+		}
+		if dryRun {
+			respond(c, 200, gin.H{
+				"status":  "success",
+				"message": fmt.Sprintf("%d object(s) would be purged", count),
+				"dryRun":  true,
+				"count":   count,
+				"sample":  sample,
+			})
+			return
+		}
+		log.Printf("Purged %d object(s) from trash", count)
+		respond(c, 200, gin.H{
+			"status":  "success",
+			"message": fmt.Sprintf("%d object(s) purged from trash", count),
+			"count":   count,
+		})
+	})
+	// 在存储桶内复制对象
+	// 可选的 sourceEtag 会作为 x-oss-copy-source-if-match 条件传给 OSS，源对象在此期间被修改时返回 412；
+	// 未提供时先读取源对象当前的 ETag 并以它为条件复制，保证返回的 sourceEtag 就是实际被复制的版本
+	r.POST("/copy", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		var req struct {
+			Source      string `json:"source" binding:"required"`
+			Destination string `json:"destination" binding:"required"`
+			SourceETag  string `json:"sourceEtag"`
+			// COPY（默认）沿用源对象的元数据；REPLACE 时目标对象只带 contentType 和 metadata 中给出的元数据，
+			// 以及源对象的可见性和校验值
+			MetadataDirective string            `json:"metadataDirective"`
+			ContentType       string            `json:"contentType"`
+			Metadata          map[string]string `json:"metadata"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		directive, metaOptions, err := copyMetadataOptions(req.MetadataDirective, req.ContentType, req.Metadata)
+		if err != nil {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		// 总是读取源对象的元数据：复制相当于读取，需要按源对象的可见性检查权限
+		meta, err := bucket.GetObjectDetailedMeta(req.Source, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' does not exist", req.Source),
+				})
+				return
+			}
+			log.Printf("Failed to get object metadata: %v", err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to get object metadata",
+			})
+			return
+		}
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
+		sourceETag := normalizeETag(req.SourceETag)
+		if sourceETag == "" {
+			sourceETag = normalizeETag(meta.Get("ETag"))
+		}
+		// REPLACE 会丢掉源对象的全部用户元数据，可见性和校验值必须沿用源对象的，
+		// 否则 private 对象复制后就成了公开对象，下载校验也会失效
+		if directive == string(oss.MetaReplace) {
+			for _, name := range []string{cfg.VisibilityMetaKey, checksumMetaKey} {
+				if value := meta.Get(oss.HTTPHeaderOssMetaPrefix + name); value != "" {
+					metaOptions = append(metaOptions, oss.Meta(name, value))
+				}
+			}
+		}
+		// OSS 比较 ETag 时需要带引号的原始格式
+		result, err := bucket.CopyObject(req.Source, req.Destination, append(metaOptions, oss.CopySourceIfMatch("\""+sourceETag+"\""), ossCtx(c))...)
+		if err != nil {
+			switch {
+			case isPreconditionFailed(err):
+				respond(c, http.StatusPreconditionFailed, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Source object '%s' has changed (ETag no longer matches %s)", req.Source, sourceETag),
+				})
+			case isNoSuchKey(err):
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' does not exist", req.Source),
+				})
+			default:
+				log.Printf("Failed to copy object: %v", err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Failed to copy object: %s", err.Error()),
+				})
+			}
+			return
+		}
+		listings.invalidate(req.Destination)
+		cache.purge(req.Destination)
+		respond(c, 200, gin.H{
+			"status":            "success",
+			"message":           fmt.Sprintf("Object '%s' copied to '%s'", req.Source, req.Destination),
+			"source":            req.Source,
+			"destination":       req.Destination,
+			"sourceEtag":        sourceETag,
+			"destinationEtag":   normalizeETag(result.ETag),
+			"metadataDirective": directive,
+		})
+	})
+	// 删除 prefix 下带有标签 tag=key=value 的对象，扫描方式和代价与 /list/by-tag 相同
+	// 必须带上确认令牌才会真正删除（见 confirmDestructive），确认后会重新扫描，只删除届时仍带有该标签的对象；
+	// dryRun=true 时只统计将被删除的对象并返回部分样例
+	r.DELETE("/delete/by-tag", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		filter, err := parseTagFilter(c.Query("tag"))
+		if err != nil {
+			respond(c, 400, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		prefix := c.Query("prefix")
+		dryRun := c.Query("dryRun") == "true"
+		matches, _, err := findObjectsByTag(bucket, prefix, internalPrefixes, filter, cfg.TagScanConcurrency, ossCtx(c))
+		if err != nil {
+			log.Printf("Failed to list objects by tag %s: %v", filter, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to list objects by tag: %s", err.Error()),
+			})
+			return
+		}
+		keys := make([]string, 0, len(matches))
+		for _, object := range matches {
+			keys = append(keys, object.Key)
+		}
+		sample := keys[:min(len(keys), 100)]
+		if dryRun {
+			respond(c, 200, gin.H{
+				"status":  "success",
+				"message": fmt.Sprintf("%d object(s) would be deleted", len(keys)),
+				"dryRun":  true,
+				"count":   len(keys),
+				"sample":  sample,
+			})
+			return
+		}
+		describe := fmt.Sprintf("tagged %s under '%s'", filter, prefix)
+		if !confirmOperation(c, confirmations, bucket, "delete-by-tag", prefix+"?tag="+filter.String(), describe, func() (int, []string, error) {
+			return len(keys), sample, nil
+		}) {
+			return
+		}
+		deleted, err := deleteKeys(bucket, keys)
+		for _, key := range deleted {
+			listings.invalidate(key)
+			cache.purge(key)
+			webhooks.notify(EventDelete, key, 0)
+		}
+		if err != nil {
+			log.Printf("Failed to delete objects tagged %s after %d objects: %v", filter, len(deleted), err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to delete objects: %s", err.Error()),
+				"count":   len(deleted),
+			})
+			return
+		}
+		log.Printf("Deleted %d object(s) tagged %s under prefix '%s'", len(deleted), filter, prefix)
+		respond(c, 200, gin.H{
+			"status":  "success",
+			"message": fmt.Sprintf("%d object(s) tagged %s deleted successfully", len(deleted), filter),
+			"count":   len(deleted),
+		})
+	})
+	// 按前缀批量删除对象（相当于删除一个"目录"）
+	// 必须带上确认令牌才会真正删除（见 confirmDestructive）；dryRun=true 时只统计将被删除的对象并返回部分样例
+	// 注意：名为 "prefix" 的对象会被这个路由拦截，无法再通过 /delete/:object 删除
+	r.DELETE("/delete/prefix", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		prefix := c.Query("prefix")
+		dryRun := c.Query("dryRun") == "true"
+		if prefix == "" {
+			// 空前缀等于清空整个存储桶，直接拒绝
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "Missing prefix parameter",
+			})
+			return
+		}
+		if !dryRun && !confirmDestructive(c, confirmations, bucket, "delete-prefix", prefix) {
+			return
+		}
+		count, sample, err := deleteByPrefix(bucket, prefix, dryRun)
+		if !dryRun {
+			// 出错时也可能已经删除了一部分对象
+			listings.invalidatePrefix(prefix)
+			cache.purgePrefix(prefix)
+		}
+		if err != nil {
+			log.Printf("Failed to delete prefix '%s' after %d objects: %v", prefix, count, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to delete objects: %s", err.Error()),
+				"count":   count,
+			})
+			return
+		}
+		if dryRun {
+			respond(c, 200, gin.H{
+				"status":  "success",
+				"message": fmt.Sprintf("%d object(s) would be deleted", count),
+				"dryRun":  true,
+				"count":   count,
+				"sample":  sample,
+			})
+			return
+		}
+		log.Printf("Deleted %d object(s) under prefix '%s'", count, prefix)
+		respond(c, 200, gin.H{
+			"status":  "success",
+			"message": fmt.Sprintf("%d object(s) under '%s' deleted successfully", count, prefix),
+			"count":   count,
+		})
+	})
+	// 在 prefix 下的小文件中查找包含 query 的对象，用于回答"哪个配置文件里有这个值"之类的问题
+	// 这是暴力扫描而不是索引：逐个下载不超过 maxSize（默认且最大为 SEARCH_MAX_OBJECT_SIZE）的对象并比较内容，
+	// 一次最多下载 SEARCH_MAX_TOTAL_BYTES，达到后返回 truncated=true；耗时和流量都与扫描范围成正比，应尽量缩小 prefix
+	// 可以读取任何对象的内容，因此只对管理员开放
+	r.POST("/search", requireAdmin(cfg.AdminToken), func(c *gin.Context) {
+		bucket := buckets.of(c)
+		var req struct {
+			Prefix  string `json:"prefix"`
+			Query   string `json:"query" binding:"required"`
+			MaxSize int64  `json:"maxSize"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		limits := searchLimits{maxObjectSize: cfg.SearchMaxObjectSize, maxTotalBytes: cfg.SearchMaxTotalBytes, concurrency: cfg.SearchConcurrency}
+		if req.MaxSize < 0 {
+			respond(c, 400, gin.H{"status": "error", "message": "maxSize must not be negative"})
+			return
+		} else if req.MaxSize > 0 {
+			limits.maxObjectSize = min(req.MaxSize, limits.maxObjectSize)
+		}
+		result, err := searchObjects(bucket, req.Prefix, []byte(req.Query), internalPrefixes, limits, ossCtx(c))
+		if err != nil {
+			log.Printf("Failed to search objects under '%s': %v", req.Prefix, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to search objects: %s", err.Error()),
+				"result":  result,
+			})
+			return
+		}
+		respond(c, 200, gin.H{
+			"status": "success",
+			"prefix": req.Prefix,
+			"result": result,
+		})
+	})
+	// 按下级前缀汇总存储用量：groupBy=prefix（目前唯一支持的方式），prefix 限定上级前缀，delimiter 默认为 "/"
+	// 需要遍历 prefix 下的全部对象，结果缓存 USAGE_CACHE_TTL，refresh=true 时重新计算
+	r.GET("/usage", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		if groupBy := c.DefaultQuery("groupBy", "prefix"); groupBy != "prefix" {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid groupBy '%s', only 'prefix' is supported", groupBy),
+			})
+			return
+		}
+		prefix := c.Query("prefix")
+		delimiter := c.DefaultQuery("delimiter", "/")
+		if delimiter == "" {
+			respond(c, 400, gin.H{"status": "error", "message": "delimiter must not be empty"})
+			return
+		}
+		key := usageCacheKey(bucket.BucketName, prefix, delimiter)
+		report, hit := usage.get(key)
+		if !hit || c.Query("refresh") == "true" {
+			var err error
+			if report, err = computeUsage(bucket, prefix, delimiter, ossCtx(c)); err != nil {
+				log.Printf("Failed to compute usage: %v", err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Failed to compute usage: %s", err.Error()),
+				})
+				return
+			}
+			usage.put(key, report)
+			hit = false
+		}
+		if hit {
+			c.Header("X-Usage-Cache", "HIT")
+		} else {
+			c.Header("X-Usage-Cache", "MISS")
+		}
+		respond(c, 200, gin.H{
+			"status": "success",
+			"report": report,
+		})
+	})
+	// 列举 prefix 下带有标签 tag=key=value 的对象
+	// OSS 不能按标签列举，需要对 prefix 下的每个对象调用一次 GetObjectTagging（并发数 TAG_SCAN_CONCURRENCY），
+	// 对象很多时耗时长、请求费用高，应尽量用 prefix 缩小范围
+	r.GET("/list/by-tag", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		filter, err := parseTagFilter(c.Query("tag"))
+		if err != nil {
+			respond(c, 400, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		prefix := c.Query("prefix")
+		matches, scanned, err := findObjectsByTag(bucket, prefix, internalPrefixes, filter, cfg.TagScanConcurrency, ossCtx(c))
+		if err != nil {
+			log.Printf("Failed to list objects by tag %s: %v", filter, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to list objects by tag: %s", err.Error()),
+			})
+			return
+		}
+		items := make([]objectInfo, 0, len(matches))
+		for _, object := range matches {
+			items = append(items, toObjectInfo(object))
+		}
+		resp := listEnvelope(items, "", false)
+		resp["status"] = "success"
+		resp["tag"] = filter.String()
+		resp["prefix"] = prefix
+		resp["scanned"] = scanned
+		resp["matched"] = len(items)
+		respond(c, 200, resp)
+	})
+	r.GET("/list", func(c *gin.Context) {
+		lister := lister.forBucket(buckets.of(c))
+		// 排序方式：key、modified、size，加 "-" 前缀表示降序，默认按对象名升序
+		order := c.DefaultQuery("sort", "key")
+		if !listSortOrders[order] {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid sort order '%s'", order),
+			})
+			return
+		}
+		// prefix 只列举指定前缀下的对象；delimiter（通常为 "/"）把更深层的对象归并到 prefixes 中，用于按目录浏览
+		prefix := c.Query("prefix")
+		delimiter := c.Query("delimiter")
+		// minSize/maxSize（字节，闭区间）按大小过滤。OSS 不支持按大小列举，过滤在本服务中逐页进行，
+		// 因此仍然会扫描 prefix 下的全部对象，返回的 scanned 是扫描的对象数，matched 是满足条件的对象数
+		sizes, err := parseSizeFilter(c.Query("minSize"), c.Query("maxSize"))
+		if err != nil {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		// partitions 按分界点把键空间切成多个区间并行列举（见 listPartitioned），auto 表示按首字符划分，
+		// 也可以传逗号分隔的分界点（相对于 prefix）；只在对象名能被分界点分开时有效，不能与 delimiter 同时使用
+		var partitions []string
+		switch value := c.Query("partitions"); {
+		case value == "":
+		case delimiter != "":
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "partitions cannot be combined with delimiter",
+			})
+			return
+		case value == "auto":
+			partitions = defaultListPartitions
+		default:
+			partitions = strings.Split(value, ",")
+		}
+		// 配置了 LIST_SOFT_DEADLINE 时，到时仍未列举完就返回已有结果，partial 为 true，
+		// 带上返回的 cursor（或原始的 continuation）重新请求即可从中断处继续；此时排序只在每次返回的结果内进行
+		var deadline time.Time
+		if cfg.ListSoftDeadline > 0 {
+			deadline = time.Now().Add(cfg.ListSoftDeadline)
+		}
+		continuation := c.Query("continuation")
+		if continuation != "" && partitions != nil {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": "continuation cannot be combined with partitions",
+			})
+			return
+		}
+		// cursor 为上一次部分返回的续传游标（见 listCursor），列举参数取自游标，请求中的 prefix、delimiter、sort、minSize/maxSize 不再生效
+		if value := c.Query("cursor"); value != "" {
+			if continuation != "" || partitions != nil {
+				respond(c, 400, gin.H{
+					"status":  "error",
+					"message": "cursor cannot be combined with continuation or partitions",
+				})
+				return
+			}
+			cursor, err := decodeListCursor(value, cfg.ListCursorTTL, lister.useV2)
+			if err != nil {
+				respond(c, 400, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Invalid cursor: %s", err.Error()),
+				})
+				return
+			}
+			order, prefix, delimiter, sizes = cursor.Sort, cursor.Prefix, cursor.Delimiter, cursor.sizes()
+			continuation = cursor.Token
+		}
+		partial := false
+		scanned := 0
+		var allObjects []oss.ObjectProperties
+		var prefixes []string
+		hits, misses := 0, 0
+		collect := func(page listPage) {
+			// 打印列举结果。默认情况下，一次返回100条记录。
+			for _, object := range page.objects {
+				if cfg.ListHideDirectoryMarkers && isDirectoryMarker(object) {
+					continue
+				}
+				scanned++
+				if !sizes.match(object.Size) {
+					continue
+				}
+				allObjects = append(allObjects, object)
+			}
+			prefixes = append(prefixes, page.prefixes...)
+		}
+		if partitions != nil {
+			pages, h, m, err := listPartitioned(lister, prefix, partitions, cfg.ListConcurrency)
+			if err != nil {
+				log.Printf("Failed to list objects: %v", err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Failed to list objects: %s", err.Error()),
+				})
+				return
+			}
+			for _, page := range pages {
+				collect(page)
+			}
+			hits, misses = h, m
+		} else {
+			token := continuation
+			// 第一页总是等到返回为止，保证每次请求至少前进一页；之后的页受截止时间限制
+			var pageDeadline time.Time
+			for {
+				page, hit, timedOut, err := lister.pageBefore(pageDeadline, prefix, delimiter, token)
+				if timedOut {
+					partial, continuation = true, token
+					break
+				}
+				if err != nil {
+					log.Printf("Failed to list objects: %v", err)
+					respond(c, 500, gin.H{
+						"status":  "error",
+						"message": fmt.Sprintf("Failed to list objects: %s", err.Error()),
+					})
+					return
+				}
+				collect(page)
+				pageDeadline = deadline
+				if hit {
+					hits++
+				} else {
+					misses++
+				}
+
+				// 如果还有更多对象需要列举，则更新分页标记并继续循环。
+				if page.truncated {
+					token = page.next
+				} else {
+					break
+				}
+				// 页与页之间也检查截止时间，已取得的页不会丢弃
+				if !deadline.IsZero() && time.Now().After(deadline) {
+					partial, continuation = true, token
+					break
+				}
+			}
+		}
+		sortObjects(allObjects, order)
+		keys := make([]string, 0, len(allObjects))
+		items := make([]objectInfo, 0, len(allObjects))
+		for _, object := range allObjects {
+			keys = append(keys, object.Key)
+			items = append(items, toObjectInfo(object))
+		}
+
+		// 开启列举缓存时通过响应头说明结果来源：全部来自缓存为 HIT，部分为 PARTIAL，否则为 MISS
+		if listings != nil {
+			switch {
+			case misses == 0:
+				c.Header("X-List-Cache", "HIT")
+			case hits == 0:
+				c.Header("X-List-Cache", "MISS")
+			default:
+				c.Header("X-List-Cache", "PARTIAL")
+			}
+		}
+
+		log.Println("All objects have been listed.")
+		// 统一的分页结构；partial 时 nextMarker 即 continuation，带上它可以继续列举
+		resp := listEnvelope(items, "", false)
+		resp["status"] = "success"
+		resp["message"] = "All objects have been listed"
+		resp["objects"] = keys
+		resp["scanned"] = scanned
+		resp["matched"] = len(items)
+		if delimiter != "" {
+			resp["prefixes"] = prefixes
+		}
+		if partial {
+			resp["nextMarker"] = continuation
+			resp["isTruncated"] = true
+			resp["partial"] = true
+			resp["continuation"] = continuation
+			resp["cursor"] = listCursor{
+				Version:   listCursorVersion,
+				V2:        lister.useV2,
+				Token:     continuation,
+				Prefix:    prefix,
+				Delimiter: delimiter,
+				Sort:      order,
+				MinSize:   sizes.min,
+				MaxSize:   sizes.max,
+				IssuedAt:  time.Now().Unix(),
+			}.encode()
+			resp["message"] = "Listing stopped at the deadline, repeat with cursor to resume"
+		}
+		respond(c, 200, resp)
+
+	})
+	// 以 NDJSON 流式返回完整列举结果，每行一个对象（与 /list 的 items 字段相同），每取得一页就写出并刷新，
+	// 内存占用与对象总数无关；支持与 /list 相同的 prefix、delimiter、minSize/maxSize，delimiter 归并的目录输出为 {"prefix": ...}
+	// 响应开始后出错无法再返回状态码，最后一行输出 {"error": ...}，没有这一行即表示列举完整
+	r.GET("/list/ndjson", func(c *gin.Context) {
+		lister := lister.forBucket(buckets.of(c))
+		prefix := c.Query("prefix")
+		delimiter := c.Query("delimiter")
+		sizes, err := parseSizeFilter(c.Query("minSize"), c.Query("maxSize"))
+		if err != nil {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(200)
+		enc := json.NewEncoder(c.Writer)
+		ctx := c.Request.Context()
+		token := ""
+		for {
+			page, _, err := lister.page(prefix, delimiter, token)
+			if err != nil {
+				log.Printf("Failed to list objects: %v", err)
+				enc.Encode(gin.H{"error": fmt.Sprintf("Failed to list objects: %s", err.Error())})
+				return
+			}
+			for _, object := range page.objects {
+				if cfg.ListHideDirectoryMarkers && isDirectoryMarker(object) || !sizes.match(object.Size) {
+					continue
+				}
+				enc.Encode(toObjectInfo(object))
+			}
+			for _, p := range page.prefixes {
+				enc.Encode(gin.H{"prefix": p})
+			}
+			c.Writer.Flush()
+			if !page.truncated || ctx.Err() != nil {
+				return
+			}
+			token = page.next
+		}
+	})
+	// 以嵌套的目录树返回 prefix 下的目录和文件，供文件浏览器直接展示；每一层用 delimiter="/" 列举，
+	// maxDepth 默认且最大为 TREE_MAX_DEPTH，节点总数达到 TREE_MAX_NODES、列举次数达到 TREE_MAX_LIST_CALLS
+	// 或用时超过 TREE_TIMEOUT 时停止并返回 isTruncated=true；items 为顶层的目录和文件，tree 为完整的树
+	r.GET("/tree", func(c *gin.Context) {
+		lister := lister.forBucket(buckets.of(c))
+		prefix := c.Query("prefix")
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		maxDepth := cfg.TreeMaxDepth
+		if value := c.Query("maxDepth"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				respond(c, 400, gin.H{"status": "error", "message": fmt.Sprintf("invalid maxDepth %q", value)})
+				return
+			}
+			maxDepth = min(n, maxDepth)
+		}
+		limits := treeLimits{maxDepth: maxDepth, maxNodes: cfg.TreeMaxNodes, maxListCalls: cfg.TreeMaxListCalls}
+		if cfg.TreeTimeout > 0 {
+			limits.deadline = time.Now().Add(cfg.TreeTimeout)
+		}
+		tree, stats, err := buildTree(lister, prefix, limits, internalPrefixes)
+		if err != nil {
+			log.Printf("Failed to build tree for '%s': %v", prefix, err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to list objects: %s", err.Error()),
+			})
+			return
+		}
+		resp := listEnvelope(tree.Children, "", stats.Truncated)
+		resp["status"] = "success"
+		resp["prefix"] = prefix
+		resp["maxDepth"] = maxDepth
+		resp["nodes"] = stats.Nodes
+		resp["listCalls"] = stats.ListCalls
+		resp["truncated"] = stats.Truncated
+		resp["tree"] = tree
+		respond(c, 200, resp)
+	})
+	// 查询对象的元数据，包括缓存头和自定义元数据
+	r.GET("/meta/:object", func(c *gin.Context) {
+		reads := reads.forBucket(buckets.of(c))
+		objectName := c.Param("object")
+		var meta http.Header
+		readBucket, err := reads.run(c.Request.Context(), objectName, func(b *oss.Bucket) (err error) {
+			meta, err = b.GetObjectDetailedMeta(objectName, ossCtx(c))
+			return err
+		})
+		if isNoSuchKey(err) && cfg.CaseInsensitiveLookup {
+			if match := caseInsensitiveMatch(c, readBucket, objectName, cfg.CaseInsensitiveScanLimit); match != "" {
+				objectName = match
+				meta, err = readBucket.GetObjectDetailedMeta(objectName, ossCtx(c))
+			}
+		}
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, http.StatusNotFound, gin.H{
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
+			log.Printf("Failed to get object metadata: %v", err)
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to get object metadata"})
+			return
+		}
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
+		size, _ := strconv.ParseInt(meta.Get("Content-Length"), 10, 64)
+		respond(c, http.StatusOK, gin.H{
+			"object":       objectName,
+			"size":         size,
+			"contentType":  meta.Get("Content-Type"),
+			"etag":         normalizeETag(meta.Get("ETag")),
+			"lastModified": meta.Get("Last-Modified"),
+			"cacheControl": meta.Get("Cache-Control"),
+			"expires":      meta.Get("Expires"),
+			"sha256":       meta.Get(checksumMetaHeader),
+			"ttlExpiresAt": meta.Get(ttlMetaHeader),
+			"metadata":     userMetadata(meta),
+		})
+	})
+	// 批量查询一组已知对象的元数据（大小、类型、ETag、修改时间），不必重新列举；并发 HEAD，单个对象的错误记录在对应条目中
+	// private 对象只在携带 API_KEY 时返回元数据
+	r.POST("/meta/batch", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		var req struct {
+			Keys []string `json:"keys" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, 400, gin.H{
+				"message": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		if len(req.Keys) == 0 || len(req.Keys) > cfg.MetaBatchMaxKeys {
+			respond(c, 400, gin.H{
+				"message": fmt.Sprintf("keys must contain between 1 and %d objects", cfg.MetaBatchMaxKeys),
+			})
+			return
+		}
+		for _, key := range req.Keys {
+			if key == "" {
+				respond(c, 400, gin.H{
+					"message": "keys must not contain empty names",
+				})
+				return
+			}
+		}
+		readPrivate := cfg.APIKey != "" && tokenMatches(c, "X-API-Key", cfg.APIKey)
+		objects := batchObjectMeta(bucket, req.Keys, cfg.MetaBatchConcurrency, cfg.VisibilityMetaKey, readPrivate, ossCtx(c))
+		respond(c, http.StatusOK, gin.H{
+			"objects": objects,
+		})
+	})
+	// 小文件直接以 base64 放在 JSON 中返回，省去一次下载请求；超过 INLINE_MAX_SIZE 时返回 413，需改用 /download
+	r.GET("/inline/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object")
+		meta, err := bucket.GetObjectDetailedMeta(objectName, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, http.StatusNotFound, gin.H{
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
+			log.Printf("Failed to get object metadata: %v", err)
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to get object metadata"})
+			return
+		}
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
+		size, _ := strconv.ParseInt(meta.Get("Content-Length"), 10, 64)
+		tooLarge := gin.H{
+			"message":  fmt.Sprintf("Object '%s' is larger than %d bytes, use /download instead", objectName, cfg.InlineMaxSize),
+			"size":     size,
+			"download": "/download/" + url.PathEscape(objectName),
+		}
+		if size > cfg.InlineMaxSize {
+			respond(c, http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		}
+		body, err := bucket.GetObject(objectName, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, http.StatusNotFound, gin.H{
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
+			log.Printf("Failed to get object: %v", err)
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to get object"})
+			return
+		}
+		defer body.Close()
+		// 对象可能在读取元数据后被更大的内容覆盖，最多多读一个字节用于判断
+		data, err := io.ReadAll(io.LimitReader(body, cfg.InlineMaxSize+1))
+		if err != nil {
+			log.Printf("Failed to read object: %v", err)
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to read object"})
+			return
+		}
+		if int64(len(data)) > cfg.InlineMaxSize {
+			respond(c, http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		}
+		respond(c, http.StatusOK, gin.H{
+			"object":      objectName,
+			"size":        len(data),
+			"contentType": meta.Get("Content-Type"),
+			"etag":        normalizeETag(meta.Get("ETag")),
+			"encoding":    "base64",
+			"content":     base64.StdEncoding.EncodeToString(data),
+		})
+	})
+	// 只读取对象开头的 bytes 个字节（默认 4096，上限 PREVIEW_MAX_BYTES），用于查看大的文本或日志对象而不必完整下载
+	// 文本类对象直接返回文本，其余返回 base64；size 为对象总大小，truncated 表示是否还有未返回的内容
+	r.GET("/preview/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object")
+		n := min(int64(4096), cfg.PreviewMaxBytes)
+		if value := c.Query("bytes"); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed <= 0 {
+				respond(c, http.StatusBadRequest, gin.H{"message": fmt.Sprintf("invalid bytes %q", value)})
+				return
+			}
+			n = min(parsed, cfg.PreviewMaxBytes)
+		}
+		meta, err := bucket.GetObjectDetailedMeta(objectName, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, http.StatusNotFound, gin.H{
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
+			log.Printf("Failed to get object metadata: %v", err)
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to get object metadata"})
+			return
+		}
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
+		size, _ := strconv.ParseInt(meta.Get("Content-Length"), 10, 64)
+		var data []byte
+		if size > 0 {
+			// 以读取元数据时的 ETag 为条件，保证 size 与返回的内容属于同一个版本
+			body, err := bucket.GetObject(objectName, oss.Range(0, min(n, size)-1), oss.IfMatch(meta.Get("ETag")), ossCtx(c))
+			if err != nil {
+				if isNoSuchKey(err) || isPreconditionFailed(err) {
+					respond(c, http.StatusConflict, gin.H{
+						"message": fmt.Sprintf("Object '%s' changed while reading, please retry", objectName),
+					})
+					return
+				}
+				log.Printf("Failed to get object: %v", err)
+				respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to get object"})
+				return
+			}
+			defer body.Close()
+			data, err = io.ReadAll(io.LimitReader(body, n))
+			if err != nil {
+				log.Printf("Failed to read object: %v", err)
+				respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to read object"})
+				return
+			}
+		}
+		contentType := downloadContentType(meta, filepath.Ext(objectName))
+		encoding, content := previewContent(contentType, data, charsets)
+		respond(c, http.StatusOK, gin.H{
+			"object":      objectName,
+			"size":        size,
+			"bytes":       len(data),
+			"truncated":   int64(len(data)) < size,
+			"contentType": contentType,
+			"etag":        normalizeETag(meta.Get("ETag")),
+			"encoding":    encoding,
+			"content":     content,
+		})
+	})
+	// 比较客户端持有的 ETag 与服务端对象的 ETag，无需下载即可判断本地副本是否一致
+	// 注意：分片上传（Multipart）和追加上传（Appendable）生成的对象，其 ETag 并不是内容的 MD5，
+	// 客户端只能拿之前从服务端获取的 ETag 来比较，不能用本地计算的 MD5 代替
+	r.GET("/compare/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		objectName := c.Param("object")
+		etag := normalizeETag(c.Query("etag"))
+		if etag == "" {
+			respond(c, http.StatusBadRequest, gin.H{"message": "Missing etag query parameter"})
+			return
+		}
+		meta, err := bucket.GetObjectDetailedMeta(objectName, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, http.StatusNotFound, gin.H{
+					"message": fmt.Sprintf("Object '%s' does not exist", objectName),
+				})
+				return
+			}
+			log.Printf("Failed to get object metadata: %v", err)
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Failed to get object metadata"})
+			return
+		}
+		// ETag、大小和修改时间同样属于私有对象的信息
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
+		serverETag := normalizeETag(meta.Get("ETag"))
+		size, _ := strconv.ParseInt(meta.Get("Content-Length"), 10, 64)
+		objectType := meta.Get("X-Oss-Object-Type")
+		resp := gin.H{
+			"object":       objectName,
+			"match":        serverETag == etag,
+			"etag":         serverETag,
+			"size":         size,
+			"lastModified": meta.Get("Last-Modified"),
+			"objectType":   objectType,
+		}
+		if objectType != "" && objectType != "Normal" {
+			resp["note"] = "ETag of " + objectType + " objects is not the MD5 of the content"
+		}
+		respond(c, http.StatusOK, resp)
+	})
+	// 根据源对象的 Content-Type 分发到图片、音频或视频转码流程
+	r.GET("/invertcode/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		source := c.Param("object")
+		// 先确认源对象存在，避免创建注定失败的任务
+		meta, err := bucket.GetObjectDetailedMeta(source, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' does not exist", source),
+				})
+				return
+			}
+			log.Println("Error getting object:", err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to get object",
+			})
+			return
+		}
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
+		pipeline, ok := pipelineFor(meta.Get("Content-Type"), source)
+		if !ok {
+			respond(c, http.StatusUnsupportedMediaType, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("No transcode support for content type '%s'", meta.Get("Content-Type")),
+			})
+			return
+		}
+		if pipeline.needsFFmpeg && !transcodeOpts.ffmpegAvailable {
+			respond(c, http.StatusNotImplemented, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("%s transcoding is not available: ffmpeg is not installed", pipeline.kind),
+			})
+			return
+		}
+		format := strings.ToLower(c.DefaultQuery("format", pipeline.defaultFormat))
+		if !pipeline.formats[format] {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Unsupported target format '%s' for %s", format, pipeline.kind),
+			})
+			return
+		}
+		// 可选的 start、duration（秒）只转码其中一段作为预览，结果保存为单独的对象
+		// 有 ffprobe 时先通过签名地址读取媒体时长，片段超出范围返回 400
+		clip, err := parseMediaClip(c.Query("start"), c.Query("duration"))
+		if err != nil {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		if clip.active() && !pipeline.clippable {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("start/duration are not supported for %s", pipeline.kind),
+			})
+			return
+		}
+		if clip.active() && transcodeOpts.ffprobeAvailable {
+			probeURL, err := bucket.SignURL(source, oss.HTTPGet, 300)
+			if err != nil {
+				log.Printf("Failed to sign URL for %s: %v", source, err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": "Failed to read media duration",
+				})
+				return
+			}
+			total, err := probeDuration(c.Request.Context(), probeURL, transcodeOpts)
+			if err != nil {
+				log.Printf("Failed to probe %s: %v", source, err)
+				status := 500
+				if errors.Is(err, context.DeadlineExceeded) {
+					status = http.StatusGatewayTimeout
+				}
+				respond(c, status, gin.H{
+					"status":  "error",
+					"message": "Failed to read media duration",
+				})
+				return
+			}
+			if err := clip.within(total); err != nil {
+				respond(c, 400, gin.H{
+					"status":   "error",
+					"message":  err.Error(),
+					"duration": total,
+				})
+				return
+			}
+		}
+		// 转码耗时较长，放到后台执行，客户端通过 /jobs/:id 查询进度；队列已满时不创建任务，让客户端稍后重试
+		if !transcodes.reserve() {
+			c.Header("Retry-After", strconv.Itoa(max(1, int(cfg.TranscodeRetryAfter.Seconds()))))
+			respond(c, http.StatusTooManyRequests, gin.H{
+				"status":  "error",
+				"message": "Too many pending transcode jobs, please retry later",
+			})
+			return
+		}
+		job := jobs.create("transcode", source)
+		transcodes.submit(func() {
+			runTranscodeJob(bucket, jobs, job.ID, source, format, clip, pipeline, transcodeOpts)
+		})
+		respond(c, 202, gin.H{
+			"message": "invertcode job accepted",
+			"jobId":   job.ID,
+			"media":   pipeline.kind,
+			"output":  transcodeOutputKey(source, format, clip),
+		})
+	})
+	// 生成并返回图片缩略图，结果保存为 <原名>_<宽>x<高>.<扩展名>，之后同尺寸的请求直接返回已生成的对象
+	r.GET("/thumbnail/:object", func(c *gin.Context) {
+		bucket := buckets.of(c)
+		source := c.Param("object")
+		width, errW := strconv.Atoi(c.DefaultQuery("width", "200"))
+		height, errH := strconv.Atoi(c.DefaultQuery("height", "200"))
+		if errW != nil || errH != nil || width <= 0 || height <= 0 || width > maxThumbnailSize || height > maxThumbnailSize {
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("width and height must be between 1 and %d", maxThumbnailSize),
+			})
+			return
+		}
+		// format=datauri 返回 JSON，其中 dataUri 为 data:<类型>;base64,<内容>，便于直接嵌入页面
+		format := c.Query("format")
+		switch {
+		case format != "" && format != "datauri":
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid format '%s', only 'datauri' is supported", format),
+			})
+			return
+		case format == "datauri" && (width > maxDataURIThumbnailSize || height > maxDataURIThumbnailSize):
+			respond(c, 400, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("width and height must not exceed %d with format=datauri", maxDataURIThumbnailSize),
+			})
+			return
+		}
+		// 缩略图来自源对象的内容，按源对象的可见性检查权限（包括已缓存的缩略图）
+		meta, err := bucket.GetObjectDetailedMeta(source, ossCtx(c))
+		if err != nil {
+			if isNoSuchKey(err) {
+				respond(c, 404, gin.H{
+					"status":  "error",
+					"message": fmt.Sprintf("Object '%s' does not exist", source),
+				})
+				return
+			}
+			log.Println("Error getting object:", err)
+			respond(c, 500, gin.H{
+				"status":  "error",
+				"message": "Failed to get object",
+			})
+			return
+		}
+		if !allowObjectRead(c, meta, cfg.VisibilityMetaKey, cfg.APIKey) {
+			return
+		}
+		ext := thumbnailExt(source)
+		key := thumbnailKey(source, width, height, ext)
+		contentType := mime.TypeByExtension(ext)
+
+		data, err := getCachedThumbnail(bucket, key)
+		if err != nil {
+			log.Printf("Failed to read cached thumbnail: %v", err)
+		}
+		if data == nil {
+			body, err := bucket.GetObject(source, ossCtx(c))
+			if err != nil {
+				if isNoSuchKey(err) {
+					respond(c, 404, gin.H{
+						"status":  "error",
+						"message": fmt.Sprintf("Object '%s' does not exist", source),
+					})
+					return
+				}
+				log.Println("Error getting object:", err)
+				respond(c, 500, gin.H{
+					"status":  "error",
+					"message": "Failed to get object",
+				})
+				return
+			}
+			data, err = makeThumbnail(body, width, height, ext, transcodeOpts)
+			body.Close()
+			if err != nil {
+				status := 500
+				if errors.Is(err, errThumbnailTooLarge) {
+					status = http.StatusRequestEntityTooLarge
+				} else if !isRetryable(err) {
+					status = http.StatusUnsupportedMediaType
+				}
+				log.Printf("Failed to generate thumbnail for '%s': %v", source, err)
+				respond(c, status, gin.H{
+					"status":  "error",
+					"message": "Failed to generate thumbnail: " + err.Error(),
+				})
+				return
+			}
+			if err := bucket.PutObject(key, bytes.NewReader(data), oss.ContentType(contentType), derivedFromOption(source), ossCtx(c)); err == nil {
+				listings.invalidate(key)
+			} else {
+				// 保存失败不影响本次返回，下次请求会重新生成
+				log.Printf("Failed to store thumbnail '%s': %v", key, err)
+			}
+		}
+		if format == "datauri" {
+			respond(c, 200, gin.H{
+				"status":      "success",
+				"key":         key,
+				"contentType": contentType,
+				"size":        len(data),
+				"dataUri":     "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data),
+			})
+			return
+		}
+		c.Data(200, contentType, data)
+	})
+	// 查询异步任务的状态和重试历史
+	r.GET("/jobs/:id", func(c *gin.Context) {
+		job, ok := jobs.get(c.Param("id"))
+		if !ok {
+			respond(c, 404, gin.H{
+				"status":  "error",
+				"message": "Job not found",
+			})
+			return
+		}
+		respond(c, 200, job)
+	})
+	logStartupSummary(cfg, ":8080", transcodeOpts.ffmpegAvailable, r.Routes())
+	// 启动服务器，监听端口 8080；配置 TLS_CERT_FILE/TLS_KEY_FILE 时使用 HTTPS
+	if err := serve(ctx, ":8080", literalPlusPath(r), cfg.TLSCertFile, cfg.TLSKeyFile, cfg.ShutdownTimeout); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+	log.Println("Server stopped")
+}
+
+// 下载文件名模板支持的占位符
+var filenamePlaceholders = map[string]bool{
+	"key":       true, // 完整对象名，其中的 "/" 替换为 "_"
+	"basename":  true, // 对象名最后一段，不含扩展名
+	"timestamp": true, // Unix 时间戳（秒）
+	"random":    true, // 随机字符串
+	"ext":       true, // 扩展名（含 "."），没有扩展名时为 ".bin"
+}
+
+// 默认模板与之前固定的命名方式一致
+const defaultFilenameTemplate = "{timestamp}_{random}{ext}"
+
+// 检查模板中的占位符是否都受支持，以及花括号是否成对
+func validateFilenameTemplate(tmpl string) error {
+	rest := tmpl
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			break
+		}
+		if rest[open] == '}' {
+			return fmt.Errorf("unmatched '}' in filename template %q", tmpl)
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return fmt.Errorf("unmatched '{' in filename template %q", tmpl)
+		}
+		name := rest[open+1 : open+end]
+		if !filenamePlaceholders[name] {
+			return fmt.Errorf("unknown placeholder {%s} in filename template %q", name, tmpl)
+		}
+		rest = rest[open+end+1:]
+	}
+	if strings.TrimSpace(tmpl) == "" {
+		return fmt.Errorf("filename template must not be empty")
+	}
+	return nil
+}
+
+// 默认的随机字符串长度和字符集
+const (
+	defaultRandomNameLength  = 10
+	defaultRandomNameCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// filenameGenerator 按模板生成下载文件名，{random} 由 randomLength 个取自 randomCharset 的字符组成
+type filenameGenerator struct {
+	template      string
+	randomLength  int
+	randomCharset []rune
+}
+
+// 按模板生成下载文件名，模板需事先通过 validateFilenameTemplate 校验
+func (g filenameGenerator) generate(key, ext string) string {
+	base := path.Base(key)
+	replacer := strings.NewReplacer(
+		"{key}", strings.ReplaceAll(key, "/", "_"),
+		"{basename}", strings.TrimSuffix(base, path.Ext(base)),
+		"{timestamp}", strconv.FormatInt(time.Now().Unix(), 10),
+		"{random}", randomString(g.randomLength, g.randomCharset),
+		"{ext}", ext,
+	)
+	return replacer.Replace(g.template)
+}
+
+// 解析随机字符串的字符集：去掉重复的字符（重复会让某些字符出现得更频繁），
+// 不能为空，也不能包含控制字符和路径分隔符
+func parseRandomCharset(value string) ([]rune, error) {
+	var charset []rune
+	seen := make(map[rune]bool)
+	for _, r := range value {
+		if unicode.IsControl(r) || r == '/' || r == '\\' || r == utf8.RuneError {
+			return nil, fmt.Errorf("charset must not contain %q", r)
+		}
+		if !seen[r] {
+			seen[r] = true
+			charset = append(charset, r)
+		}
+	}
+	if len(charset) == 0 {
+		return nil, fmt.Errorf("charset must not be empty")
+	}
+	return charset, nil
+}
+
+// 顶层的 math/rand 函数自动播种且可以并发调用，不能在这里重新设置种子：
+// 并发请求在同一纳秒设置相同的种子会生成相同的文件名
+func randomString(length int, charset []rune) string {
+	filename := make([]rune, length)
+	for i := range filename {
+		filename[i] = charset[rand.Intn(len(charset))]
+	}
+	return string(filename)
+}
+
+// 解析 multipart 表单，并校验分段总数和非文件字段的大小
+// 返回值中的状态码仅在 err 不为 nil 时有意义
+func checkMultipartForm(req *http.Request, maxMemory int64, maxParts int, maxFieldSize int64) (int, error) {
+	if err := req.ParseMultipartForm(maxMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", maxBytesErr.Limit)
+		}
+		return http.StatusBadRequest, fmt.Errorf("invalid multipart form: %v", err)
+	}
+	form := req.MultipartForm
+	parts := 0
+	for _, values := range form.Value {
+		parts += len(values)
+	}
+	for _, files := range form.File {
+		parts += len(files)
+	}
+	if maxParts > 0 && parts > maxParts {
+		return http.StatusBadRequest, fmt.Errorf("too many form parts: %d (max %d)", parts, maxParts)
+	}
+	for name, values := range form.Value {
+		for _, value := range values {
+			if maxFieldSize > 0 && int64(len(value)) > maxFieldSize {
+				return http.StatusRequestEntityTooLarge, fmt.Errorf("form field '%s' exceeds %d bytes", name, maxFieldSize)
+			}
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// 破坏性操作的两步确认，返回 true 时调用方继续执行
+// 未带 confirmToken 时统计将受影响的对象，返回影响说明和一次性确认令牌（状态 409）；
+// 调用方在令牌过期前带上 confirmToken=<令牌> 重复同一请求才会真正执行，令牌无效或过期时返回 400
+func confirmDestructive(c *gin.Context, store *confirmationStore, bucket *oss.Bucket, operation, prefix string) bool {
+	return confirmOperation(c, store, bucket, operation, prefix, fmt.Sprintf("under '%s'", prefix), func() (int, []string, error) {
+		return deleteByPrefix(bucket, prefix, true)
+	})
+}
+
+// 与 confirmDestructive 相同，影响范围由 scope 标识、describe 描述，preview 统计将被删除的对象数量和样例
+func confirmOperation(c *gin.Context, store *confirmationStore, bucket *oss.Bucket, operation, scope, describe string, preview func() (int, []string, error)) bool {
+	// 令牌同时绑定存储桶，不能拿一个存储桶的令牌确认另一个存储桶上的操作
+	scope = bucket.BucketName + "/" + scope
+	token := c.Query("confirmToken")
+	if token != "" {
+		if store.consume(token, operation, scope) {
+			return true
+		}
+		respond(c, 400, gin.H{
+			"status":  "error",
+			"message": "Invalid or expired confirmation token, repeat the request without confirmToken to get a new one",
+		})
+		return false
+	}
+	count, sample, err := preview()
+	if err != nil {
+		respond(c, 500, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to count objects: %s", err.Error()),
+		})
+		return false
+	}
+	token, expires := store.issue(operation, scope)
+	respond(c, 409, gin.H{
+		"status":       "confirmation_required",
+		"message":      fmt.Sprintf("This will delete %d object(s) %s, repeat the request with confirmToken to proceed", count, describe),
+		"count":        count,
+		"sample":       sample,
+		"confirmToken": token,
+		"expiresAt":    expires.UTC(),
+	})
+	return false
+}
+
+// 分页列举前缀下的所有对象，并以每批 1000 个的方式调用 DeleteObjects 删除
+// dryRun 时只统计数量，同时返回最多 100 个对象名作为预览
+// 出错时返回已经删除的数量，方便调用方了解进度
+func deleteByPrefix(bucket *oss.Bucket, prefix string, dryRun bool) (int, []string, error) {
+	const sampleSize = 100
+	count := 0
+	var sample []string
+	marker := ""
+	for {
+		lsRes, err := bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000))
+		if err != nil {
+			return count, sample, err
+		}
+		keys := make([]string, 0, len(lsRes.Objects))
+		for _, object := range lsRes.Objects {
+			keys = append(keys, object.Key)
+		}
+		if dryRun {
+			for _, key := range keys {
+				if len(sample) < sampleSize {
+					sample = append(sample, key)
+				}
+			}
+			count += len(keys)
+		} else if len(keys) > 0 {
+			delRes, err := bucket.DeleteObjects(keys)
+			if err != nil {
+				return count, sample, err
+			}
+			count += len(delRes.DeletedObjects)
+		}
+		if !lsRes.IsTruncated {
+			return count, sample, nil
+		}
+		marker = lsRes.NextMarker
+	}
+}
+
+// 设置下载响应的公共头：文件名、类型，以及上传时设置的缓存头
+func setDownloadHeaders(c *gin.Context, meta http.Header, filename, ext string, inline, charsets inlineTypes) {
+	c.Header("Content-Disposition", contentDisposition(inline.disposition(meta.Get("Content-Type")), filename))
+	c.Header("Content-Type", withCharset(downloadContentType(meta, ext), meta, charsets)) // 存储的类型优先，文本类补充字符集
+	// 上传时设置的缓存头和内容编码原样返回；已有 Content-Encoding 的对象不应再被压缩
+	for _, name := range []string{"Cache-Control", "Expires", "Content-Encoding"} {
+		if value := meta.Get(name); value != "" {
+			c.Header(name, value)
+		}
+	}
+}
+
+// 禁止浏览器、代理和 CDN 缓存响应，覆盖对象上存储的 Cache-Control 和 Expires
+// ETag 附加时间戳，使每次响应都不同，客户端带着旧 ETag 的条件请求不会得到 304
+func setNoCacheHeaders(c *gin.Context, etag string) {
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("Expires", "0")
+	c.Header("Surrogate-Control", "no-store")
+	c.Header("ETag", fmt.Sprintf("\"%s-%d\"", normalizeETag(etag), time.Now().UnixNano()))
+}
+
+// 上传时可以指定的对象 ACL，default 表示继承存储桶的 ACL
+var objectACLs = map[string]oss.ACLType{
+	"default":           oss.ACLDefault,
+	"private":           oss.ACLPrivate,
+	"public-read":       oss.ACLPublicRead,
+	"public-read-write": oss.ACLPublicReadWrite,
+}
+
+// 上传时允许声明的内容编码，多个编码用逗号分隔（按应用顺序）
+var contentEncodings = map[string]bool{
+	"gzip": true, "br": true, "deflate": true, "zstd": true, "compress": true, "identity": true,
+}
+
+func validContentEncoding(value string) bool {
+	for _, coding := range strings.Split(value, ",") {
+		if !contentEncodings[strings.ToLower(strings.TrimSpace(coding))] {
+			return false
+		}
+	}
+	return true
+}
+
+// 带取消检查的流式拷贝：请求 context 被取消后立即停止，不再继续从 src 读取
+func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			w, writeErr := dst.Write(buf[:n])
+			written += int64(w)
+			if writeErr != nil {
+				return written, writeErr
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
+
+// 优先读取表单字段，没有时再读取查询参数
+func formOrQuery(c *gin.Context, name string) string {
+	if value := c.PostForm(name); value != "" {
+		return value
+	}
+	return c.Query(name)
+}
+
+// 解析 Expires 参数：既可以是 HTTP 日期（如 "Wed, 21 Oct 2026 07:28:00 GMT"），
+// 也可以是相对当前时间的时长（如 "24h"）
+func parseExpiresHeader(value string, now time.Time) (time.Time, error) {
+	if t, err := http.ParseTime(value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expires value %q: must be an HTTP date or a positive duration", value)
+}
+
+// 从响应头中提取自定义元数据（x-oss-meta-*），返回的键名为小写且不含前缀
+func userMetadata(header http.Header) map[string]string {
+	const prefix = "X-Oss-Meta-"
+	meta := make(map[string]string)
+	for name, values := range header {
+		if strings.HasPrefix(name, prefix) && len(values) > 0 {
+			meta[strings.ToLower(strings.TrimPrefix(name, prefix))] = values[0]
+		}
+	}
+	return meta
+}
+
+// 把对象的类型、缓存头和自定义元数据转换成写入选项，用于生成新对象（分片合并、REPLACE 复制）时保留原有信息
+// exclude 中列出的自定义元数据（小写、不带 x-oss-meta- 前缀）不保留
+func objectHeaderOptions(meta http.Header, exclude ...string) []oss.Option {
+	var options []oss.Option
+	for name, option := range map[string]func(string) oss.Option{
+		"Content-Type":        oss.ContentType,
+		"Cache-Control":       oss.CacheControl,
+		"Content-Disposition": oss.ContentDisposition,
+		"Content-Encoding":    oss.ContentEncoding,
+	} {
+		if value := meta.Get(name); value != "" {
+			options = append(options, option(value))
+		}
+	}
+	if expires, err := http.ParseTime(meta.Get("Expires")); err == nil {
+		options = append(options, oss.Expires(expires))
+	}
+	for name, value := range userMetadata(meta) {
+		if !slices.Contains(exclude, name) {
+			options = append(options, oss.Meta(name, value))
+		}
+	}
+	return options
+}
+
+// 解析 /copy 的元数据指令，返回规范化的指令和对应的复制选项
+// COPY 时不允许同时指定 contentType 或 metadata，避免调用方误以为它们会生效
+func copyMetadataOptions(directive, contentType string, metadata map[string]string) (string, []oss.Option, error) {
+	switch directive = strings.ToUpper(directive); directive {
+	case "", string(oss.MetaCopy):
+		if contentType != "" || len(metadata) > 0 {
+			return "", nil, fmt.Errorf("contentType and metadata require metadataDirective REPLACE")
+		}
+		return string(oss.MetaCopy), nil, nil
+	case string(oss.MetaReplace):
+	default:
+		return "", nil, fmt.Errorf("invalid metadataDirective %q, must be COPY or REPLACE", directive)
+	}
+	options := []oss.Option{oss.MetadataDirective(oss.MetaReplace)}
+	if contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil || !validHeaderValue(contentType) {
+			return "", nil, fmt.Errorf("invalid contentType %q", contentType)
+		}
+		options = append(options, oss.ContentType(contentType))
+	}
+	for name, value := range metadata {
+		if !validMetaName(name) {
+			return "", nil, fmt.Errorf("invalid metadata name %q, only letters, digits and '-' are allowed", name)
+		}
+		if !validHeaderValue(value) {
+			return "", nil, fmt.Errorf("invalid value for metadata %q", name)
+		}
+		options = append(options, oss.Meta(strings.ToLower(name), value))
+	}
+	return string(oss.MetaReplace), options, nil
+}
+
+// 自定义元数据名会成为 x-oss-meta-<name> 请求头的一部分
+func validMetaName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// 精确的对象名不存在时按忽略大小写查找，返回匹配到的对象名，没有唯一匹配时返回空字符串
+// 查找出错只记录日志，按对象不存在处理
+func caseInsensitiveMatch(c *gin.Context, bucket *oss.Bucket, objectName string, limit int) string {
+	match, err := findCaseInsensitiveKey(bucket, objectName, limit, ossCtx(c))
+	if err != nil {
+		log.Printf("Failed to look up %s case-insensitively: %v", objectName, err)
+		return ""
+	}
+	if match != "" {
+		log.Printf("Resolved %s to %s by case-insensitive lookup", objectName, match)
+	}
+	return match
+}
+
+// 从错误中取出 OSS 服务端错误；SDK 返回的是值类型，这里同时兼容指针类型
+func asServiceError(err error) (oss.ServiceError, bool) {
+	var ossErr oss.ServiceError
+	if errors.As(err, &ossErr) {
+		return ossErr, true
+	}
+	var ossErrPtr *oss.ServiceError
+	if errors.As(err, &ossErrPtr) {
+		return *ossErrPtr, true
+	}
+	return oss.ServiceError{}, false
+}
+
+// 判断 OSS 返回的错误是否为对象不存在
+func isNoSuchKey(err error) bool {
+	ossErr, ok := asServiceError(err)
+	return ok && (ossErr.Code == "NoSuchKey" || (ossErr.Code == "" && ossErr.StatusCode == http.StatusNotFound))
+}
+
+// 判断 OSS 返回的错误是否为禁止覆盖时目标对象已存在
+func isAlreadyExists(err error) bool {
+	ossErr, ok := asServiceError(err)
+	return ok && (ossErr.Code == "FileAlreadyExists" || ossErr.StatusCode == http.StatusConflict)
+}
+
+// 判断 OSS 返回的错误是否为前置条件（If-Match 等）不满足
+func isPreconditionFailed(err error) bool {
+	ossErr, ok := asServiceError(err)
+	return ok && (ossErr.Code == "PreconditionFailed" || ossErr.StatusCode == http.StatusPreconditionFailed)
+}
+
+// 统一 ETag 格式：去掉引号和弱校验前缀，并转为大写
+func normalizeETag(etag string) string {
+	etag = strings.TrimSpace(etag)
+	etag = strings.TrimPrefix(etag, "W/")
+	return strings.ToUpper(strings.Trim(etag, "\""))
+}
+
+// 判断 If-Match 请求头是否与对象当前的 ETag 匹配：可以是逗号分隔的多个 ETag，"*" 匹配任何已存在的对象
+// 每个候选值单独去掉前后空格和弱校验前缀 W/ 后比较，客户端带回弱校验形式的 ETag 时同样匹配；空的候选值不匹配任何对象
+func etagMatches(ifMatch, etag string) bool {
+	current := normalizeETag(etag)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" {
+			return true
+		}
+		if candidate = normalizeETag(candidate); candidate != "" && candidate == current {
+			return true
 		}
-		fmt.Println(".env file created with default values.")
-	} else {
-		fmt.Println(".env file already exists.")
 	}
+	return false
 }
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseRandomCharset(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"abc", "abc", false},
+		{"aabbcc", "abc", false},
+		{"0123456789abcdef0123", "0123456789abcdef", false},
+		{"中文字符中", "中文字符", false},
+		{"", "", true},
+		{"ab/c", "", true},
+		{`ab\c`, "", true},
+		{"ab\nc", "", true},
+		{"ab\x00c", "", true},
+		{"ab\xffc", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseRandomCharset(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRandomCharset(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("parseRandomCharset(%q) = %q, want %q", tt.value, string(got), tt.want)
+		}
+	}
+}
+
+func TestRandomString(t *testing.T) {
+	tests := []struct {
+		length  int
+		charset string
+	}{
+		{defaultRandomNameLength, defaultRandomNameCharset},
+		{1, "x"},
+		{32, "0123456789abcdef"},
+		{64, "中文"},
+	}
+	for _, tt := range tests {
+		charset, err := parseRandomCharset(tt.charset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := randomString(tt.length, charset)
+		if n := len([]rune(got)); n != tt.length {
+			t.Errorf("randomString(%d, %q) has %d characters", tt.length, tt.charset, n)
+		}
+		for _, r := range got {
+			if !strings.ContainsRune(tt.charset, r) {
+				t.Errorf("randomString(%d, %q) = %q contains %q outside the charset", tt.length, tt.charset, got, r)
+			}
+		}
+	}
+}
+
+func TestFilenameGeneratorRandom(t *testing.T) {
+	g := filenameGenerator{template: "{random}{ext}", randomLength: 6, randomCharset: []rune("01")}
+	got := g.generate("dir/report.pdf", ".pdf")
+	if !strings.HasSuffix(got, ".pdf") || len(got) != 6+len(".pdf") || strings.Trim(strings.TrimSuffix(got, ".pdf"), "01") != "" {
+		t.Errorf("generate = %q, want 6 characters from \"01\" followed by .pdf", got)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"5EB63BBBE01EEED093CB22BB8F5ACDC3"`
+	tests := []struct {
+		name, ifMatch string
+		want          bool
+	}{
+		{"exact", `"5EB63BBBE01EEED093CB22BB8F5ACDC3"`, true},
+		{"lower case", `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, true},
+		{"unquoted", `5EB63BBBE01EEED093CB22BB8F5ACDC3`, true},
+		{"weak", `W/"5EB63BBBE01EEED093CB22BB8F5ACDC3"`, true},
+		{"weak with leading space", `  W/"5EB63BBBE01EEED093CB22BB8F5ACDC3"`, true},
+		{"second of list", `"0000", W/"5EB63BBBE01EEED093CB22BB8F5ACDC3"`, true},
+		{"star", `*`, true},
+		{"star in list", `"0000", *`, true},
+		{"mismatch", `"0000"`, false},
+		{"weak mismatch", `W/"0000"`, false},
+		{"mismatch list", `"0000", "1111"`, false},
+		{"empty", ``, false},
+		{"empty candidates", ` , `, false},
+		{"W/ inside quotes is not a prefix", `"W/5EB63BBBE01EEED093CB22BB8F5ACDC3"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifMatch, etag); got != tt.want {
+			t.Errorf("%s: etagMatches(%q) = %v, want %v", tt.name, tt.ifMatch, got, tt.want)
+		}
+	}
+}
+
+// 与 main 中的路由设置一致：按原始路径匹配，参数只解码一次；服务时需用 literalPlusPath 包装
+func newRawPathRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.UseRawPath = true
+	return r
+}
+
+// 对象名按路径规则编码一次（"/" 编码为 %2F）后上传，再用同样编码的地址下载，对象名和内容都应原样往返
+func TestObjectRouteEncoding(t *testing.T) {
+	fake := newFakeOSS(t)
+	bucket := fake.bucket(t)
+	r := newRawPathRouter()
+	r.PUT("/upload/:object", func(c *gin.Context) {
+		if err := bucket.PutObject(c.Param("object"), c.Request.Body); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, c.Param("object"))
+	})
+	r.GET("/download/:object", func(c *gin.Context) {
+		body, err := bucket.GetObject(c.Param("object"))
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+		defer body.Close()
+		c.Status(http.StatusOK)
+		io.Copy(c.Writer, body)
+	})
+	server := httptest.NewServer(literalPlusPath(r))
+	defer server.Close()
+
+	keys := []string{
+		"plain.txt",
+		"a+b.txt",
+		"+%2B+",
+		"a b.txt",
+		"a%20b.txt",
+		"a%2520b.txt",
+		"100%.txt",
+		"dir/sub/file.txt",
+		"a%2Fb",
+		"dir/a b+c.txt",
+		"中文 文件.txt",
+		"a?b#c.txt",
+		"a;b=c,d&e.txt",
+		"~user/@x:y.txt",
+	}
+	for _, key := range keys {
+		t.Run(key, func(t *testing.T) {
+			content := []byte("content of " + key)
+			req, _ := http.NewRequest(http.MethodPut, server.URL+"/upload/"+url.PathEscape(key), bytes.NewReader(content))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || string(got) != key {
+				t.Fatalf("upload: status %d, route parameter %q, want %q", resp.StatusCode, got, key)
+			}
+			if _, ok := fake.object(key); !ok {
+				t.Fatalf("object %q was not stored under its exact name", key)
+			}
+			resp, err = http.Get(server.URL + "/download/" + url.PathEscape(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || !bytes.Equal(got, content) {
+				t.Errorf("download: status %d, body %q, want %q", resp.StatusCode, got, content)
+			}
+		})
+	}
+}
+
+// 同一个对象名的不同写法：路径中的 "+" 是字面的加号，%2B 解码为加号，%252F 只解码一次
+func TestObjectRouteDecoding(t *testing.T) {
+	r := newRawPathRouter()
+	r.GET("/download/:object", func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("object"))
+	})
+	tests := []struct {
+		path, want string
+	}{
+		{"/download/a+b", "a+b"},
+		{"/download/a%2Bb", "a+b"},
+		{"/download/dir%2Fa+b", "dir/a+b"},
+		{"/download/a%20b", "a b"},
+		{"/download/dir%2Ffile", "dir/file"},
+		{"/download/a%252Fb", "a%2Fb"},
+		{"/download/100%25.txt", "100%.txt"},
+		{"/download/%E4%B8%AD", "中"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		literalPlusPath(r).ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Body.String() != tt.want {
+			t.Errorf("GET %s: status %d, parameter %q, want %q", tt.path, w.Code, w.Body.String(), tt.want)
+		}
+	}
+}
+
+// 以 image/png 上传的 PNG 下载时返回 image/png，与对象名的扩展名无关
+func TestDownloadKeepsStoredPNGContentType(t *testing.T) {
+	fake := newFakeOSS(t)
+	bucket := fake.bucket(t)
+	data := pngBytes(t, 1, 1)
+	inline := parseInlineTypes(defaultInlineContentTypes)
+	charsets := parseInlineTypes(defaultCharsetContentTypes)
+	for _, key := range []string{"photo.png", "photo.bin", "photo.txt", "photo"} {
+		if err := bucket.PutObject(key, bytes.NewReader(data), oss.ContentType("image/png")); err != nil {
+			t.Fatalf("PutObject %s: %v", key, err)
+		}
+		meta, err := bucket.GetObjectDetailedMeta(key)
+		if err != nil {
+			t.Fatalf("GetObjectDetailedMeta %s: %v", key, err)
+		}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		// 与 /download 一样，没有扩展名时按 .bin 处理
+		ext := path.Ext(key)
+		if ext == "" {
+			ext = ".bin"
+		}
+		setDownloadHeaders(c, meta, key, ext, inline, charsets)
+		if got := w.Header().Get("Content-Type"); got != "image/png" {
+			t.Errorf("%s: Content-Type = %q, want image/png", key, got)
+		}
+		if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "inline") {
+			t.Errorf("%s: Content-Disposition = %q, want inline", key, got)
+		}
+	}
+}
+
+// 下载前的 HEAD 和 GET：对象不存在时 isNoSuchKey 为 true（返回 404），OSS 出错或连不上时为 false（返回 500）
+func TestIsNoSuchKey(t *testing.T) {
+	fake := newFakeOSS(t)
+	bucket := fake.bucket(t)
+	fake.put("exists.txt", []byte("x"), nil)
+
+	_, err := bucket.GetObjectDetailedMeta("missing.txt")
+	if !isNoSuchKey(err) {
+		t.Errorf("HEAD of a missing object: isNoSuchKey(%v) = false", err)
+	}
+	_, err = bucket.GetObject("missing.txt")
+	if !isNoSuchKey(err) {
+		t.Errorf("GET of a missing object: isNoSuchKey(%v) = false", err)
+	}
+	if _, err := bucket.GetObjectDetailedMeta("exists.txt"); err != nil || isNoSuchKey(err) {
+		t.Errorf("HEAD of an existing object: err = %v", err)
+	}
+
+	fake.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		fakeError(w, http.StatusInternalServerError, "InternalError")
+		return false
+	}
+	for _, key := range []string{"missing.txt", "exists.txt"} {
+		if _, err := bucket.GetObjectDetailedMeta(key); err == nil || isNoSuchKey(err) {
+			t.Errorf("HEAD %s on a failing backend: err = %v, want an error other than NoSuchKey", key, err)
+		}
+		if _, err := bucket.GetObject(key); err == nil || isNoSuchKey(err) {
+			t.Errorf("GET %s on a failing backend: err = %v, want an error other than NoSuchKey", key, err)
+		}
+	}
+
+	fake.server.Close()
+	if _, err := bucket.GetObjectDetailedMeta("missing.txt"); err == nil || isNoSuchKey(err) {
+		t.Errorf("unreachable backend: err = %v, want an error other than NoSuchKey", err)
+	}
+}
+
+// 预先压缩的文件以 contentEncoding=gzip 上传后，下载时原样返回 Content-Encoding，且不会再次压缩
+func TestContentEncodingRoundTrip(t *testing.T) {
+	fake := newFakeOSS(t)
+	server := httptest.NewServer(newUploadRouter(t, fake, &Config{}))
+	defer server.Close()
+	bucket := fake.bucket(t)
+	gzipOpts := downloadGzip{enabled: true, minSize: 0, level: 6}
+
+	tests := []struct {
+		name, encoding string
+		wantStatus     int
+	}{
+		{"gzip", "gzip", http.StatusOK},
+		{"br", "br", http.StatusOK},
+		{"multiple codings", "gzip, br", http.StatusOK},
+		{"unsupported", "rot13", http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := fmt.Sprintf("asset-%d.js", i)
+			query := url.Values{"contentEncoding": {tt.encoding}}
+			req, _ := http.NewRequest(http.MethodPut, server.URL+"/upload/"+key+"?"+query.Encode(), strings.NewReader("compressed bytes"))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("upload status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			meta, err := bucket.GetObjectDetailedMeta(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			setDownloadHeaders(c, meta, key, ".js", parseInlineTypes(defaultInlineContentTypes), parseInlineTypes(defaultCharsetContentTypes))
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("download Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if gzipOpts.applies("gzip", meta.Get("Content-Encoding"), "application/javascript", 1<<20) {
+				t.Errorf("an object stored with Content-Encoding %q would be compressed again", tt.encoding)
+			}
+		})
+	}
+}
+
+// 构造 multipart 请求，和 /upload 一样先用 MaxBytesReader 限制请求体大小
+func multipartRequest(t *testing.T, fields map[string][]string, files map[string]string, maxBody int64) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, values := range fields {
+		for _, value := range values {
+			if err := writer.WriteField(name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for name, content := range files {
+		part, err := writer.CreateFormFile(name, name+".bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if maxBody > 0 {
+		req.Body = http.MaxBytesReader(httptest.NewRecorder(), req.Body, maxBody)
+	}
+	return req
+}
+
+func TestCheckMultipartForm(t *testing.T) {
+	const (
+		maxMemory    = 1 << 10
+		maxParts     = 4
+		maxFieldSize = 64
+		maxBody      = 4 << 10
+	)
+	manyFields := map[string][]string{"field": make([]string, maxParts+1)}
+	tests := []struct {
+		name       string
+		fields     map[string][]string
+		files      map[string]string
+		wantStatus int
+	}{
+		{"valid form", map[string][]string{"prefix": {"docs"}}, map[string]string{"file": "hello"}, http.StatusOK},
+		{"parts at limit", map[string][]string{"a": {"1", "2"}, "b": {"3"}}, map[string]string{"file": "x"}, http.StatusOK},
+		{"too many parts", manyFields, nil, http.StatusBadRequest},
+		{"too many parts counting files", map[string][]string{"a": {"1", "2", "3", "4"}}, map[string]string{"file": "x"}, http.StatusBadRequest},
+		{"field at limit", map[string][]string{"prefix": {strings.Repeat("a", maxFieldSize)}}, nil, http.StatusOK},
+		{"oversized field", map[string][]string{"prefix": {strings.Repeat("a", maxFieldSize+1)}}, nil, http.StatusRequestEntityTooLarge},
+		{"oversized body", nil, map[string]string{"file": strings.Repeat("x", maxBody)}, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := multipartRequest(t, tt.fields, tt.files, maxBody)
+			status, err := checkMultipartForm(req, maxMemory, maxParts, maxFieldSize)
+			if status != tt.wantStatus {
+				t.Fatalf("checkMultipartForm() = %d, %v, want %d", status, err, tt.wantStatus)
+			}
+			if (err == nil) != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("checkMultipartForm() error = %v with status %d", err, status)
+			}
+		})
+	}
+}
+
+func TestCheckMultipartFormMalformed(t *testing.T) {
+	tests := []struct {
+		name, contentType, body string
+	}{
+		{"not multipart", "application/json", `{"file":"x"}`},
+		{"missing boundary", "multipart/form-data", "--x\r\n\r\n"},
+		{"truncated body", "multipart/form-data; boundary=x", "--x\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nvalue"},
+		{"header without blank line", "multipart/form-data; boundary=x", "--x\r\nContent-Disposition: form-data; name=\"a\"\r\n" + strings.Repeat("X-Padding: y\r\n", 20000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if status, err := checkMultipartForm(req, 1<<10, 4, 64); status != http.StatusBadRequest || err == nil {
+				t.Errorf("checkMultipartForm() = %d, %v, want %d", status, err, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// manifestEntry 清单中的一行（NDJSON），用于备份核对
+type manifestEntry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// 清单对象名：<manifestPrefix><UTC 时间戳>.ndjson
+func manifestKey(manifestPrefix string, now time.Time) string {
+	return manifestPrefix + now.UTC().Format("20060102T150405Z") + ".ndjson"
+}
+
+// 后台生成清单：分页列举 prefix 下的所有对象写入临时文件，完成后上传到 key
+// 之前生成的清单（manifestPrefix 下的对象）不计入清单
+func runManifestJob(bucket *oss.Bucket, jobs *jobStore, id, prefix, manifestPrefix, key string) {
+	jobs.update(id, func(job *Job) {
+		job.Status = JobRunning
+		job.Attempts = append(job.Attempts, JobAttempt{Number: 1, StartedAt: time.Now()})
+	})
+	count, err := buildManifest(bucket, prefix, manifestPrefix, key)
+	jobs.update(id, func(job *Job) {
+		job.Attempts[len(job.Attempts)-1].FinishedAt = time.Now()
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			job.Attempts[len(job.Attempts)-1].Error = err.Error()
+			return
+		}
+		job.Status = JobSucceeded
+		job.Output = key
+	})
+	if err != nil {
+		log.Printf("Manifest job %s failed: %v", id, err)
+		return
+	}
+	log.Printf("Manifest job %s wrote %d object(s) to %s", id, count, key)
+}
+
+func buildManifest(bucket *oss.Bucket, prefix, manifestPrefix, key string) (int, error) {
+	tmp, err := os.CreateTemp("", "manifest-*.ndjson")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	count := 0
+	marker := ""
+	for {
+		res, err := bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000))
+		if err != nil {
+			return count, fmt.Errorf("failed to list objects: %v", err)
+		}
+		for _, object := range res.Objects {
+			if strings.HasPrefix(object.Key, manifestPrefix) {
+				continue
+			}
+			entry := manifestEntry{
+				Key:          object.Key,
+				Size:         object.Size,
+				ETag:         normalizeETag(object.ETag),
+				LastModified: object.LastModified,
+			}
+			if err := enc.Encode(entry); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if !res.IsTruncated {
+			break
+		}
+		marker = res.NextMarker
+	}
+	if err := w.Flush(); err != nil {
+		return count, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return count, err
+	}
+	if err := bucket.PutObject(key, tmp, oss.ContentType("application/x-ndjson")); err != nil {
+		return count, fmt.Errorf("failed to upload manifest: %v", err)
+	}
+	return count, nil
+}
+
+// 读取清单对象中的所有条目
+func readManifest(bucket *oss.Bucket, key string) ([]manifestEntry, error) {
+	body, err := bucket.GetObject(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var entries []manifestEntry
+	dec := json.NewDecoder(body)
+	for {
+		var entry manifestEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: %v", key, err)
+		}
+		entries = append(entries, entry)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// objectMetaEntry POST /meta/batch 中一个对象的结果；查询失败时只有 key、status 和 error
+type objectMetaEntry struct {
+	Key          string `json:"key"`
+	Status       int    `json:"status"`
+	Size         *int64 `json:"size,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// 并发 HEAD 每个对象，返回与 keys 一一对应的结果；单个对象出错不影响其他对象
+// readPrivate 为 false 时标记为 private 的对象只返回 403，不暴露其元数据
+func batchObjectMeta(bucket *oss.Bucket, keys []string, workers int, visibilityMetaKey string, readPrivate bool, options ...oss.Option) []objectMetaEntry {
+	entries := make([]objectMetaEntry, len(keys))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(keys)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				entries[i] = headObjectMeta(bucket, keys[i], visibilityMetaKey, readPrivate, options...)
+			}
+		}()
+	}
+	for i := range keys {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return entries
+}
+
+func headObjectMeta(bucket *oss.Bucket, key, visibilityMetaKey string, readPrivate bool, options ...oss.Option) objectMetaEntry {
+	entry := objectMetaEntry{Key: key}
+	meta, err := bucket.GetObjectDetailedMeta(key, options...)
+	switch {
+	case isNoSuchKey(err):
+		entry.Status, entry.Error = http.StatusNotFound, "object does not exist"
+		return entry
+	case err != nil:
+		log.Printf("Failed to get object metadata for %s: %v", key, err)
+		entry.Status, entry.Error = http.StatusInternalServerError, "failed to get object metadata"
+		return entry
+	}
+	if !readPrivate && strings.ToLower(meta.Get(oss.HTTPHeaderOssMetaPrefix+visibilityMetaKey)) == visibilityPrivate {
+		entry.Status, entry.Error = http.StatusForbidden, "object is private, a valid API key is required"
+		return entry
+	}
+	size, _ := strconv.ParseInt(meta.Get("Content-Length"), 10, 64)
+	entry.Status = http.StatusOK
+	entry.Size = &size
+	entry.ContentType = meta.Get("Content-Type")
+	entry.ETag = normalizeETag(meta.Get("ETag"))
+	entry.LastModified = meta.Get("Last-Modified")
+	return entry
+}
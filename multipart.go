@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// OSS 单个分片上传最多 10000 个分片
+const maxUploadParts = 10000
+
+// 未知总大小时，每上传这么多个分片就把分片大小翻倍，避免分片数在大文件上触及上限
+const partGrowthInterval = 1000
+
+// partSizeOptions 分片上传的分片大小配置
+type partSizeOptions struct {
+	threshold   int64 // 超过这个大小的文件使用分片上传
+	minSize     int64
+	maxSize     int64
+	defaultSize int64 // 总大小未知时的初始分片大小
+}
+
+// 根据总大小计算分片大小：保证分片数不超过 10000，同时不小于 minSize、不大于 maxSize
+// total < 0 表示总大小未知，返回默认分片大小
+func choosePartSize(total int64, opts partSizeOptions) (int64, error) {
+	if total < 0 {
+		return opts.defaultSize, nil
+	}
+	if total > opts.maxSize*maxUploadParts {
+		return 0, fmt.Errorf("object of %d bytes exceeds the multipart limit of %d bytes", total, opts.maxSize*maxUploadParts)
+	}
+	size := (total + maxUploadParts - 1) / maxUploadParts
+	return min(max(size, opts.minSize), opts.maxSize), nil
+}
+
+// 分片上传：total >= 0 时按计算出的分片大小直接流式读取；total < 0 时每个分片先读入内存，
+// 并在分片数接近上限时逐步增大分片大小。失败时取消本次分片上传，避免残留分片占用存储
+func multipartUpload(bucket *oss.Bucket, key string, r io.Reader, total int64, opts partSizeOptions, initOptions, completeOptions []oss.Option) (oss.CompleteMultipartUploadResult, error) {
+	partSize, err := choosePartSize(total, opts)
+	if err != nil {
+		return oss.CompleteMultipartUploadResult{}, err
+	}
+	imur, err := bucket.InitiateMultipartUpload(key, initOptions...)
+	if err != nil {
+		return oss.CompleteMultipartUploadResult{}, err
+	}
+	parts, err := uploadParts(bucket, imur, r, total, partSize, opts.maxSize)
+	if err == nil {
+		var result oss.CompleteMultipartUploadResult
+		result, err = bucket.CompleteMultipartUpload(imur, parts, completeOptions...)
+		if err == nil {
+			log.Printf("Multipart upload of %s completed in %d part(s)", key, len(parts))
+			return result, nil
+		}
+	}
+	if abortErr := bucket.AbortMultipartUpload(imur); abortErr != nil {
+		log.Printf("Failed to abort multipart upload %s: %v", imur.UploadID, abortErr)
+	}
+	return oss.CompleteMultipartUploadResult{}, err
+}
+
+func uploadParts(bucket *oss.Bucket, imur oss.InitiateMultipartUploadResult, r io.Reader, total, partSize, maxPartSize int64) ([]oss.UploadPart, error) {
+	var parts []oss.UploadPart
+	if total >= 0 {
+		for number, offset := 1, int64(0); offset < total; number, offset = number+1, offset+partSize {
+			size := min(partSize, total-offset)
+			part, err := bucket.UploadPart(imur, io.LimitReader(r, size), size, number)
+			if err != nil {
+				return nil, fmt.Errorf("failed to upload part %d: %v", number, err)
+			}
+			parts = append(parts, part)
+		}
+		return parts, nil
+	}
+
+	var buf bytes.Buffer
+	for number := 1; ; number++ {
+		if number > maxUploadParts {
+			return nil, fmt.Errorf("upload exceeds %d parts", maxUploadParts)
+		}
+		if number > 1 && (number-1)%partGrowthInterval == 0 {
+			partSize = min(partSize*2, maxPartSize)
+		}
+		buf.Reset()
+		n, err := io.CopyN(&buf, r, partSize)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read part %d: %v", number, err)
+		}
+		// 空的最后一个分片不上传，但至少要有一个分片
+		if n == 0 && number > 1 {
+			return parts, nil
+		}
+		part, uploadErr := bucket.UploadPart(imur, bytes.NewReader(buf.Bytes()), n, number)
+		if uploadErr != nil {
+			return nil, fmt.Errorf("failed to upload part %d: %v", number, uploadErr)
+		}
+		parts = append(parts, part)
+		if err == io.EOF {
+			return parts, nil
+		}
+	}
+}
+
+// presignedPart 浏览器直传时单个分片的签名地址，客户端对 url 发起 PUT 请求上传该分片
+type presignedPart struct {
+	PartNumber int    `json:"partNumber"`
+	URL        string `json:"url"`
+}
+
+// 为已初始化的分片上传生成每个分片的 UploadPart 签名地址
+// 签名地址直接指向 OSS，不经过 CDN 改写，分片数据不经过本服务中转
+func presignUploadParts(bucket *oss.Bucket, imur oss.InitiateMultipartUploadResult, count int, expiry time.Duration) ([]presignedPart, error) {
+	parts := make([]presignedPart, 0, count)
+	for number := 1; number <= count; number++ {
+		signedURL, err := bucket.SignURL(imur.Key, oss.HTTPPut, int64(expiry/time.Second),
+			oss.AddParam("partNumber", strconv.Itoa(number)),
+			oss.AddParam("uploadId", imur.UploadID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign part %d: %v", number, err)
+		}
+		parts = append(parts, presignedPart{PartNumber: number, URL: signedURL})
+	}
+	return parts, nil
+}
+
+// 列出分片上传中已经上传的全部分片，用于客户端没有提交分片 ETag 时直接合并
+// 跨域上传时浏览器往往读不到响应里的 ETag 头，由服务端列举更可靠
+func listUploadedParts(bucket *oss.Bucket, imur oss.InitiateMultipartUploadResult) ([]oss.UploadPart, error) {
+	var parts []oss.UploadPart
+	marker := 0
+	for {
+		result, err := bucket.ListUploadedParts(imur, oss.MaxParts(1000), oss.PartNumberMarker(marker))
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range result.UploadedParts {
+			parts = append(parts, oss.UploadPart{PartNumber: p.PartNumber, ETag: p.ETag})
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		if marker, err = strconv.Atoi(result.NextPartNumberMarker); err != nil {
+			return nil, fmt.Errorf("invalid part number marker %q", result.NextPartNumberMarker)
+		}
+	}
+}
+
+// 取消 prefix 下发起时间早于 ttl 的未完成分片上传，返回取消的数量
+// 浏览器直传中途放弃时，已上传的分片会一直占用存储，需要定期清理
+func abortStaleUploads(bucket *oss.Bucket, prefix string, ttl time.Duration) (int, error) {
+	cutoff := time.Now().Add(-ttl)
+	aborted := 0
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		result, err := bucket.ListMultipartUploads(oss.Prefix(prefix), oss.KeyMarker(keyMarker), oss.UploadIDMarker(uploadIDMarker))
+		if err != nil {
+			return aborted, err
+		}
+		for _, upload := range result.Uploads {
+			if upload.Initiated.After(cutoff) {
+				continue
+			}
+			imur := oss.InitiateMultipartUploadResult{Bucket: bucket.BucketName, Key: upload.Key, UploadID: upload.UploadID}
+			if err := bucket.AbortMultipartUpload(imur); err != nil {
+				log.Printf("Failed to abort stale multipart upload %s of %s: %v", upload.UploadID, upload.Key, err)
+				continue
+			}
+			aborted++
+		}
+		if !result.IsTruncated {
+			return aborted, nil
+		}
+		keyMarker, uploadIDMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+// 后台定期清理 prefix 下过期的分片上传，ctx 取消（服务退出）时停止；interval 为 0 时不启动
+func startUploadSweeper(ctx context.Context, bucket *oss.Bucket, prefix string, ttl, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			aborted, err := abortStaleUploads(bucket, prefix, ttl)
+			if err != nil {
+				log.Printf("Failed to sweep stale multipart uploads: %v", err)
+			}
+			if aborted > 0 {
+				log.Printf("Aborted %d stale multipart upload(s) older than %v", aborted, ttl)
+			}
+		}
+	}()
+}
+
+// uploadTracker 记录通过 /multipart/presign 发起、尚未完成的分片上传，取消时据此找到对象名
+// 超过 ttl 仍未完成的上传由 sweep 取消，只涉及本服务发起的上传
+// 只保存在内存中，重启后之前的上传只能由后台清理任务（需设置 MULTIPART_SWEEP_INTERVAL）按 MULTIPART_UPLOAD_TTL 取消
+type uploadTracker struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	uploads map[string]trackedUpload
+}
+
+type trackedUpload struct {
+	bucket  *oss.Bucket
+	imur    oss.InitiateMultipartUploadResult
+	created time.Time
+}
+
+// 检查已登记的上传是否过期的间隔
+const trackedUploadSweepInterval = 10 * time.Minute
+
+func newUploadTracker(ttl time.Duration) *uploadTracker {
+	return &uploadTracker{ttl: ttl, uploads: make(map[string]trackedUpload)}
+}
+
+// 登记在 bucket 中新发起的上传
+func (t *uploadTracker) track(bucket *oss.Bucket, imur oss.InitiateMultipartUploadResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.uploads[imur.UploadID] = trackedUpload{bucket: bucket, imur: imur, created: time.Now()}
+}
+
+// 取消登记时间超过 ttl 仍未完成的上传并删除记录，返回取消的数量；取消失败的记录保留，下次再试
+func (t *uploadTracker) sweep() int {
+	t.mu.Lock()
+	var expired []trackedUpload
+	for _, u := range t.uploads {
+		if time.Since(u.created) > t.ttl {
+			expired = append(expired, u)
+		}
+	}
+	t.mu.Unlock()
+	aborted := 0
+	for _, u := range expired {
+		// NoSuchUpload 说明上传已完成或已被取消，只需删除记录
+		if err := u.bucket.AbortMultipartUpload(u.imur); err != nil {
+			if svcErr, ok := asServiceError(err); !ok || svcErr.Code != "NoSuchUpload" {
+				log.Printf("Failed to abort expired multipart upload %s of %s: %v", u.imur.UploadID, u.imur.Key, err)
+				continue
+			}
+		}
+		t.forget(u.imur.UploadID)
+		aborted++
+	}
+	return aborted
+}
+
+// 后台定期取消过期的已登记上传，ctx 取消（服务退出）时停止
+func (t *uploadTracker) start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(trackedUploadSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if aborted := t.sweep(); aborted > 0 {
+				log.Printf("Aborted %d expired presigned multipart upload(s)", aborted)
+			}
+		}
+	}()
+}
+
+// 返回登记的上传及其所在的存储桶；取消、合并时必须使用这个存储桶，而不是本次请求的 X-OSS-Bucket
+func (t *uploadTracker) get(uploadID string) (*oss.Bucket, oss.InitiateMultipartUploadResult, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.uploads[uploadID]
+	return u.bucket, u.imur, ok
+}
+
+// 在发起上传的存储桶中取消已登记的上传并删除记录；ok 为 false 表示没有登记
+// OSS 中已经不存在（已完成、已取消或被清理）时同样视为取消成功
+func (t *uploadTracker) abort(uploadID string, options ...oss.Option) (imur oss.InitiateMultipartUploadResult, ok bool, err error) {
+	bucket, imur, ok := t.get(uploadID)
+	if !ok {
+		return imur, false, nil
+	}
+	if err := bucket.AbortMultipartUpload(imur, options...); err != nil {
+		if svcErr, isSvc := asServiceError(err); !isSvc || svcErr.Code != "NoSuchUpload" {
+			return imur, true, err
+		}
+	}
+	t.forget(uploadID)
+	return imur, true, nil
+}
+
+func (t *uploadTracker) forget(uploadID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.uploads, uploadID)
+}
+
+// multipartUploadInfo GET /admin/multipart 中一个未完成的分片上传
+type multipartUploadInfo struct {
+	UploadID  string    `json:"uploadId"`
+	Key       string    `json:"key"`
+	Initiated time.Time `json:"initiated"`
+	Age       int64     `json:"age"`     // 距发起的秒数
+	Tracked   bool      `json:"tracked"` // 是否由本服务发起且仍可通过 DELETE /upload/:uploadId 取消
+}
+
+// 列举一页未完成的分片上传，返回下一页的 key 和 uploadId 标记
+func listMultipartUploads(bucket *oss.Bucket, prefix, keyMarker, uploadIDMarker string, maxUploads int, tracked func(uploadID string) bool, options ...oss.Option) ([]multipartUploadInfo, oss.ListMultipartUploadResult, error) {
+	result, err := bucket.ListMultipartUploads(append(options, oss.Prefix(prefix), oss.KeyMarker(keyMarker), oss.UploadIDMarker(uploadIDMarker), oss.MaxUploads(maxUploads))...)
+	if err != nil {
+		return nil, result, err
+	}
+	now := time.Now()
+	items := make([]multipartUploadInfo, 0, len(result.Uploads))
+	for _, upload := range result.Uploads {
+		items = append(items, multipartUploadInfo{
+			UploadID:  upload.UploadID,
+			Key:       upload.Key,
+			Initiated: upload.Initiated,
+			Age:       int64(now.Sub(upload.Initiated).Seconds()),
+			Tracked:   tracked(upload.UploadID),
+		})
+	}
+	return items, result, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// 只取消本服务登记且已过期的上传；其他程序发起的上传不受影响
+func TestUploadTrackerSweep(t *testing.T) {
+	fake := newFakeOSS(t)
+	bucket := fake.bucket(t)
+	tracker := newUploadTracker(time.Hour)
+	initiate := func(key string, track bool) string {
+		imur, err := bucket.InitiateMultipartUpload(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if track {
+			tracker.track(bucket, imur)
+		}
+		return imur.UploadID
+	}
+	expired, fresh, foreign, gone := initiate("a.bin", true), initiate("b.bin", true), initiate("c.bin", false), initiate("d.bin", true)
+	fake.ageUpload(foreign, 2*time.Hour)
+	tracker.mu.Lock()
+	for _, id := range []string{expired, gone} {
+		u := tracker.uploads[id]
+		u.created = u.created.Add(-2 * time.Hour)
+		tracker.uploads[id] = u
+	}
+	tracker.mu.Unlock()
+	// 已完成或已取消的上传：OSS 返回 NoSuchUpload，只删除记录
+	_, imur, _ := tracker.get(gone)
+	if err := bucket.AbortMultipartUpload(imur); err != nil {
+		t.Fatal(err)
+	}
+
+	if aborted := tracker.sweep(); aborted != 2 {
+		t.Errorf("sweep() = %d, want 2", aborted)
+	}
+	if got := fake.abortedUploads(); !slices.Contains(got, expired) || slices.Contains(got, fresh) || slices.Contains(got, foreign) {
+		t.Errorf("aborted uploads = %v, want %s but not %s or %s", got, expired, fresh, foreign)
+	}
+	for id, want := range map[string]bool{expired: false, gone: false, fresh: true} {
+		if _, _, ok := tracker.get(id); ok != want {
+			t.Errorf("upload %s tracked = %v, want %v", id, ok, want)
+		}
+	}
+}
+
+// 取消在发起上传的存储桶中进行，而不是默认存储桶
+func TestUploadTrackerAbortUsesTrackedBucket(t *testing.T) {
+	defaultFake, archiveFake := newFakeOSS(t), newFakeOSS(t)
+	defaultBucket := defaultFake.bucket(t)
+	archive, err := archiveFake.bucket(t).Client.Bucket("archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newUploadTracker(time.Hour)
+	imur, err := archive.InitiateMultipartUpload("a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.track(archive, imur)
+	if tracked, _, _ := tracker.get(imur.UploadID); tracked.BucketName != "archive" || tracked.BucketName == defaultBucket.BucketName {
+		t.Fatalf("tracked bucket = %q, want archive", tracked.BucketName)
+	}
+
+	got, ok, err := tracker.abort(imur.UploadID)
+	if err != nil || !ok || got.UploadID != imur.UploadID {
+		t.Fatalf("abort() = %v, %v, %v", got.UploadID, ok, err)
+	}
+	if aborted := archiveFake.abortedUploads(); !slices.Equal(aborted, []string{imur.UploadID}) {
+		t.Errorf("archive aborted uploads = %v, want %s", aborted, imur.UploadID)
+	}
+	if aborted := defaultFake.abortedUploads(); len(aborted) != 0 {
+		t.Errorf("default bucket aborted uploads = %v, want none", aborted)
+	}
+	if _, _, ok := tracker.get(imur.UploadID); ok {
+		t.Error("upload still tracked after abort")
+	}
+	// 再次取消：已不再登记
+	if _, ok, _ := tracker.abort(imur.UploadID); ok {
+		t.Error("abort() of a forgotten upload reported ok")
+	}
+}
+
+// 后台清理只取消 prefix 下的上传
+func TestAbortStaleUploadsPrefix(t *testing.T) {
+	fake := newFakeOSS(t)
+	bucket := fake.bucket(t)
+	var ids []string
+	for _, key := range []string{"uploads/old.bin", "uploads/new.bin", "other/old.bin"} {
+		imur, err := bucket.InitiateMultipartUpload(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, imur.UploadID)
+	}
+	fake.ageUpload(ids[0], 2*time.Hour)
+	fake.ageUpload(ids[2], 2*time.Hour)
+	aborted, err := abortStaleUploads(bucket, "uploads/", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.abortedUploads(); aborted != 1 || !slices.Equal(got, ids[:1]) {
+		t.Errorf("abortStaleUploads() = %d, aborted %v, want only %s", aborted, got, ids[0])
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 接口响应支持的格式，按 Accept 请求头选择
+const (
+	formatJSON = "json"
+	formatText = "text"
+	formatXML  = "xml"
+)
+
+var formatContentTypes = map[string]string{
+	formatJSON: "application/json; charset=utf-8",
+	formatText: "text/plain; charset=utf-8",
+	formatXML:  "application/xml; charset=utf-8",
+}
+
+// 按 Accept 请求头选择响应格式，取 q 值最高的受支持类型；没有 Accept、*/* 或没有受支持的类型时使用 JSON
+// 浏览器默认的 Accept 同时列出 text/html 和 application/xml（例如 text/html,application/xml;q=0.9,*/*;q=0.8），
+// 因此 XML 或纯文本的 q 值必须高于 text/html（以及 XHTML），否则仍使用 JSON
+func negotiateFormat(accept string) string {
+	best, bestQ := formatJSON, -1.0
+	htmlQ := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		var format string
+		switch mediaType {
+		case "text/html", "application/xhtml+xml":
+			htmlQ = max(htmlQ, q)
+			continue
+		case "application/json", "application/*", "*/*":
+			format = formatJSON
+		case "text/plain", "text/*":
+			format = formatText
+		case "application/xml", "text/xml":
+			format = formatXML
+		default:
+			continue
+		}
+		// q 相同时保留先出现的类型
+		if q > 0 && q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	if best != formatJSON && bestQ <= htmlQ {
+		return formatJSON
+	}
+	return best
+}
+
+// 输出接口自身的响应（成功结果和错误），按 Accept 请求头选择 JSON、纯文本或 XML
+// 只用于接口生成的数据；下载等返回对象内容的响应不经过这里，内容不会被改写
+// 所有这类响应都带 Vary: Accept，缓存不会把一种格式的响应返回给要求另一种格式的客户端
+// 请求的 OSS 调用因并发名额不足被拒绝时，5xx 响应改为 503 和 Retry-After（见 ossBusyResponse）
+func respond(c *gin.Context, code int, obj any) {
+	code, obj = ossBusyResponse(c, code, obj)
+	c.Writer.Header().Add("Vary", "Accept")
+	format := negotiateFormat(c.GetHeader("Accept"))
+	if format == formatJSON {
+		c.JSON(code, obj)
+		return
+	}
+	// 先按 JSON 序列化再解码，字段名和省略规则与 JSON 响应一致
+	data, err := json.Marshal(obj)
+	if err != nil {
+		c.JSON(code, obj)
+		return
+	}
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		c.JSON(code, obj)
+		return
+	}
+	c.Data(code, formatContentTypes[format], renderResponse(format, value))
+}
+
+// 中间件中止请求时使用，相当于 AbortWithStatusJSON
+func abortRespond(c *gin.Context, code int, obj any) {
+	c.Abort()
+	respond(c, code, obj)
+}
+
+// 把解码后的 JSON 值渲染为 text/plain 或 XML
+func renderResponse(format string, data any) []byte {
+	var buf bytes.Buffer
+	if format == formatXML {
+		buf.WriteString(xml.Header)
+		writeXMLValue(&buf, "response", data)
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}
+	writeTextValue(&buf, "", data)
+	return buf.Bytes()
+}
+
+// 纯文本格式：每行一个 "路径: 值"，嵌套对象用 "." 连接，数组元素为 [下标]，便于 grep/awk 处理
+// 顶层不是对象或数组时只输出值本身
+func writeTextValue(buf *bytes.Buffer, path string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			writeTextValue(buf, child, v[key])
+		}
+	case []any:
+		for i, item := range v {
+			writeTextValue(buf, fmt.Sprintf("%s[%d]", path, i), item)
+		}
+	default:
+		// 值中的换行会破坏每行一项的格式，转义为 \n
+		text := strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(scalarText(v))
+		if path == "" {
+			fmt.Fprintln(buf, text)
+			return
+		}
+		fmt.Fprintf(buf, "%s: %s\n", path, text)
+	}
+}
+
+// XML 格式：对象的每个字段为一个子元素，数组元素为 <item>；字段名不是合法的 XML 名字时（例如用户元数据）
+// 写成 <entry name="...">
+func writeXMLValue(buf *bytes.Buffer, name string, value any) {
+	open, closing := "<"+name+">", "</"+name+">"
+	if !validXMLName(name) {
+		var attr bytes.Buffer
+		xml.EscapeText(&attr, []byte(name))
+		open, closing = `<entry name="`+attr.String()+`">`, "</entry>"
+	}
+	buf.WriteString(open)
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			writeXMLValue(buf, key, v[key])
+		}
+	case []any:
+		for _, item := range v {
+			writeXMLValue(buf, "item", item)
+		}
+	default:
+		xml.EscapeText(buf, []byte(scalarText(v)))
+	}
+	buf.WriteString(closing)
+}
+
+func scalarText(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 只接受 ASCII 字母、数字、"_"、"-"、"."，且不以数字、"-"、"." 或 "xml" 开头
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case (r >= '0' && r <= '9') || r == '-' || r == '.':
+			if i == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
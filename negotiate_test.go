@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name, accept, want string
+	}{
+		{"no Accept", "", formatJSON},
+		{"wildcard", "*/*", formatJSON},
+		{"JSON", "application/json", formatJSON},
+		{"XML", "application/xml", formatXML},
+		{"text", "text/plain", formatText},
+		{"highest q wins", "application/json;q=0.5, text/plain", formatText},
+		{"browser default", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", formatJSON},
+		{"browser default with image types", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8", formatJSON},
+		{"XML above HTML", "application/xml, text/html;q=0.5", formatXML},
+		{"XML tied with HTML", "text/html, application/xml", formatJSON},
+		{"text tied with XHTML", "application/xhtml+xml, text/plain", formatJSON},
+		{"unsupported only", "image/png", formatJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateFormat(tt.accept); got != tt.want {
+				t.Errorf("negotiateFormat(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
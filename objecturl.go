@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// objectURLOptions 生成对象访问地址所需的配置
+type objectURLOptions struct {
+	endpoint   string
+	bucketName string
+	cdnBaseURL string        // 配置后，返回的地址统一改写为 CDN 域名
+	public     bool          // 存储桶是否公共读，决定默认返回公共地址还是签名地址
+	expiry     time.Duration // 签名地址的默认有效期
+	maxExpiry  time.Duration // 客户端可请求的最长有效期
+}
+
+// 生成对象的访问地址：signed 为 true 时返回带签名的临时地址，否则返回公共地址
+// overrides 为 response-* 响应头覆盖参数，会被签入地址中，只对签名地址有效
+func buildObjectURL(bucket *oss.Bucket, opts objectURLOptions, key string, signed bool, expiry time.Duration, overrides ...oss.Option) (string, error) {
+	if !signed {
+		return rewriteToCDN(publicObjectURL(opts, key), opts.cdnBaseURL)
+	}
+	signedURL, err := bucket.SignURL(key, oss.HTTPGet, int64(expiry/time.Second), overrides...)
+	if err != nil {
+		return "", err
+	}
+	return rewriteToCDN(signedURL, opts.cdnBaseURL)
+}
+
+// 拼接公共读对象的地址：<scheme>://<bucket>.<endpoint>/<key>
+func publicObjectURL(opts objectURLOptions, key string) string {
+	scheme := "https"
+	host := opts.endpoint
+	if i := strings.Index(host, "://"); i >= 0 {
+		scheme, host = host[:i], host[i+3:]
+	}
+	u := url.URL{
+		Scheme: scheme,
+		Host:   opts.bucketName + "." + strings.TrimSuffix(host, "/"),
+		Path:   "/" + key,
+	}
+	return u.String()
+}
+
+// 把地址的协议和域名替换为 CDN 域名，保留路径和查询参数（签名参数不包含域名，改写后仍然有效）
+func rewriteToCDN(rawURL, cdnBaseURL string) (string, error) {
+	if cdnBaseURL == "" {
+		return rawURL, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	base, err := url.Parse(cdnBaseURL)
+	if err != nil || base.Host == "" {
+		return "", fmt.Errorf("invalid CDN base URL %q", cdnBaseURL)
+	}
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	u.Path = strings.TrimSuffix(base.Path, "/") + u.Path
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// 解析客户端请求的签名有效期（秒），为空时使用默认值，超过上限时截断
+func parseExpiry(value string, opts objectURLOptions) (time.Duration, error) {
+	if value == "" {
+		return opts.expiry, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid expires value %q", value)
+	}
+	expiry := time.Duration(seconds) * time.Second
+	if opts.maxExpiry > 0 && expiry > opts.maxExpiry {
+		expiry = opts.maxExpiry
+	}
+	return expiry, nil
+}
+
+// 解析签名下载地址的响应头覆盖：OSS 按 response-content-disposition、response-content-type 改写下载响应，
+// 浏览器据此使用正确的文件名和类型；值会原样出现在响应头中，因此必须是合法的头部值
+func parseResponseOverrides(disposition, contentType string) ([]oss.Option, error) {
+	var overrides []oss.Option
+	if disposition != "" {
+		dispositionType, _, err := mime.ParseMediaType(disposition)
+		if err != nil || (dispositionType != "inline" && dispositionType != "attachment") || !validHeaderValue(disposition) {
+			return nil, fmt.Errorf("invalid responseContentDisposition %q", disposition)
+		}
+		overrides = append(overrides, oss.ResponseContentDisposition(disposition))
+	}
+	if contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil || !validHeaderValue(contentType) {
+			return nil, fmt.Errorf("invalid responseContentType %q", contentType)
+		}
+		overrides = append(overrides, oss.ResponseContentType(contentType))
+	}
+	return overrides, nil
+}
+
+// 头部值不能包含控制字符（尤其是 CR/LF），长度也需要有上限
+func validHeaderValue(value string) bool {
+	if len(value) > 1024 {
+		return false
+	}
+	for _, r := range value {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errBlockedTarget = errors.New("outbound target is not allowed")
+
+// outboundPolicy 限制服务主动发起的请求（webhook、从 URL 导入等）可以访问的目标，防止被用来探测内网（SSRF）
+//   - 主机名先经过 allowHosts / denyHosts 检查，"*.example.com" 匹配所有子域名
+//   - 连接时再检查实际连接的 IP：denyNets 中的地址总是拒绝；私有、回环、链路本地等内网地址默认拒绝，
+//     除非 allowPrivate 为 true 或地址在 allowNets 中
+//
+// IP 检查放在拨号阶段，校验的是 DNS 解析后真正要连接的地址，可以防止 DNS rebinding
+type outboundPolicy struct {
+	allowHosts   []string
+	denyHosts    []string
+	allowNets    []*net.IPNet
+	denyNets     []*net.IPNet
+	allowPrivate bool
+}
+
+func newOutboundPolicy(cfg *Config) (*outboundPolicy, error) {
+	allowNets, err := parseCIDRList(cfg.OutboundAllowCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("OUTBOUND_ALLOW_CIDRS: %v", err)
+	}
+	denyNets, err := parseCIDRList(cfg.OutboundDenyCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("OUTBOUND_DENY_CIDRS: %v", err)
+	}
+	return &outboundPolicy{
+		allowHosts:   splitList(cfg.OutboundAllowHosts),
+		denyHosts:    splitList(cfg.OutboundDenyHosts),
+		allowNets:    allowNets,
+		denyNets:     denyNets,
+		allowPrivate: cfg.OutboundAllowPrivate,
+	}, nil
+}
+
+// 逗号分隔的列表，去掉空白和空项，统一小写
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// 单个 IP 按 /32 或 /128 处理
+func parseCIDRList(value string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if pattern == host || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查目标 URL 的协议和主机名；主机是 IP 字面量时同时检查 IP
+func (p *outboundPolicy) checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBlockedTarget, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not allowed", errBlockedTarget, u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" || matchHost(p.denyHosts, host) || (len(p.allowHosts) > 0 && !matchHost(p.allowHosts, host)) {
+		return fmt.Errorf("%w: host %q", errBlockedTarget, host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return p.checkIP(ip)
+	}
+	return nil
+}
+
+func (p *outboundPolicy) checkIP(ip net.IP) error {
+	if containsIP(p.denyNets, ip) {
+		return fmt.Errorf("%w: address %s is denied", errBlockedTarget, ip)
+	}
+	internal := ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast()
+	if internal && !p.allowPrivate && !containsIP(p.allowNets, ip) {
+		return fmt.Errorf("%w: address %s is internal", errBlockedTarget, ip)
+	}
+	return nil
+}
+
+// 返回受策略约束的 HTTP 客户端：每次请求（包括重定向）都检查 URL，每次建立连接都检查实际的 IP
+// 不使用环境变量中的代理，否则连接的是代理地址，IP 检查就失去了意义
+func (p *outboundPolicy) client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("%w: unresolved address %q", errBlockedTarget, address)
+			}
+			return p.checkIP(ip)
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return p.checkURL(req.URL.String())
+		},
+	}
+}
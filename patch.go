@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// patchSegment 原对象中的一段区间 [start, start+size)
+type patchSegment struct {
+	start, size int64
+}
+
+// 把 [start, start+size) 均分成不超过 maxSize 的若干段，避免最后剩下一个过小的分片
+func splitRange(start, size, maxSize int64) []patchSegment {
+	if size <= 0 {
+		return nil
+	}
+	n := (size + maxSize - 1) / maxSize
+	segments := make([]patchSegment, 0, n)
+	for i := int64(0); i < n; i++ {
+		from := start + size*i/n
+		to := start + size*(i+1)/n
+		segments = append(segments, patchSegment{start: from, size: to - from})
+	}
+	return segments
+}
+
+// 普通对象不支持原地修改，这里用分片上传拼出一个新对象来实现“改写一段区间”：
+// 未修改的区间用 UploadPartCopy 在 OSS 内部复制，新数据作为普通分片上传，最后合并覆盖原对象
+//
+// 代价与限制：
+//   - 复制不经过本服务，但每个分片都是一次计费请求，耗时随对象大小增长，改写 1 字节也要复制整个对象
+//   - 除最后一个分片外每个分片至少 minSize，过短的前后区间需要先读出来和新数据拼成一个分片上传
+//   - 合并后是一个新对象：ETag 变化，变成 Multipart 类型；存储的 sha256 不再准确，会被去掉
+//   - 用 ETag 条件保证改写期间原对象没有被修改，否则返回 412
+//
+// 用 data（dataSize 字节）覆盖对象 key 从 offset 开始的区间，offset 等于原大小时相当于追加
+// meta 为原对象的元数据，用于确定大小、ETag 条件以及需要保留的头信息
+func patchObject(bucket *oss.Bucket, key string, meta http.Header, offset int64, data io.Reader, dataSize int64, opts partSizeOptions) (oss.CompleteMultipartUploadResult, int64, error) {
+	var empty oss.CompleteMultipartUploadResult
+	size, err := strconv.ParseInt(meta.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return empty, 0, fmt.Errorf("invalid object size %q", meta.Get("Content-Length"))
+	}
+	etag := meta.Get("ETag")
+	end := offset + dataSize
+
+	// 上传段 [low, high)：包含新数据，以及为满足最小分片大小而并入的前后原数据
+	low, high := offset, end
+	if low < opts.minSize {
+		low = 0
+	}
+	if high < size && high-low < opts.minSize {
+		high = min(size, low+opts.minSize)
+	}
+	prefix := splitRange(0, low, opts.maxSize)
+	upload := splitRange(low, high-low, opts.maxSize)
+	suffix := splitRange(high, size-high, opts.maxSize)
+	if total := len(prefix) + len(upload) + len(suffix); total > maxUploadParts {
+		return empty, 0, fmt.Errorf("patch needs %d parts, exceeds the limit of %d", total, maxUploadParts)
+	}
+
+	readers := []io.Reader{}
+	if offset > low {
+		head, err := bucket.GetObject(key, oss.Range(low, offset-1), oss.IfMatch(etag))
+		if err != nil {
+			return empty, 0, err
+		}
+		defer head.Close()
+		readers = append(readers, head)
+	}
+	readers = append(readers, io.LimitReader(data, dataSize))
+	if high > end {
+		tail, err := bucket.GetObject(key, oss.Range(end, high-1), oss.IfMatch(etag))
+		if err != nil {
+			return empty, 0, err
+		}
+		defer tail.Close()
+		readers = append(readers, tail)
+	}
+	src := io.MultiReader(readers...)
+
+	// 合并后的对象保留原有的类型、缓存头和自定义元数据，只去掉已经不准确的校验值
+	initOptions := objectHeaderOptions(meta, checksumMetaKey)
+
+	imur, err := bucket.InitiateMultipartUpload(key, initOptions...)
+	if err != nil {
+		return empty, 0, err
+	}
+	parts, err := patchParts(bucket, imur, etag, src, prefix, upload, suffix)
+	if err == nil {
+		var result oss.CompleteMultipartUploadResult
+		result, err = bucket.CompleteMultipartUpload(imur, parts)
+		if err == nil {
+			log.Printf("Patched %s at offset %d with %d byte(s) in %d part(s)", key, offset, dataSize, len(parts))
+			return result, max(size, end), nil
+		}
+	}
+	if abortErr := bucket.AbortMultipartUpload(imur); abortErr != nil {
+		log.Printf("Failed to abort multipart upload %s: %v", imur.UploadID, abortErr)
+	}
+	return empty, 0, err
+}
+
+func patchParts(bucket *oss.Bucket, imur oss.InitiateMultipartUploadResult, etag string, src io.Reader, prefix, upload, suffix []patchSegment) ([]oss.UploadPart, error) {
+	var parts []oss.UploadPart
+	copyParts := func(segments []patchSegment) error {
+		for _, seg := range segments {
+			part, err := bucket.UploadPartCopy(imur, bucket.BucketName, imur.Key, seg.start, seg.size, len(parts)+1, oss.CopySourceIfMatch(etag))
+			if err != nil {
+				return fmt.Errorf("failed to copy part %d: %w", len(parts)+1, err)
+			}
+			parts = append(parts, part)
+		}
+		return nil
+	}
+	if err := copyParts(prefix); err != nil {
+		return nil, err
+	}
+	for _, seg := range upload {
+		part, err := bucket.UploadPart(imur, io.LimitReader(src, seg.size), seg.size, len(parts)+1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload part %d: %w", len(parts)+1, err)
+		}
+		parts = append(parts, part)
+	}
+	if err := copyParts(suffix); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
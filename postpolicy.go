@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// postPolicy 浏览器表单直传（PostObject）所需的字段，表单中除 file 外的字段都要原样提交
+type postPolicy struct {
+	URL            string    `json:"url"`
+	Policy         string    `json:"policy"`
+	OSSAccessKeyID string    `json:"OSSAccessKeyId"`
+	Signature      string    `json:"signature"`
+	Expiration     time.Time `json:"expiration"`
+	KeyPrefix      string    `json:"keyPrefix"` // 表单中的 key 必须以此开头
+	MaxSize        int64     `json:"maxSize"`
+}
+
+// 生成 PostObject 的 policy：限定存储桶、key 前缀和文件大小范围，
+// 签名为用 AccessKeySecret 对 base64 编码后的 policy 做 HMAC-SHA1 再 base64 编码
+func signPostPolicy(opts objectURLOptions, accessKeyID, accessKeySecret, keyPrefix string, maxSize int64, expires time.Time) (postPolicy, error) {
+	doc := map[string]any{
+		"expiration": expires.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"conditions": []any{
+			map[string]string{"bucket": opts.bucketName},
+			[]any{"content-length-range", 0, maxSize},
+			[]any{"starts-with", "$key", keyPrefix},
+		},
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return postPolicy{}, err
+	}
+	policy := base64.StdEncoding.EncodeToString(raw)
+	mac := hmac.New(sha1.New, []byte(accessKeySecret))
+	mac.Write([]byte(policy))
+	return postPolicy{
+		URL:            publicObjectURL(opts, ""),
+		Policy:         policy,
+		OSSAccessKeyID: accessKeyID,
+		Signature:      base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		Expiration:     expires.UTC(),
+		KeyPrefix:      keyPrefix,
+		MaxSize:        maxSize,
+	}, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OSS V1 签名中参与签名的查询参数（子资源），其余参数 OSS 不校验，可以随意修改
+// 只列出签名地址中可能出现的部分，完整列表见 SDK 的 signKeyList
+var signedSubresources = map[string]bool{
+	"response-content-type": true, "response-content-language": true, "response-expires": true,
+	"response-cache-control": true, "response-content-disposition": true, "response-content-encoding": true,
+	"x-oss-process": true, "x-oss-traffic-limit": true, "security-token": true,
+	"uploadId": true, "partNumber": true, "versionId": true,
+	"acl": true, "tagging": true, "restore": true, "symlink": true, "objectMeta": true,
+}
+
+// presignCheck 签名地址的检查结果；不包含 AccessKeySecret，accessKeyId 只显示最后 4 个字符
+type presignCheck struct {
+	WellFormed     bool       `json:"wellFormed"`
+	Accepted       bool       `json:"accepted"` // 现在发起请求时 OSS 是否会接受签名（不检查对象是否存在和权限）
+	Problems       []string   `json:"problems"`
+	Method         string     `json:"method"`
+	Bucket         string     `json:"bucket,omitempty"`
+	Key            string     `json:"key,omitempty"`
+	AccessKeyID    string     `json:"accessKeyId,omitempty"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	ExpiresIn      int64      `json:"expiresIn,omitempty"` // 距离过期的秒数，已过期时为负数
+	SignedParams   []string   `json:"signedParams"`
+	UnsignedParams []string   `json:"unsignedParams"`
+	StringToSign   string     `json:"stringToSign,omitempty"`
+}
+
+// 按 OSS V1 签名规则重新计算签名并与地址中的签名比较，不向 OSS 发起请求
+// 地址的域名必须是 opts 对应存储桶的 OSS 域名或 CDN 域名；contentType、contentMD5 为 PUT 地址签名时使用的请求头
+func verifyPresignedURL(rawURL, method, contentType, contentMD5 string, opts objectURLOptions, accessKeyID, accessKeySecret string, now time.Time) presignCheck {
+	check := presignCheck{Method: method, Problems: []string{}, SignedParams: []string{}, UnsignedParams: []string{}}
+	problem := func(msg string) { check.Problems = append(check.Problems, msg) }
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		problem("not an absolute URL")
+		return check
+	}
+	query := u.Query()
+	if query.Get("x-oss-signature-version") != "" {
+		problem("only V1 signed URLs (OSSAccessKeyId/Expires/Signature) can be verified")
+		return check
+	}
+	for _, name := range []string{"OSSAccessKeyId", "Expires", "Signature"} {
+		if query.Get(name) == "" {
+			problem("missing query parameter " + name)
+		}
+	}
+	expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64)
+	if query.Get("Expires") != "" && err != nil {
+		problem("Expires is not a Unix timestamp")
+	}
+
+	// 确定存储桶和对象名：OSS 域名为 <bucket>.<endpoint>/<key>，CDN 域名为 <cdn>/<base path>/<key>
+	ossURL, _ := url.Parse(publicObjectURL(opts, ""))
+	key, hostMatches := "", false
+	if strings.EqualFold(u.Host, ossURL.Host) {
+		key, hostMatches = strings.TrimPrefix(u.Path, "/"), true
+	} else if cdn, err := url.Parse(opts.cdnBaseURL); opts.cdnBaseURL != "" && err == nil && strings.EqualFold(u.Host, cdn.Host) {
+		key, hostMatches = strings.TrimPrefix(strings.TrimPrefix(u.Path, strings.TrimSuffix(cdn.Path, "/")), "/"), true
+	}
+	if !hostMatches {
+		problem("host " + u.Host + " does not belong to bucket " + opts.bucketName)
+	}
+	if key == "" && len(check.Problems) == 0 {
+		problem("URL does not name an object")
+	}
+	check.WellFormed = len(check.Problems) == 0
+	if !check.WellFormed {
+		return check
+	}
+	check.Bucket, check.Key = opts.bucketName, key
+	check.AccessKeyID = redactSecret(query.Get("OSSAccessKeyId"))
+	expiresAt := time.Unix(expires, 0).UTC()
+	check.ExpiresAt = &expiresAt
+	check.ExpiresIn = expires - now.Unix()
+
+	// 规范化资源：/<bucket>/<key>，再按名字排序附加参与签名的子资源
+	var subresources []string
+	for name := range query {
+		switch {
+		case name == "OSSAccessKeyId" || name == "Expires" || name == "Signature":
+		case signedSubresources[name]:
+			check.SignedParams = append(check.SignedParams, name)
+		default:
+			check.UnsignedParams = append(check.UnsignedParams, name)
+		}
+	}
+	sort.Strings(check.SignedParams)
+	sort.Strings(check.UnsignedParams)
+	for _, name := range check.SignedParams {
+		if value := query.Get(name); value != "" {
+			subresources = append(subresources, name+"="+value)
+		} else {
+			subresources = append(subresources, name)
+		}
+	}
+	resource := "/" + opts.bucketName + "/" + key
+	if len(subresources) > 0 {
+		resource += "?" + strings.Join(subresources, "&")
+	}
+	check.StringToSign = method + "\n" + contentMD5 + "\n" + contentType + "\n" + query.Get("Expires") + "\n" + resource
+	mac := hmac.New(sha1.New, []byte(accessKeySecret))
+	mac.Write([]byte(check.StringToSign))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if query.Get("OSSAccessKeyId") != accessKeyID {
+		problem("signed with a different access key than the one currently in use (was it rotated?)")
+	} else if !hmac.Equal([]byte(expected), []byte(query.Get("Signature"))) {
+		problem("signature does not match; the method, content type, object key or signed parameters differ from what was signed")
+	}
+	if check.ExpiresIn <= 0 {
+		problem("URL expired at " + expiresAt.Format(time.RFC3339))
+	}
+	check.Accepted = len(check.Problems) == 0
+	return check
+}
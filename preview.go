@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/base64"
+	"mime"
+	"unicode/utf8"
+)
+
+// /preview 返回的内容：文本类对象（类型在 textTypes 中且内容是合法 UTF-8）直接返回文本，其余返回 base64
+// 截断处可能落在一个多字节字符中间，判断前先去掉末尾不完整的字符
+func previewContent(contentType string, data []byte, textTypes inlineTypes) (encoding, content string) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if textTypes.contains(mediaType) {
+		text := data
+		for i := 0; i < utf8.UTFMax-1 && len(text) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(text); r != utf8.RuneError || size != 1 {
+				break
+			}
+			text = text[:len(text)-1]
+		}
+		if utf8.Valid(text) {
+			return "text", string(text)
+		}
+	}
+	return "base64", base64.StdEncoding.EncodeToString(data)
+}
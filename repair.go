@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// metadataRepair 对一个对象所做（或 dryRun 时将要做）的修复
+type metadataRepair struct {
+	Key            string `json:"key"`
+	OldContentType string `json:"oldContentType,omitempty"`
+	NewContentType string `json:"newContentType,omitempty"`
+	AddChecksum    bool   `json:"addChecksum,omitempty"`
+	SHA256         string `json:"sha256,omitempty"` // 新写入的校验值，dryRun 时不计算
+	Error          string `json:"error,omitempty"`
+}
+
+// metadataRepairReport 元数据修复任务的结果
+type metadataRepairReport struct {
+	Prefix   string           `json:"prefix"`
+	DryRun   bool             `json:"dryRun"`
+	Scanned  int              `json:"scanned"`
+	Repaired int              `json:"repaired"`
+	Failed   int              `json:"failed"`
+	Changes  []metadataRepair `json:"changes"`
+}
+
+// 元数据修复报告的对象名：<manifestPrefix>repair-<UTC 时间戳>.json
+func repairReportKey(manifestPrefix string, now time.Time) string {
+	return manifestPrefix + "repair-" + now.UTC().Format("20060102T150405Z") + ".json"
+}
+
+// 后台修复 prefix 下对象缺失的元数据，完成后把报告上传到 key
+func runRepairMetadataJob(bucket *oss.Bucket, jobs *jobStore, id, prefix string, skip []string, dryRun bool, key string, repaired func(string)) {
+	var report metadataRepairReport
+	err := runReportJob(bucket, jobs, id, key, func() (any, error) {
+		var err error
+		report, err = repairMetadata(bucket, prefix, skip, dryRun, repaired)
+		return report, err
+	})
+	if err != nil {
+		log.Printf("Repair metadata job %s failed: %v", id, err)
+		return
+	}
+	log.Printf("Repair metadata job %s: %d of %d object(s) repaired, %d failed (dryRun=%v)", id, report.Repaired, report.Scanned, report.Failed, dryRun)
+}
+
+// 逐个检查对象：缺少 Content-Type（或为通用的 application/octet-stream）时按扩展名或内容重新识别，
+// 缺少 x-oss-meta-sha256 时读取全部内容计算；有需要修复的内容时以 REPLACE 方式复制到自身写入，其余元数据保持不变
+// 单个对象修复失败记录在报告中，不影响其他对象
+func repairMetadata(bucket *oss.Bucket, prefix string, skip []string, dryRun bool, repaired func(string)) (metadataRepairReport, error) {
+	report := metadataRepairReport{Prefix: prefix, DryRun: dryRun, Changes: []metadataRepair{}}
+	marker := ""
+	for {
+		res, err := bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000))
+		if err != nil {
+			return report, fmt.Errorf("failed to list objects: %v", err)
+		}
+		for _, object := range res.Objects {
+			if hasAnyPrefix(object.Key, skip) || isDirectoryMarker(object) {
+				continue
+			}
+			report.Scanned++
+			change, needed, err := repairObject(bucket, object.Key, dryRun)
+			if err != nil {
+				change.Error = err.Error()
+				report.Failed++
+				report.Changes = append(report.Changes, change)
+				continue
+			}
+			if needed {
+				report.Repaired++
+				report.Changes = append(report.Changes, change)
+				if !dryRun {
+					repaired(object.Key)
+				}
+			}
+		}
+		if !res.IsTruncated {
+			return report, nil
+		}
+		marker = res.NextMarker
+	}
+}
+
+func repairObject(bucket *oss.Bucket, key string, dryRun bool) (metadataRepair, bool, error) {
+	change := metadataRepair{Key: key}
+	meta, err := bucket.GetObjectDetailedMeta(key)
+	if err != nil {
+		return change, false, err
+	}
+	etag := meta.Get("ETag")
+	var fixes []oss.Option
+
+	if contentType := meta.Get("Content-Type"); isGenericContentType(contentType) {
+		sniffed, err := sniffContentType(bucket, key, etag)
+		if err != nil {
+			return change, false, err
+		}
+		if sniffed != "application/octet-stream" && sniffed != contentType {
+			change.OldContentType, change.NewContentType = contentType, sniffed
+			fixes = append(fixes, oss.ContentType(sniffed))
+		}
+	}
+	if meta.Get(checksumMetaHeader) == "" {
+		change.AddChecksum = true
+		// dryRun 时不读取全部内容，只报告将会补充校验值
+		if !dryRun {
+			sum, err := objectSHA256(bucket, key, etag)
+			if err != nil {
+				return change, false, err
+			}
+			change.SHA256 = sum
+			fixes = append(fixes, oss.Meta(checksumMetaKey, sum))
+		}
+	}
+	needed := change.NewContentType != "" || change.AddChecksum
+	if !needed || dryRun {
+		return change, needed, nil
+	}
+
+	// 先放原有的头和元数据，修复项放在后面，同名时以修复项为准
+	options := append(objectHeaderOptions(meta, checksumMetaKey), fixes...)
+	if sc := meta.Get(oss.HTTPHeaderOssStorageClass); sc != "" {
+		options = append(options, oss.ObjectStorageClass(oss.StorageClassType(sc)))
+	}
+	options = append(options, oss.MetadataDirective(oss.MetaReplace), oss.CopySourceIfMatch(etag))
+	if _, err := bucket.CopyObject(key, key, options...); err != nil {
+		return change, false, fmt.Errorf("failed to update metadata: %v", err)
+	}
+	return change, true, nil
+}
+
+// 优先按扩展名识别，识别不出时读取前 512 字节用 http.DetectContentType 判断
+func sniffContentType(bucket *oss.Bucket, key, etag string) (string, error) {
+	if byExt := mime.TypeByExtension(filepath.Ext(key)); byExt != "" {
+		return byExt, nil
+	}
+	body, err := bucket.GetObject(key, oss.Range(0, 511), oss.IfMatch(etag))
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	head, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head), nil
+}
+
+// 读取对象的全部内容计算 SHA-256；以 ETag 为条件，保证计算的是随后被复制的同一版本
+func objectSHA256(bucket *oss.Bucket, key, etag string) (string, error) {
+	body, err := bucket.GetObject(key, oss.IfMatch(etag))
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
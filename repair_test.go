@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+)
+
+func pngBytes(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 准备修复用的对象：缺类型和校验值、类型为通用类型且没有扩展名、元数据完整
+func newRepairFixture(t *testing.T) (*fakeOSS, []byte, []byte) {
+	fake := newFakeOSS(t)
+	jsonData := []byte(`{"a":1}`)
+	pngData := pngBytes(t, 2, 2)
+	fake.put("data/a.json", jsonData, http.Header{"X-Oss-Meta-Owner": {"alice"}, "Cache-Control": {"max-age=60"}})
+	fake.put("data/picture", pngData, http.Header{"Content-Type": {"application/octet-stream"}})
+	fake.put("data/ok.txt", []byte("ok"), http.Header{
+		"Content-Type":      {"text/plain"},
+		"X-Oss-Meta-Sha256": {sha256Hex([]byte("ok"))},
+	})
+	fake.put("data/", nil, nil)
+	fake.put("other/b.json", []byte(`{}`), nil)
+	return fake, jsonData, pngData
+}
+
+func TestRepairMetadata(t *testing.T) {
+	fake, jsonData, pngData := newRepairFixture(t)
+	var repaired []string
+	report, err := repairMetadata(fake.bucket(t), "data/", nil, false, func(key string) { repaired = append(repaired, key) })
+	if err != nil {
+		t.Fatalf("repairMetadata: %v", err)
+	}
+	// 目录标记不计入，其他前缀下的对象不扫描
+	if report.Scanned != 3 || report.Repaired != 2 || report.Failed != 0 {
+		t.Fatalf("report = %+v, want 3 scanned, 2 repaired, 0 failed", report)
+	}
+	if len(repaired) != 2 {
+		t.Errorf("repaired callback called for %v, want 2 keys", repaired)
+	}
+
+	obj, _ := fake.object("data/a.json")
+	if got := obj.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("a.json Content-Type = %q, want application/json", got)
+	}
+	if got := obj.header.Get("X-Oss-Meta-Sha256"); got != sha256Hex(jsonData) {
+		t.Errorf("a.json sha256 = %q, want %q", got, sha256Hex(jsonData))
+	}
+	// 原有的头和元数据保留
+	if obj.header.Get("X-Oss-Meta-Owner") != "alice" || obj.header.Get("Cache-Control") != "max-age=60" {
+		t.Errorf("a.json lost its existing metadata: %v", obj.header)
+	}
+
+	obj, _ = fake.object("data/picture")
+	if got := obj.header.Get("Content-Type"); got != "image/png" {
+		t.Errorf("picture Content-Type = %q, want image/png sniffed from the content", got)
+	}
+	if got := obj.header.Get("X-Oss-Meta-Sha256"); got != sha256Hex(pngData) {
+		t.Errorf("picture sha256 = %q, want %q", got, sha256Hex(pngData))
+	}
+
+	for _, change := range report.Changes {
+		if change.Key == "data/ok.txt" {
+			t.Errorf("object with complete metadata was changed: %+v", change)
+		}
+	}
+}
+
+func TestRepairMetadataDryRun(t *testing.T) {
+	fake, _, _ := newRepairFixture(t)
+	report, err := repairMetadata(fake.bucket(t), "data/", nil, true, func(key string) {
+		t.Errorf("repaired callback called for %s in dry run", key)
+	})
+	if err != nil {
+		t.Fatalf("repairMetadata: %v", err)
+	}
+	if report.Repaired != 2 || !report.DryRun {
+		t.Fatalf("report = %+v, want 2 objects to repair", report)
+	}
+	for _, change := range report.Changes {
+		if !change.AddChecksum || change.SHA256 != "" {
+			t.Errorf("%s: dry run should report a missing checksum without computing it: %+v", change.Key, change)
+		}
+	}
+	if obj, _ := fake.object("data/a.json"); obj.header.Get("Content-Type") != "" || obj.header.Get("X-Oss-Meta-Sha256") != "" {
+		t.Errorf("dry run modified a.json: %v", obj.header)
+	}
+}
+
+func TestRepairMetadataSkip(t *testing.T) {
+	fake, _, _ := newRepairFixture(t)
+	report, err := repairMetadata(fake.bucket(t), "", []string{"data/"}, true, func(string) {})
+	if err != nil {
+		t.Fatalf("repairMetadata: %v", err)
+	}
+	if report.Scanned != 1 || len(report.Changes) != 1 || report.Changes[0].Key != "other/b.json" {
+		t.Errorf("report = %+v, want only other/b.json scanned", report)
+	}
+}
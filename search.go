@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// searchLimits 内容搜索的范围限制
+type searchLimits struct {
+	maxObjectSize int64 // 超过这个大小的对象不下载
+	maxTotalBytes int64 // 一次搜索最多下载的字节数，达到后停止并返回已有结果
+	concurrency   int
+}
+
+// searchMatch 内容包含搜索串的对象
+type searchMatch struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// searchResult 一次搜索的结果汇总
+type searchResult struct {
+	Listed       int           `json:"listed"`       // 列举到的对象数
+	Scanned      int           `json:"scanned"`      // 实际下载并检查的对象数
+	SkippedLarge int           `json:"skippedLarge"` // 超过大小上限而跳过的对象数
+	BytesScanned int64         `json:"bytesScanned"`
+	Failed       int           `json:"failed"`    // 读取失败而跳过的对象数
+	Truncated    bool          `json:"truncated"` // 达到总字节数上限，后面的对象没有检查
+	Matched      int           `json:"matched"`
+	Matches      []searchMatch `json:"matches"`
+}
+
+// 暴力搜索：列举 prefix 下的对象，逐个下载不超过大小上限的对象并检查内容是否包含 query，不使用任何索引
+// 下载量受 maxTotalBytes 限制，超出时 truncated 为 true；单个对象读取失败时跳过，不影响其他对象
+func searchObjects(bucket *oss.Bucket, prefix string, query []byte, skip []string, limits searchLimits, options ...oss.Option) (searchResult, error) {
+	result := searchResult{Matches: []searchMatch{}}
+	var budget int64 = limits.maxTotalBytes
+	var mu sync.Mutex
+	objects := make(chan oss.ObjectProperties)
+	var wg sync.WaitGroup
+	for w := 0; w < limits.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range objects {
+				found, n, err := objectContains(bucket, object.Key, query, limits.maxObjectSize, options...)
+				mu.Lock()
+				result.BytesScanned += n
+				if err != nil {
+					result.Failed++
+				} else {
+					result.Scanned++
+				}
+				if found {
+					result.Matches = append(result.Matches, searchMatch{Key: object.Key, Size: object.Size})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var listErr error
+	marker := ""
+scan:
+	for {
+		res, err := bucket.ListObjects(append(options, oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000))...)
+		if err != nil {
+			listErr = fmt.Errorf("failed to list objects: %v", err)
+			break
+		}
+		for _, object := range res.Objects {
+			if hasAnyPrefix(object.Key, skip) || isDirectoryMarker(object) {
+				continue
+			}
+			result.Listed++
+			if object.Size > limits.maxObjectSize {
+				result.SkippedLarge++
+				continue
+			}
+			// 按列举到的大小预先扣除额度，并发下载时总量也不会超过上限
+			if object.Size > budget {
+				result.Truncated = true
+				break scan
+			}
+			budget -= object.Size
+			objects <- object
+		}
+		if !res.IsTruncated {
+			break
+		}
+		marker = res.NextMarker
+	}
+	close(objects)
+	wg.Wait()
+
+	sort.Slice(result.Matches, func(i, j int) bool { return result.Matches[i].Key < result.Matches[j].Key })
+	result.Matched = len(result.Matches)
+	return result, listErr
+}
+
+// 下载对象（最多 maxSize 字节）并检查是否包含 query，返回读取的字节数
+func objectContains(bucket *oss.Bucket, key string, query []byte, maxSize int64, options ...oss.Option) (bool, int64, error) {
+	body, err := bucket.GetObject(key, options...)
+	if err != nil {
+		return false, 0, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxSize))
+	if err != nil {
+		return false, int64(len(data)), err
+	}
+	return bytes.Contains(data, query), int64(len(data)), nil
+}
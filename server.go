@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 启动 HTTP 服务并在 ctx 取消（收到退出信号）后优雅退出：停止接受新连接，等待进行中的请求在 shutdownTimeout 内完成
+// 配置了证书时直接提供 HTTPS，net/http 会通过 ALPN 自动启用 HTTP/2；否则使用明文 HTTP
+func serve(ctx context.Context, addr string, handler http.Handler, certFile, keyFile string, shutdownTimeout time.Duration) error {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	useTLS := certFile != "" && keyFile != ""
+	if useTLS {
+		srv.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: []string{"h2", "http/1.1"},
+		}
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if useTLS {
+			log.Printf("Listening on %s (HTTPS, HTTP/2 enabled)", addr)
+			errCh <- srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			log.Printf("Listening on %s (HTTP)", addr)
+			errCh <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	log.Printf("Shutting down, waiting up to %v for in-flight requests", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// gin 按原始路径匹配时用 url.QueryUnescape 解码路由参数，会把路径中字面的 "+" 解码成空格（只在原始路径与默认编码不同，
+// 例如含 %2F 时发生）；交给 gin 之前把原始路径中的 "+" 编码为 %2B，解码后仍是 "+"
+func literalPlusPath(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.RawPath, "+") {
+			u := *r.URL
+			u.RawPath = strings.ReplaceAll(u.RawPath, "+", "%2B")
+			r2 := *r
+			r2.URL = &u
+			r = &r2
+		}
+		h.ServeHTTP(w, r)
+	})
+}
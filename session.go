@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 可续传的下载会话：令牌绑定对象和创建时的 ETag，客户端断线后带上偏移量继续下载，
+// 对象在会话期间被修改时拒绝续传，保证拼接起来的是同一个版本的内容
+// 只保存在内存中，重启后需重新创建会话
+type downloadSessionStore struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]downloadSession
+}
+
+type downloadSession struct {
+	bucket  *oss.Bucket
+	key     string
+	etag    string
+	size    int64
+	meta    http.Header
+	expires time.Time
+}
+
+func newDownloadSessionStore(ttl time.Duration) *downloadSessionStore {
+	return &downloadSessionStore{ttl: ttl, sessions: make(map[string]downloadSession)}
+}
+
+// 创建会话并返回令牌，同时清理已过期的会话
+func (s *downloadSessionStore) create(bucket *oss.Bucket, key string, size int64, meta http.Header) (string, downloadSession) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	now := time.Now()
+	session := downloadSession{bucket: bucket, key: key, etag: meta.Get("ETag"), size: size, meta: meta, expires: now.Add(s.ttl)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t, existing := range s.sessions {
+		if now.After(existing.expires) {
+			delete(s.sessions, t)
+		}
+	}
+	s.sessions[token] = session
+	return token, session
+}
+
+func (s *downloadSessionStore) get(token string) (downloadSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[token]
+	if !ok || time.Now().After(session.expires) {
+		return downloadSession{}, false
+	}
+	return session, true
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 启动时输出生效的配置摘要和路由表，便于确认服务按预期的配置启动
+// 每行一个 key=value 形式的条目，凭据只显示最后 4 个字符
+func logStartupSummary(cfg *Config, addr string, ffmpeg bool, routes gin.RoutesInfo) {
+	log.Printf("Startup: endpoint=%s bucket=%s accessKeyId=%s addr=%s", cfg.Endpoint, cfg.BucketName, redactSecret(cfg.AccessKeyID), addr)
+
+	features := []struct {
+		name    string
+		enabled bool
+		detail  string
+	}{
+		{"adminAuth", cfg.AdminToken != "", ""},
+		{"apiKeyAuth", cfg.APIKey != "", "visibilityMetaKey=" + cfg.VisibilityMetaKey},
+		{"ossConcurrencyLimit", cfg.OSSMaxReadConcurrency > 0 || cfg.OSSMaxWriteConcurrency > 0, fmt.Sprintf("read=%d write=%d", cfg.OSSMaxReadConcurrency, cfg.OSSMaxWriteConcurrency)},
+		{"circuitBreaker", cfg.OSSBreakerThreshold > 0, fmt.Sprintf("threshold=%d cooldown=%s", cfg.OSSBreakerThreshold, cfg.OSSBreakerCooldown)},
+		{"listCache", cfg.ListCacheTTL > 0, "ttl=" + cfg.ListCacheTTL.String()},
+		{"downloadCache", cfg.DownloadCacheDir != "", "dir=" + cfg.DownloadCacheDir},
+		{"downloadGzip", cfg.DownloadGzip, fmt.Sprintf("minSize=%d level=%d", cfg.DownloadGzipMinSize, cfg.DownloadGzipLevel)},
+		{"tls", cfg.TLSCertFile != "" && cfg.TLSKeyFile != "", ""},
+		{"tracing", tracingEnabled(), ""},
+		{"softDelete", cfg.SoftDelete, "trashPrefix=" + cfg.TrashPrefix},
+		{"webhooks", cfg.WebhookURL != "", ""},
+		{"failoverReads", cfg.FailoverEndpoint != "", "endpoint=" + cfg.FailoverEndpoint + " bucket=" + cfg.FailoverBucketName},
+		{"extraBuckets", cfg.AllowedBuckets != "", "buckets=" + cfg.AllowedBuckets},
+		{"caseInsensitiveLookup", cfg.CaseInsensitiveLookup, ""},
+		{"keyEncoding", cfg.KeyEncodingStrategy != KeyEncodingOff, "strategy=" + cfg.KeyEncodingStrategy},
+		{"idempotency", cfg.IdempotencyWindow > 0, "window=" + cfg.IdempotencyWindow.String()},
+		{"uploadReadTimeout", cfg.UploadIdleTimeout > 0, fmt.Sprintf("idle=%s total=%s", cfg.UploadIdleTimeout, cfg.UploadReadTimeout)},
+		{"transcoding", ffmpeg, fmt.Sprintf("workers=%d queue=%d", cfg.TranscodeWorkers, cfg.TranscodeQueueSize)},
+	}
+	var enabled, disabled []string
+	for _, f := range features {
+		if !f.enabled {
+			disabled = append(disabled, f.name)
+			continue
+		}
+		enabled = append(enabled, f.name)
+		if f.detail != "" {
+			log.Printf("Startup: feature=%s %s", f.name, f.detail)
+		}
+	}
+	log.Printf("Startup: enabled=%s", strings.Join(enabled, ","))
+	log.Printf("Startup: disabled=%s", strings.Join(disabled, ","))
+
+	sorted := append(gin.RoutesInfo(nil), routes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Method < sorted[j].Method
+	})
+	log.Printf("Startup: %d route(s)", len(sorted))
+	for _, route := range sorted {
+		log.Printf("Startup: route=%s %s", route.Method, route.Path)
+	}
+}
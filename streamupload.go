@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// declaredLengthReader 检查请求体的实际长度与声明的 Content-Length 一致：多读或提前结束时返回错误并记录在 err 中，
+// 上传因此失败（分片上传会被取消），不会写入不完整的对象；调用方据 err 区分长度不符和 OSS 的错误
+type declaredLengthReader struct {
+	r        io.Reader
+	declared int64
+	n        int64
+	err      error
+}
+
+func (d *declaredLengthReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	switch {
+	case d.n > d.declared:
+		d.err = fmt.Errorf("request body is longer than the declared Content-Length of %d bytes", d.declared)
+		return n, d.err
+	case err == io.EOF && d.n < d.declared:
+		d.err = fmt.Errorf("request body ended after %d of the declared %d bytes", d.n, d.declared)
+		return n, d.err
+	case err != nil && err != io.EOF && d.n < d.declared:
+		d.err = fmt.Errorf("request body ended after %d of the declared %d bytes: %v", d.n, d.declared, err)
+	}
+	return n, err
+}
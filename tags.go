@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// tagFilter 按对象标签筛选的条件，格式为 key=value
+type tagFilter struct {
+	key   string
+	value string
+}
+
+func parseTagFilter(value string) (tagFilter, error) {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return tagFilter{}, fmt.Errorf("tag must be in the form key=value, got %q", value)
+	}
+	return tagFilter{key: key, value: val}, nil
+}
+
+func (f tagFilter) String() string {
+	return f.key + "=" + f.value
+}
+
+func (f tagFilter) match(tags []oss.Tag) bool {
+	for _, t := range tags {
+		if t.Key == f.key && t.Value == f.value {
+			return true
+		}
+	}
+	return false
+}
+
+// 列举 prefix 下带有指定标签的对象（跳过 skip 中的前缀和目录标记），结果按对象名排序
+// OSS 不支持按标签列举，只能对每个对象调用一次 GetObjectTagging：扫描 N 个对象就是 N 次额外的请求，
+// 耗时和请求费用都与 prefix 下的对象总数成正比；每页内最多 workers 个请求并发
+// 返回扫描的对象数；任何一次查询失败都会中止扫描
+func findObjectsByTag(bucket *oss.Bucket, prefix string, skip []string, filter tagFilter, workers int, options ...oss.Option) ([]oss.ObjectProperties, int, error) {
+	var matches []oss.ObjectProperties
+	scanned := 0
+	marker := ""
+	for {
+		res, err := bucket.ListObjects(append(options, oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000))...)
+		if err != nil {
+			return matches, scanned, fmt.Errorf("failed to list objects: %v", err)
+		}
+		var candidates []oss.ObjectProperties
+		for _, object := range res.Objects {
+			if !hasAnyPrefix(object.Key, skip) && !isDirectoryMarker(object) {
+				candidates = append(candidates, object)
+			}
+		}
+		matched, err := matchTags(bucket, candidates, filter, workers, options...)
+		if err != nil {
+			return matches, scanned, err
+		}
+		scanned += len(candidates)
+		for i, ok := range matched {
+			if ok {
+				matches = append(matches, candidates[i])
+			}
+		}
+		if !res.IsTruncated {
+			return matches, scanned, nil
+		}
+		marker = res.NextMarker
+	}
+}
+
+// 并发查询一页对象的标签，返回与 objects 一一对应的匹配结果
+func matchTags(bucket *oss.Bucket, objects []oss.ObjectProperties, filter tagFilter, workers int, options ...oss.Option) ([]bool, error) {
+	matched := make([]bool, len(objects))
+	errs := make([]error, len(objects))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				res, err := bucket.GetObjectTagging(objects[i].Key, options...)
+				if isNoSuchKey(err) {
+					// 列举之后被删除的对象不算匹配
+					continue
+				}
+				if err != nil {
+					errs[i] = fmt.Errorf("failed to get tags of %s: %v", objects[i].Key, err)
+					continue
+				}
+				matched[i] = filter.match(res.Tags)
+			}
+		}()
+	}
+	for i := range objects {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matched, nil
+}
+
+// 删除指定的对象，每批最多 1000 个，返回成功删除的对象名
+func deleteKeys(bucket *oss.Bucket, keys []string) ([]string, error) {
+	var deleted []string
+	for start := 0; start < len(keys); start += 1000 {
+		res, err := bucket.DeleteObjects(keys[start:min(start+1000, len(keys))])
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, res.DeletedObjects...)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 等待时间的上限，避免 OSS 返回异常大的 Retry-After 时长时间占住请求
+const maxThrottleWait = 10 * time.Second
+
+// ossThrottle 应对 OSS 限流（503 SlowDown 或带 Retry-After 的 429/503）：
+//   - 可重放的请求按 Retry-After（没有时按指数退避）等待后重试，最多 retries 次
+//   - 每次被限流后的 window 内，同时发往 OSS 的请求最多 concurrency 个，主动降低请求速率
+type ossThrottle struct {
+	retries int
+	backoff time.Duration // 没有 Retry-After 时第一次重试前的等待时间，之后每次翻倍
+	window  time.Duration
+	slots   chan struct{}
+
+	mu    sync.Mutex
+	until time.Time // 收紧并发的结束时间
+
+	throttled atomic.Int64 // OSS 返回限流的次数
+	retried   atomic.Int64
+	lastAt    atomic.Int64 // 最近一次被限流的时间（Unix 纳秒）
+}
+
+func newOSSThrottle(retries int, backoff, window time.Duration, concurrency int) *ossThrottle {
+	return &ossThrottle{retries: retries, backoff: backoff, window: window, slots: make(chan struct{}, concurrency)}
+}
+
+func (t *ossThrottle) active() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Now().Before(t.until)
+}
+
+func (t *ossThrottle) observe() {
+	t.throttled.Add(1)
+	t.lastAt.Store(time.Now().UnixNano())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !time.Now().Before(t.until) {
+		log.Printf("OSS is throttling requests, limiting to %d concurrent OSS request(s) for %s", cap(t.slots), t.window)
+	}
+	t.until = time.Now().Add(t.window)
+}
+
+func (t *ossThrottle) stats() gin.H {
+	stats := gin.H{
+		"active":    t.active(),
+		"throttled": t.throttled.Load(),
+		"retried":   t.retried.Load(),
+	}
+	if last := t.lastAt.Load(); last != 0 {
+		stats["lastThrottledAt"] = time.Unix(0, last).UTC()
+	}
+	return stats
+}
+
+// 判断响应是否为限流，是限流时返回建议的等待时间（没有 Retry-After 时为 0）
+// 为读取错误码会读入 503 响应的前 4KB，随后复原响应体，SDK 仍能正常解析
+func throttleWait(resp *http.Response) (bool, time.Duration) {
+	if resp.StatusCode != http.StatusServiceUnavailable && resp.StatusCode != http.StatusTooManyRequests {
+		return false, 0
+	}
+	wait, hasRetryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if resp.StatusCode == http.StatusTooManyRequests || hasRetryAfter {
+		return true, wait
+	}
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	return bytes.Contains(head, []byte("<Code>SlowDown</Code>")), 0
+}
+
+// Retry-After 可以是秒数或 HTTP 日期
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// throttleTransport 在 OSS 客户端的传输层处理限流，见 ossThrottle
+// 请求体不能重放（例如流式上传）时不重试，限流响应原样交给 SDK
+type throttleTransport struct {
+	base     http.RoundTripper
+	throttle *ossThrottle
+}
+
+func (t throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		acquired := false
+		if t.throttle.active() {
+			select {
+			case t.throttle.slots <- struct{}{}:
+				acquired = true
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+		resp, err := t.base.RoundTrip(req)
+		// 名额只覆盖发出请求到收到响应头的时间，退避等待期间不占用名额
+		if acquired {
+			<-t.throttle.slots
+		}
+		if err != nil {
+			return nil, err
+		}
+		throttled, wait := throttleWait(resp)
+		if !throttled {
+			return resp, nil
+		}
+		t.throttle.observe()
+		replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if attempt >= t.throttle.retries || !replayable {
+			return resp, nil
+		}
+		if wait == 0 {
+			wait = t.throttle.backoff << attempt
+		}
+		wait = min(wait, maxThrottleWait)
+		resp.Body.Close()
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		t.throttle.retried.Add(1)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"golang.org/x/image/draw"
+)
+
+// 缩略图的最大边长
+const maxThumbnailSize = 2000
+
+// format=datauri 时的最大边长：base64 会让体积增加三分之一，并且无法被浏览器单独缓存，只适合很小的预览图
+const maxDataURIThumbnailSize = 256
+
+// 缩略图对象名：<原名去掉扩展名>_<宽>x<高><扩展名>，例如 photo_200x200.jpg
+func thumbnailKey(source string, width, height int, ext string) string {
+	return fmt.Sprintf("%s_%dx%d%s", strings.TrimSuffix(source, filepath.Ext(source)), width, height, ext)
+}
+
+// 缩略图的输出格式：PNG 和 GIF 源图保留透明通道输出 PNG，其余输出 JPEG
+func thumbnailExt(source string) string {
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".png", ".gif":
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// 源图超过 THUMBNAIL_MAX_SOURCE_SIZE 或 THUMBNAIL_MAX_PIXELS 时返回的错误
+var errThumbnailTooLarge = errors.New("image is too large to generate a thumbnail")
+
+// 生成缩略图：优先用纯 Go 的方式解码并缩放，标准库无法解码的格式（如 webp、heic）再交给 ffmpeg
+// 结果按比例缩放到 width x height 的框内
+// 解码前先检查源图的字节数和像素数：解码后的图像按每像素 4 字节以上占用内存，很小的文件也可能声明巨大的尺寸
+func makeThumbnail(src io.Reader, width, height int, ext string, opts transcodeOptions) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(src, opts.thumbnailMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > opts.thumbnailMaxBytes {
+		return nil, permanentError{fmt.Errorf("%w: source exceeds %d bytes", errThumbnailTooLarge, opts.thumbnailMaxBytes)}
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if !errors.Is(err, image.ErrFormat) {
+			return nil, permanentError{fmt.Errorf("failed to decode image: %v", err)}
+		}
+		if !opts.ffmpegAvailable {
+			return nil, permanentError{fmt.Errorf("unsupported image format")}
+		}
+		return ffmpegThumbnail(data, width, height, ext, opts)
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > opts.thumbnailMaxPixels {
+		return nil, permanentError{fmt.Errorf("%w: %dx%d exceeds %d pixels", errThumbnailTooLarge, config.Width, config.Height, opts.thumbnailMaxPixels)}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, permanentError{fmt.Errorf("failed to decode image: %v", err)}
+	}
+
+	w, h := fitWithin(img.Bounds().Dx(), img.Bounds().Dy(), width, height)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if ext == ".png" {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 使用 ffmpeg 生成缩略图，force_original_aspect_ratio 保证结果不超过指定尺寸
+func ffmpegThumbnail(data []byte, width, height int, ext string, opts transcodeOptions) ([]byte, error) {
+	tmpDir, err := os.MkdirTemp("", "thumbnail-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	inPath := filepath.Join(tmpDir, "input")
+	outPath := filepath.Join(tmpDir, "output"+ext)
+	if err := os.WriteFile(inPath, data, 0600); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.ffmpegTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	scale := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", width, height)
+	cmd := exec.CommandContext(ctx, opts.ffmpegPath, "-y", "-i", inPath, "-vf", scale, "-frames:v", "1", outPath)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, classifyFFmpegError(ctx, err, stderr.String(), opts.ffmpegTimeout)
+	}
+	return os.ReadFile(outPath)
+}
+
+// 计算按比例缩放到 maxW x maxH 框内的尺寸，不放大原图
+func fitWithin(w, h, maxW, maxH int) (int, int) {
+	if w <= maxW && h <= maxH {
+		return w, h
+	}
+	if w*maxH > h*maxW {
+		return maxW, max(1, h*maxW/w)
+	}
+	return max(1, w*maxH/h), maxH
+}
+
+// 读取已生成的缩略图，不存在时返回 nil, nil
+func getCachedThumbnail(bucket *oss.Bucket, key string) ([]byte, error) {
+	body, err := bucket.GetObject(key)
+	if err != nil {
+		if isNoSuchKey(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
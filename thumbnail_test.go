@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image/png"
+	"testing"
+)
+
+// 把 PNG 的 IHDR 改成声明 width x height，只有几十字节却需要巨大的内存解码
+func pngWithDeclaredSize(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	data := pngBytes(t, 1, 1)
+	// 8 字节签名之后是 IHDR：长度(4) 类型(4) 宽(4) 高(4) ... CRC(4)
+	ihdr := data[8+4 : 8+4+4+13]
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	binary.BigEndian.PutUint32(data[8+4+4+13:], crc32.ChecksumIEEE(ihdr))
+	return data
+}
+
+func TestMakeThumbnailLimits(t *testing.T) {
+	opts := transcodeOptions{thumbnailMaxBytes: 1 << 20, thumbnailMaxPixels: 100 * 100}
+	tests := []struct {
+		name     string
+		data     []byte
+		maxBytes int64
+		tooLarge bool
+	}{
+		{"within limits", pngBytes(t, 100, 100), 0, false},
+		{"too many pixels", pngBytes(t, 101, 100), 0, true},
+		{"declared size too large", pngWithDeclaredSize(t, 50000, 50000), 0, true},
+		{"source too large", pngBytes(t, 10, 10), 16, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := opts
+			if tt.maxBytes > 0 {
+				opts.thumbnailMaxBytes = tt.maxBytes
+			}
+			data, err := makeThumbnail(bytes.NewReader(tt.data), 20, 20, ".png", opts)
+			if tt.tooLarge {
+				if !errors.Is(err, errThumbnailTooLarge) || isRetryable(err) {
+					t.Fatalf("makeThumbnail() error = %v, want permanent errThumbnailTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := png.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != 20 || config.Height != 20 {
+				t.Errorf("thumbnail is %dx%d, want 20x20", config.Width, config.Height)
+			}
+		})
+	}
+}
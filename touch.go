@@ -0,0 +1,36 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 刷新对象的 Last-Modified：以 REPLACE 方式复制到自身，内容不变
+// REPLACE 会丢弃未重新提供的元数据，因此把类型、缓存头、自定义元数据和存储类型全部带上；以 ETag 为条件，复制期间对象被修改时返回 412
+// 复制得到的对象不保留原来的 ACL（恢复为继承存储桶），因此对象单独设置了 ACL 时一并带上
+func touchObject(bucket *oss.Bucket, key string, options ...oss.Option) (time.Time, error) {
+	meta, err := bucket.GetObjectDetailedMeta(key, options...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	acl, err := bucket.GetObjectACL(key, options...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	copyOptions := append(objectHeaderOptions(meta),
+		oss.MetadataDirective(oss.MetaReplace),
+		oss.CopySourceIfMatch(meta.Get("ETag")),
+	)
+	if sc := meta.Get(oss.HTTPHeaderOssStorageClass); sc != "" {
+		copyOptions = append(copyOptions, oss.ObjectStorageClass(oss.StorageClassType(sc)))
+	}
+	if acl.ACL != "" && acl.ACL != string(oss.ACLDefault) {
+		copyOptions = append(copyOptions, oss.ObjectACL(oss.ACLType(acl.ACL)))
+	}
+	res, err := bucket.CopyObject(key, key, append(copyOptions, options...)...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return res.LastModified, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracingServiceName = "oss_operation"
+
+// 设置了 OTLP 导出地址（OTEL_EXPORTER_OTLP_ENDPOINT 或 OTEL_EXPORTER_OTLP_TRACES_ENDPOINT）且未禁用 SDK 时才启用追踪
+// 其余配置（协议头、采样、服务名等）都由标准的 OTEL_ 环境变量决定
+func tracingEnabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// 初始化全局 TracerProvider 和 W3C trace context 传播，返回退出时用于刷新剩余 span 的函数
+// 未启用时什么都不做，全局 Tracer 保持 OpenTelemetry 默认的空实现
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	if !tracingEnabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME / OTEL_RESOURCE_ATTRIBUTES 优先于默认的服务名
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", tracingServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// 把请求的 context 传给 OSS 调用，使 OSS 的 span 成为请求 span 的子 span
+// 去掉取消信号，避免追踪改变原有行为：客户端断开时 OSS 调用是否中止仍由各处理函数自己决定
+func ossCtx(c *gin.Context) oss.Option {
+	return oss.WithContext(context.WithoutCancel(c.Request.Context()))
+}
+
+// OSS 客户端使用的 HTTP 客户端：与 SDK 自带的传输层一样设置超时、代理和连接池，
+// 启用追踪时为每次 OSS 请求记录一个 span，limiter 不为 nil 时限制并发的 OSS 请求数量，throttle 不为 nil 时处理 OSS 限流，
+// breaker 不为 nil 时记录每次请求的结果
+// SDK 自带的传输层无法从外部包装，因此这里按相同的配置重新创建
+func ossHTTPClient(cfg *Config, breaker *ossBreaker, throttle *ossThrottle, limiter *ossLimiter) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.OSSConnectTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return deadlineConn{Conn: conn, timeout: cfg.OSSReadWriteTimeout}, nil
+		},
+		TLSHandshakeTimeout:   cfg.OSSConnectTimeout,
+		MaxIdleConns:          cfg.OSSMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.OSSMaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.OSSMaxConnsPerHost,
+		ResponseHeaderTimeout: cfg.OSSReadWriteTimeout,
+		IdleConnTimeout:       cfg.OSSIdleConnTimeout,
+	}
+	var rt http.RoundTripper = transport
+	if tracingEnabled() {
+		rt = ossTracingTransport{base: rt, tracer: otel.Tracer(tracingServiceName)}
+	}
+	// 并发名额在限流重试之内，退避等待期间不占用名额
+	if limiter != nil {
+		rt = limiterTransport{base: rt, limiter: limiter}
+	}
+	// 限流重试在熔断器之内，熔断器只看到重试后的最终结果
+	if throttle != nil {
+		rt = throttleTransport{base: rt, throttle: throttle}
+	}
+	if breaker != nil {
+		rt = breakerTransport{base: rt, breaker: breaker}
+	}
+	return &http.Client{
+		Transport: rt,
+		// 与 SDK 默认行为一致，不跟随重定向
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// deadlineConn 与 SDK 的 timeoutConn 作用相同：每次读写前把连接的截止时间推后 timeout，
+// 超过 timeout 没有收到或发出任何数据时读写返回超时错误。ossCtx 去掉了请求的取消信号，
+// 没有这个截止时间时，OSS 停止发送数据的响应体（下载、导出、拼接等）会一直阻塞
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c deadlineConn) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+func (c deadlineConn) Write(b []byte) (int, error) {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(b)
+}
+
+// ossTracingTransport 为每个 OSS 请求创建 span，记录操作名、对象名和结果
+type ossTracingTransport struct {
+	base   http.RoundTripper
+	tracer trace.Tracer
+}
+
+func (t ossTracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := ossOperation(req)
+	key, _ := url.PathUnescape(strings.TrimPrefix(req.URL.EscapedPath(), "/"))
+	ctx, span := t.tracer.Start(req.Context(), "oss."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("oss.operation", operation),
+			attribute.String("oss.key", key),
+			attribute.String("http.request.method", req.Method),
+		))
+	defer span.End()
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attribute.String("oss.result", "error"))
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		result := strconv.Itoa(resp.StatusCode)
+		if code := resp.Header.Get("X-Oss-Ec"); code != "" {
+			result += " " + code
+		}
+		span.SetStatus(codes.Error, result)
+		span.SetAttributes(attribute.String("oss.result", result))
+	} else {
+		span.SetAttributes(attribute.String("oss.result", "ok"))
+	}
+	return resp, nil
+}
+
+// 根据请求方法和子资源推断 OSS 操作名
+func ossOperation(req *http.Request) string {
+	q := req.URL.Query()
+	has := func(name string) bool { _, ok := q[name]; return ok }
+	copySource := req.Header.Get("X-Oss-Copy-Source") != ""
+	objectLevel := req.URL.Path != "" && req.URL.Path != "/"
+	switch req.Method {
+	case http.MethodHead:
+		return "HeadObject"
+	case http.MethodGet:
+		switch {
+		case has("uploadId"):
+			return "ListParts"
+		case has("uploads"):
+			return "ListMultipartUploads"
+		case !objectLevel:
+			return "ListObjects"
+		}
+		return "GetObject"
+	case http.MethodPut:
+		switch {
+		case has("partNumber") && copySource:
+			return "UploadPartCopy"
+		case has("partNumber"):
+			return "UploadPart"
+		case copySource:
+			return "CopyObject"
+		}
+		return "PutObject"
+	case http.MethodPost:
+		switch {
+		case has("uploads"):
+			return "InitiateMultipartUpload"
+		case has("uploadId"):
+			return "CompleteMultipartUpload"
+		case has("delete"):
+			return "DeleteObjects"
+		}
+		return "PostObject"
+	case http.MethodDelete:
+		if has("uploadId") {
+			return "AbortMultipartUpload"
+		}
+		return "DeleteObject"
+	}
+	return req.Method
+}
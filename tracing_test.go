@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 统计服务端接受的连接数
+func newCountingServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, &conns
+}
+
+// 用 workers 个 goroutine 共发出 requests 个请求，每个响应体都读完并关闭，连接才能放回连接池
+func runConcurrentRequests(t *testing.T, client *http.Client, url string, workers, requests int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	var failed atomic.Int64
+	jobs := make(chan struct{})
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				resp, err := client.Get(url)
+				if err != nil {
+					failed.Add(1)
+					continue
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		}()
+	}
+	for i := 0; i < requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	if n := failed.Load(); n > 0 {
+		t.Fatalf("%d request(s) failed", n)
+	}
+}
+
+func testTransportConfig() *Config {
+	return &Config{
+		OSSConnectTimeout:      5 * time.Second,
+		OSSReadWriteTimeout:    5 * time.Second,
+		OSSMaxIdleConns:        100,
+		OSSMaxIdleConnsPerHost: 100,
+		OSSIdleConnTimeout:     time.Minute,
+	}
+}
+
+// 并发请求时复用连接：新建的连接数不超过并发数，而不是每个请求一个连接
+func TestOSSHTTPClientReusesConnections(t *testing.T) {
+	server, conns := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		io.WriteString(w, "ok")
+	})
+	client := ossHTTPClient(testTransportConfig(), nil, nil, nil)
+	const workers, requests = 8, 400
+	runConcurrentRequests(t, client, server.URL, workers, requests)
+	if n := conns.Load(); n > workers {
+		t.Errorf("%d connections for %d requests from %d workers, want at most %d", n, requests, workers, workers)
+	}
+}
+
+// OSS_MAX_CONNS_PER_HOST 限制同时打开的连接数，超出的请求等待空闲连接
+func TestOSSHTTPClientMaxConnsPerHost(t *testing.T) {
+	var active, peak atomic.Int64
+	server, conns := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		io.WriteString(w, "ok")
+	})
+	cfg := testTransportConfig()
+	cfg.OSSMaxConnsPerHost = 2
+	client := ossHTTPClient(cfg, nil, nil, nil)
+	runConcurrentRequests(t, client, server.URL, 16, 100)
+	if n := conns.Load(); n > 2 {
+		t.Errorf("%d connections opened, want at most 2", n)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d requests in flight at once, want at most 2", p)
+	}
+}
+
+// MaxIdleConnsPerHost 小于并发数时，多出的连接用完即关闭，之后的请求需要新建连接
+func TestOSSHTTPClientIdlePoolSize(t *testing.T) {
+	server, conns := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		io.WriteString(w, "ok")
+	})
+	cfg := testTransportConfig()
+	cfg.OSSMaxIdleConnsPerHost = 1
+	client := ossHTTPClient(cfg, nil, nil, nil)
+	runConcurrentRequests(t, client, server.URL, 8, 200)
+	if n := conns.Load(); n <= 8 {
+		t.Errorf("%d connections opened, expected connections beyond the idle pool to be closed and reopened", n)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// mediaPipeline 描述一类媒体（图片、音频、视频）的转码方式
+type mediaPipeline struct {
+	kind          string
+	formats       map[string]bool // 允许的目标格式
+	defaultFormat string
+	needsFFmpeg   bool // 依赖外部 ffmpeg，未安装时该类型的转码不可用
+	clippable     bool // 支持只转码其中一段（start/duration）
+	convert       func(inPath, outPath, format string, clip mediaClip, opts transcodeOptions) error
+}
+
+// 按 Content-Type 的主类型分发到不同的转码流程，新增媒体类型时在这里注册即可
+var mediaPipelines = map[string]*mediaPipeline{
+	"image": {
+		kind:          "image",
+		formats:       map[string]bool{"png": true, "jpg": true, "jpeg": true, "gif": true},
+		defaultFormat: "png",
+		convert:       convertImage,
+	},
+	"audio": {
+		kind:          "audio",
+		formats:       map[string]bool{"mp3": true, "wav": true, "aac": true, "ogg": true, "flac": true, "m4a": true},
+		defaultFormat: "mp3",
+		needsFFmpeg:   true,
+		clippable:     true,
+		convert:       runFFmpeg,
+	},
+	"video": {
+		kind:          "video",
+		formats:       map[string]bool{"mp4": true, "webm": true, "mkv": true, "mov": true},
+		defaultFormat: "mp4",
+		needsFFmpeg:   true,
+		clippable:     true,
+		convert:       runFFmpeg,
+	},
+}
+
+// 根据对象的 Content-Type 找到对应的转码流程
+// 存储的类型缺失或为通用的 application/octet-stream 时，按扩展名推断
+func pipelineFor(contentType, key string) (*mediaPipeline, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(key)))
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	pipeline, ok := mediaPipelines[major]
+	return pipeline, ok
+}
+
+// ffmpeg 输出中出现这些内容说明输入或参数本身有问题，重试也不会成功
+var permanentFFmpegMarkers = []string{
+	"Invalid data found when processing input",
+	"Unknown encoder",
+	"Unknown format",
+	"not supported",
+	"Unsupported",
+	"Invalid argument",
+}
+
+// transcodeOptions 转码任务的配置
+type transcodeOptions struct {
+	ffmpegPath       string
+	ffmpegAvailable  bool   // 启动时检测 ffmpeg 是否可用
+	ffprobePath      string // 用于读取媒体时长，校验片段范围
+	ffprobeAvailable bool
+	maxAttempts      int           // 最大尝试次数（包含第一次）
+	retryBackoff     time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	ffmpegTimeout    time.Duration // 单次 ffmpeg 运行的时间上限，超时后终止进程
+	ffprobeTimeout   time.Duration
+	// 缩略图源图的字节数和像素数上限
+	thumbnailMaxBytes  int64
+	thumbnailMaxPixels int64
+}
+
+// permanentError 表示不可重试的失败，例如格式不支持或源对象不存在
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func isRetryable(err error) bool {
+	var perm permanentError
+	return !errors.As(err, &perm)
+}
+
+// mediaClip 只转码媒体中的一段，单位为秒；duration 为 0 表示一直到结尾，零值表示转码整个文件
+type mediaClip struct {
+	start, duration float64
+}
+
+func (c mediaClip) active() bool { return c.start > 0 || c.duration > 0 }
+
+// 解析 start、duration 参数（秒，可以带小数）
+func parseMediaClip(start, duration string) (mediaClip, error) {
+	var clip mediaClip
+	if start != "" {
+		v, err := strconv.ParseFloat(start, 64)
+		if err != nil || v < 0 {
+			return clip, fmt.Errorf("start must be a non-negative number of seconds, got %q", start)
+		}
+		clip.start = v
+	}
+	if duration != "" {
+		v, err := strconv.ParseFloat(duration, 64)
+		if err != nil || v <= 0 {
+			return clip, fmt.Errorf("duration must be a positive number of seconds, got %q", duration)
+		}
+		clip.duration = v
+	}
+	return clip, nil
+}
+
+// 检查片段是否落在媒体时长之内
+func (c mediaClip) within(total float64) error {
+	if c.start >= total {
+		return fmt.Errorf("start %gs is beyond the media duration of %gs", c.start, total)
+	}
+	if c.duration > 0 && c.start+c.duration > total {
+		return fmt.Errorf("start+duration %gs exceeds the media duration of %gs", c.start+c.duration, total)
+	}
+	return nil
+}
+
+// 用 ffprobe 读取媒体时长（秒），input 可以是本地路径或签名地址，ffprobe 只需读取文件头部
+// ctx 取消或超过 FFPROBE_TIMEOUT 时终止 ffprobe，超时返回的错误包含 context.DeadlineExceeded
+func probeDuration(ctx context.Context, input string, opts transcodeOptions) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.ffprobeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, opts.ffprobePath, "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", input).Output()
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("ffprobe stopped: %w", ctx.Err())
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %v", err)
+	}
+	total, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe returned no duration")
+	}
+	return total, nil
+}
+
+// 转码结果的对象名：去掉原扩展名，加上 _transcoded 后缀和新扩展名
+// 只转码一段时使用单独的名字 <原名>_preview_<start>s_<duration>s.<格式>，不会覆盖完整的转码结果
+func transcodeOutputKey(source, format string, clip mediaClip) string {
+	stem := strings.TrimSuffix(source, filepath.Ext(source))
+	if clip.active() {
+		return fmt.Sprintf("%s_preview_%gs_%gs.%s", stem, clip.start, clip.duration, format)
+	}
+	return stem + "_transcoded." + format
+}
+
+// 执行转码任务，可重试的失败按指数退避自动重试，直到成功或达到最大次数
+func runTranscodeJob(bucket *oss.Bucket, jobs *jobStore, id, source, format string, clip mediaClip, pipeline *mediaPipeline, opts transcodeOptions) {
+	output := transcodeOutputKey(source, format, clip)
+	for attempt := 1; ; attempt++ {
+		jobs.update(id, func(job *Job) {
+			job.Status = JobRunning
+			job.Attempts = append(job.Attempts, JobAttempt{Number: attempt, StartedAt: time.Now()})
+		})
+
+		err := transcodeObject(bucket, source, output, format, clip, pipeline, opts)
+		retryable := err != nil && isRetryable(err)
+		done := err == nil || !retryable || attempt >= opts.maxAttempts
+
+		jobs.update(id, func(job *Job) {
+			last := &job.Attempts[len(job.Attempts)-1]
+			last.FinishedAt = time.Now()
+			if err != nil {
+				last.Error = err.Error()
+				last.Retryable = retryable
+			}
+			switch {
+			case err == nil:
+				job.Status = JobSucceeded
+				job.Output = output
+				job.Error = ""
+			case done:
+				job.Status = JobFailed
+				job.Error = err.Error()
+			default:
+				job.Status = JobRetrying
+			}
+		})
+
+		if err == nil {
+			log.Printf("Transcode job %s succeeded: %s -> %s", id, source, output)
+			return
+		}
+		if done {
+			log.Printf("Transcode job %s failed permanently after %d attempt(s): %v", id, attempt, err)
+			return
+		}
+		backoff := opts.retryBackoff << (attempt - 1)
+		log.Printf("Transcode job %s attempt %d failed, retrying in %s: %v", id, attempt, backoff, err)
+		time.Sleep(backoff)
+	}
+}
+
+// 下载源对象到临时目录，按媒体类型转码后上传结果
+func transcodeObject(bucket *oss.Bucket, source, output, format string, clip mediaClip, pipeline *mediaPipeline, opts transcodeOptions) error {
+	tmpDir, err := os.MkdirTemp("", "transcode-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	inPath := filepath.Join(tmpDir, "input"+filepath.Ext(source))
+	outPath := filepath.Join(tmpDir, "output."+format)
+	if err := bucket.GetObjectToFile(source, inPath); err != nil {
+		if isNoSuchKey(err) {
+			return permanentError{fmt.Errorf("source object '%s' does not exist", source)}
+		}
+		return fmt.Errorf("failed to download source object: %v", err)
+	}
+
+	if err := pipeline.convert(inPath, outPath, format, clip, opts); err != nil {
+		return err
+	}
+
+	if err := bucket.PutObjectFromFile(output, outPath, oss.ContentType(mime.TypeByExtension("."+format)), derivedFromOption(source)); err != nil {
+		return fmt.Errorf("failed to upload transcoded object: %v", err)
+	}
+	return nil
+}
+
+// 调用 ffmpeg 转码音频或视频，输出格式由输出文件扩展名决定
+// 片段的 -ss 放在 -i 之前，ffmpeg 直接定位到起点而不是从头解码
+func runFFmpeg(inPath, outPath, format string, clip mediaClip, opts transcodeOptions) error {
+	args := []string{"-y"}
+	if clip.start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(clip.start, 'f', -1, 64))
+	}
+	args = append(args, "-i", inPath)
+	if clip.duration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(clip.duration, 'f', -1, 64))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.ffmpegTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, opts.ffmpegPath, append(args, outPath)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return classifyFFmpegError(ctx, err, stderr.String(), opts.ffmpegTimeout)
+	}
+	return nil
+}
+
+// 使用标准库解码并重新编码图片，不依赖外部工具
+func convertImage(inPath, outPath, format string, clip mediaClip, opts transcodeOptions) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	img, _, err := image.Decode(in)
+	if err != nil {
+		// 无法解码说明格式不支持或文件已损坏，重试没有意义
+		return permanentError{fmt.Errorf("failed to decode image: %v", err)}
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	switch format {
+	case "png":
+		err = png.Encode(out, img)
+	case "jpg", "jpeg":
+		err = jpeg.Encode(out, img, &jpeg.Options{Quality: 90})
+	case "gif":
+		err = gif.Encode(out, img, nil)
+	default:
+		return permanentError{fmt.Errorf("unsupported image format '%s'", format)}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode image: %v", err)
+	}
+	return out.Close()
+}
+
+// 区分 ffmpeg 的暂时性失败（磁盘满、被信号中断等）和永久性失败（输入格式不支持等）
+func classifyFFmpegError(ctx context.Context, err error, stderr string, timeout time.Duration) error {
+	// 超时的输入（例如损坏或过长的文件）重试通常仍会超时
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return permanentError{fmt.Errorf("ffmpeg did not finish within %s", timeout)}
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return permanentError{fmt.Errorf("ffmpeg not available: %v", err)}
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("failed to run ffmpeg: %v", err)
+	}
+	detail := lastLine(stderr)
+	for _, marker := range permanentFFmpegMarkers {
+		if strings.Contains(stderr, marker) {
+			return permanentError{fmt.Errorf("ffmpeg rejected input: %s", detail)}
+		}
+	}
+	return fmt.Errorf("ffmpeg exited with code %d: %s", exitErr.ExitCode(), detail)
+}
+
+// 取输出的最后一个非空行，ffmpeg 通常把错误原因写在最后
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
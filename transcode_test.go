@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 写一个代替 ffmpeg/ffprobe 的脚本
+func fakeTool(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProbeDuration(t *testing.T) {
+	opts := transcodeOptions{ffprobePath: fakeTool(t, "echo 12.5"), ffprobeTimeout: 5 * time.Second}
+	total, err := probeDuration(context.Background(), "input.mp4", opts)
+	if err != nil || total != 12.5 {
+		t.Fatalf("probeDuration() = %g, %v, want 12.5", total, err)
+	}
+}
+
+func TestProbeDurationTimeout(t *testing.T) {
+	opts := transcodeOptions{ffprobePath: fakeTool(t, "exec sleep 10"), ffprobeTimeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err := probeDuration(context.Background(), "input.mp4", opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("probeDuration() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("probeDuration() returned after %s, want the process killed at the timeout", elapsed)
+	}
+}
+
+func TestRunFFmpegTimeout(t *testing.T) {
+	opts := transcodeOptions{ffmpegPath: fakeTool(t, "exec sleep 10"), ffmpegTimeout: 100 * time.Millisecond}
+	dir := t.TempDir()
+	start := time.Now()
+	err := runFFmpeg(filepath.Join(dir, "in.mp4"), filepath.Join(dir, "out.mp3"), "mp3", mediaClip{}, opts)
+	if err == nil || isRetryable(err) {
+		t.Fatalf("runFFmpeg() error = %v, want a permanent timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runFFmpeg() returned after %s, want the process killed at the timeout", elapsed)
+	}
+}
+
+func TestRunFFmpegFailureRetryable(t *testing.T) {
+	opts := transcodeOptions{ffmpegPath: fakeTool(t, "echo 'Conversion failed!' >&2; exit 1"), ffmpegTimeout: 5 * time.Second}
+	dir := t.TempDir()
+	err := runFFmpeg(filepath.Join(dir, "in.mp4"), filepath.Join(dir, "out.mp3"), "mp3", mediaClip{}, opts)
+	if err == nil || !isRetryable(err) {
+		t.Fatalf("runFFmpeg() error = %v, want a retryable error", err)
+	}
+}
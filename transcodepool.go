@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// transcodePool 用固定数量的 worker 执行转码任务，排队的任务数不超过 queueSize
+// 提交前先用 reserve 占一个名额（执行中或排队中），名额用完时调用方应拒绝请求，而不是无限制地积压任务
+type transcodePool struct {
+	slots     chan struct{} // 容量为 workers+queueSize，任务执行完才释放
+	tasks     chan func()
+	workers   int
+	queueSize int
+	active    atomic.Int64
+	rejected  atomic.Int64
+}
+
+func newTranscodePool(workers, queueSize int) *transcodePool {
+	p := &transcodePool{
+		slots:     make(chan struct{}, workers+queueSize),
+		tasks:     make(chan func(), workers+queueSize),
+		workers:   workers,
+		queueSize: queueSize,
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *transcodePool) work() {
+	for task := range p.tasks {
+		p.active.Add(1)
+		task()
+		p.active.Add(-1)
+		<-p.slots
+	}
+}
+
+// 尝试占一个名额，队列已满时返回 false；成功后必须调用 submit
+func (p *transcodePool) reserve() bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		p.rejected.Add(1)
+		return false
+	}
+}
+
+// 提交一个已经占到名额的任务，不会阻塞
+func (p *transcodePool) submit(task func()) {
+	p.tasks <- task
+}
+
+func (p *transcodePool) stats() gin.H {
+	return gin.H{
+		"queued":        len(p.tasks),
+		"queueCapacity": p.queueSize,
+		"active":        p.active.Load(),
+		"workers":       p.workers,
+		"rejected":      p.rejected.Load(),
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 回收站对象的自定义元数据：原始对象名（URL 编码，元数据只能是 ASCII）和移入时间
+const (
+	trashMetaOriginalKey = "original-key"
+	trashMetaDeletedAt   = "deleted-at"
+)
+
+var errNotInTrash = errors.New("object is not in trash")
+
+// 回收站中对应的对象名；同一个对象多次删除时，回收站只保留最后一次的版本
+func trashKey(trashPrefix, key string) string {
+	return trashPrefix + key
+}
+
+// 软删除：先复制到回收站前缀下并记录原始对象名，复制成功后再删除原对象
+// 使用 REPLACE 复制才能写入新的元数据，因此需要把原对象的类型、缓存头和自定义元数据一并带上
+func moveToTrash(bucket *oss.Bucket, key, trashPrefix string) (string, error) {
+	meta, err := bucket.GetObjectDetailedMeta(key)
+	if err != nil {
+		return "", err
+	}
+	dest := trashKey(trashPrefix, key)
+	options := append(objectHeaderOptions(meta),
+		oss.MetadataDirective(oss.MetaReplace),
+		oss.Meta(trashMetaOriginalKey, url.PathEscape(key)),
+		oss.Meta(trashMetaDeletedAt, time.Now().UTC().Format(time.RFC3339)),
+		oss.CopySourceIfMatch(meta.Get("ETag")),
+	)
+	if _, err := bucket.CopyObject(key, dest, options...); err != nil {
+		return "", fmt.Errorf("failed to copy to trash: %w", err)
+	}
+	if err := bucket.DeleteObject(key); err != nil {
+		return "", fmt.Errorf("copied to trash but failed to delete original: %w", err)
+	}
+	return dest, nil
+}
+
+// 从回收站恢复：按元数据中记录的原始对象名复制回去，并去掉回收站相关的元数据
+// overwrite 为 false 时原位置已有对象则返回 FileAlreadyExists
+func restoreFromTrash(bucket *oss.Bucket, key, trashPrefix string, overwrite bool) (string, error) {
+	src := trashKey(trashPrefix, key)
+	meta, err := bucket.GetObjectDetailedMeta(src)
+	if err != nil {
+		if isNoSuchKey(err) {
+			return "", errNotInTrash
+		}
+		return "", err
+	}
+	original := strings.TrimPrefix(src, trashPrefix)
+	if recorded := meta.Get("X-Oss-Meta-" + trashMetaOriginalKey); recorded != "" {
+		if decoded, err := url.PathUnescape(recorded); err == nil {
+			original = decoded
+		}
+	}
+	options := append(objectHeaderOptions(meta, trashMetaOriginalKey, trashMetaDeletedAt),
+		oss.MetadataDirective(oss.MetaReplace),
+		oss.CopySourceIfMatch(meta.Get("ETag")),
+	)
+	if !overwrite {
+		options = append(options, oss.ForbidOverWrite(true))
+	}
+	if _, err := bucket.CopyObject(src, original, options...); err != nil {
+		return "", err
+	}
+	if err := bucket.DeleteObject(src); err != nil {
+		return "", fmt.Errorf("restored but failed to remove trash copy: %w", err)
+	}
+	return original, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// treeNode 目录树中的一个节点：type 为 folder 时 children 是下一层的目录和文件，
+// 达到深度上限（或节点数、列举次数、时间上限）而没有展开的目录 expanded 为 false
+type treeNode struct {
+	Name         string      `json:"name"`
+	Path         string      `json:"path"` // 文件为对象名，目录为以 "/" 结尾的前缀
+	Type         string      `json:"type"`
+	Size         int64       `json:"size,omitempty"`
+	LastModified *time.Time  `json:"lastModified,omitempty"`
+	Expanded     bool        `json:"expanded,omitempty"`
+	Children     []*treeNode `json:"children,omitempty"`
+}
+
+// 目录树的规模统计；truncated 为 true 表示达到节点数、列举次数或时间上限，树不完整
+type treeStats struct {
+	Nodes     int  `json:"nodes"`
+	ListCalls int  `json:"listCalls"`
+	Truncated bool `json:"truncated"`
+}
+
+// 构造目录树的上限：层数、节点总数、列举请求次数和截止时间（零值表示不限制）
+// 每个目录至少需要一次列举请求，目录很多而文件很少时节点数上限起不到作用，因此另外限制列举次数和时间
+type treeLimits struct {
+	maxDepth     int
+	maxNodes     int
+	maxListCalls int
+	deadline     time.Time
+}
+
+// 以 "/" 为分隔符逐层列举 prefix，构造不超过 limits 的目录树
+// 目录标记（与目录同名的 0 字节对象）和 skip 中的内部前缀不出现在树中
+func buildTree(l objectLister, prefix string, limits treeLimits, skip []string) (*treeNode, treeStats, error) {
+	root := &treeNode{Name: treeName(prefix), Path: prefix, Type: "folder"}
+	stats := treeStats{}
+	err := expandTree(l, root, 1, limits, skip, &stats)
+	return root, stats, err
+}
+
+func expandTree(l objectLister, node *treeNode, depth int, limits treeLimits, skip []string, stats *treeStats) error {
+	var folders []*treeNode
+	token := ""
+	for {
+		// 第一次列举不设截止时间，保证至少返回顶层的一页
+		deadline := limits.deadline
+		if stats.ListCalls == 0 {
+			deadline = time.Time{}
+		}
+		if stats.ListCalls >= limits.maxListCalls || (!deadline.IsZero() && time.Now().After(deadline)) {
+			stats.Truncated = true
+			return nil
+		}
+		stats.ListCalls++
+		page, _, timedOut, err := l.pageBefore(deadline, node.Path, "/", token)
+		if timedOut {
+			stats.Truncated = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		node.Expanded = true
+		for _, p := range page.prefixes {
+			if hasAnyPrefix(p, skip) {
+				continue
+			}
+			if stats.Nodes >= limits.maxNodes {
+				stats.Truncated = true
+				return nil
+			}
+			stats.Nodes++
+			folder := &treeNode{Name: treeName(p), Path: p, Type: "folder"}
+			node.Children = append(node.Children, folder)
+			folders = append(folders, folder)
+		}
+		for _, object := range page.objects {
+			if object.Key == node.Path || isDirectoryMarker(object) || hasAnyPrefix(object.Key, skip) {
+				continue
+			}
+			if stats.Nodes >= limits.maxNodes {
+				stats.Truncated = true
+				return nil
+			}
+			stats.Nodes++
+			modified := object.LastModified
+			node.Children = append(node.Children, &treeNode{
+				Name:         treeName(object.Key),
+				Path:         object.Key,
+				Type:         "file",
+				Size:         object.Size,
+				LastModified: &modified,
+			})
+		}
+		if !page.truncated {
+			break
+		}
+		token = page.next
+	}
+	if depth >= limits.maxDepth {
+		return nil
+	}
+	for _, folder := range folders {
+		if err := expandTree(l, folder, depth+1, limits, skip, stats); err != nil {
+			return err
+		}
+		if stats.Truncated {
+			return nil
+		}
+	}
+	return nil
+}
+
+// 路径的最后一段，目录保留结尾的 "/"
+func treeName(path string) string {
+	trimmed := strings.TrimSuffix(path, "/")
+	name := trimmed[strings.LastIndex(trimmed, "/")+1:]
+	if name != "" && strings.HasSuffix(path, "/") {
+		name += "/"
+	}
+	return name
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// 每个目录下只有一个文件：节点数上限起不到作用，由列举次数上限截断
+func newTreeFixture(t *testing.T, folders int) *fakeOSS {
+	fake := newFakeOSS(t)
+	for i := 0; i < folders; i++ {
+		fake.put(fmt.Sprintf("d%02d/f.txt", i), []byte("x"), nil)
+	}
+	return fake
+}
+
+func TestBuildTreeComplete(t *testing.T) {
+	fake := newTreeFixture(t, 3)
+	limits := treeLimits{maxDepth: 5, maxNodes: 100, maxListCalls: 100}
+	root, stats, err := buildTree(objectLister{bucket: fake.bucket(t)}, "", limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Truncated || stats.Nodes != 6 || stats.ListCalls != 4 {
+		t.Errorf("stats = %+v, want 6 nodes, 4 list calls, not truncated", stats)
+	}
+	if len(root.Children) != 3 || !root.Children[0].Expanded || len(root.Children[0].Children) != 1 {
+		t.Errorf("tree = %+v, want 3 expanded folders with one file each", root.Children)
+	}
+}
+
+func TestBuildTreeListCallBudget(t *testing.T) {
+	fake := newTreeFixture(t, 10)
+	limits := treeLimits{maxDepth: 5, maxNodes: 1000, maxListCalls: 3}
+	root, stats, err := buildTree(objectLister{bucket: fake.bucket(t)}, "", limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Truncated || stats.ListCalls != 3 {
+		t.Errorf("stats = %+v, want truncated after 3 list calls", stats)
+	}
+	expanded := 0
+	for _, folder := range root.Children {
+		if folder.Expanded {
+			expanded++
+		}
+	}
+	if len(root.Children) != 10 || expanded != 2 {
+		t.Errorf("got %d folders with %d expanded, want 10 with 2 expanded", len(root.Children), expanded)
+	}
+}
+
+// 超过截止时间后停止展开，但顶层总是列举完第一页
+func TestBuildTreeDeadline(t *testing.T) {
+	fake := newTreeFixture(t, 3)
+	fake.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		time.Sleep(50 * time.Millisecond)
+		return true
+	}
+	limits := treeLimits{maxDepth: 5, maxNodes: 100, maxListCalls: 100, deadline: time.Now().Add(10 * time.Millisecond)}
+	root, stats, err := buildTree(objectLister{bucket: fake.bucket(t)}, "", limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Truncated || len(root.Children) != 3 || !root.Expanded {
+		t.Errorf("stats = %+v with %d top-level nodes, want the top level listed and the tree truncated", stats, len(root.Children))
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 带过期时间的对象在元数据中记录到期时间（RFC 3339，UTC）
+const (
+	ttlMetaKey    = "expires-at"
+	ttlMetaHeader = "X-Oss-Meta-Expires-At"
+)
+
+// 过期索引：每个带 TTL 的对象对应一个空的索引对象 <indexPrefix><到期 Unix 秒（补零到 20 位）>/<URL 编码的对象名>
+// 列举结果按字典序返回，也就是按到期时间排序，清理时遇到第一个未到期的索引即可停止，不必查看所有对象
+func ttlIndexKey(indexPrefix string, expiresAt time.Time, key string) string {
+	return fmt.Sprintf("%s%020d/%s", indexPrefix, expiresAt.Unix(), url.PathEscape(key))
+}
+
+// 解析索引对象名，返回到期时间和原始对象名
+func parseTTLIndexKey(indexPrefix, indexKey string) (time.Time, string, error) {
+	ts, escaped, ok := strings.Cut(strings.TrimPrefix(indexKey, indexPrefix), "/")
+	if !ok {
+		return time.Time{}, "", fmt.Errorf("malformed ttl index key %q", indexKey)
+	}
+	seconds, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("malformed ttl index key %q", indexKey)
+	}
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("malformed ttl index key %q", indexKey)
+	}
+	return time.Unix(seconds, 0), key, nil
+}
+
+// 写入过期索引，对象本身已经在上传时带上了 expires-at 元数据
+func scheduleExpiry(bucket *oss.Bucket, indexPrefix, key string, expiresAt time.Time) error {
+	return bucket.PutObject(ttlIndexKey(indexPrefix, expiresAt, key), strings.NewReader(""))
+}
+
+// 删除所有已到期的对象，返回删除的数量
+// 对象在到期前被覆盖（元数据中的到期时间不再一致）或已被删除时，只清理索引，不删除对象
+func sweepExpiredObjects(bucket *oss.Bucket, indexPrefix string, now time.Time, deleted func(key string)) (int, error) {
+	count := 0
+	marker := ""
+	for {
+		res, err := bucket.ListObjects(oss.Prefix(indexPrefix), oss.Marker(marker), oss.MaxKeys(1000))
+		if err != nil {
+			return count, err
+		}
+		for _, object := range res.Objects {
+			expiresAt, key, err := parseTTLIndexKey(indexPrefix, object.Key)
+			if err != nil {
+				log.Printf("Skipping ttl index entry: %v", err)
+				continue
+			}
+			if expiresAt.After(now) {
+				return count, nil
+			}
+			meta, err := bucket.GetObjectDetailedMeta(key)
+			switch {
+			case err == nil && meta.Get(ttlMetaHeader) == expiresAt.UTC().Format(time.RFC3339):
+				if err := bucket.DeleteObject(key); err != nil {
+					return count, fmt.Errorf("failed to delete expired object %s: %v", key, err)
+				}
+				count++
+				deleted(key)
+			case err != nil && !isNoSuchKey(err):
+				return count, err
+			}
+			if err := bucket.DeleteObject(object.Key); err != nil {
+				return count, fmt.Errorf("failed to delete ttl index %s: %v", object.Key, err)
+			}
+		}
+		if !res.IsTruncated {
+			return count, nil
+		}
+		marker = res.NextMarker
+	}
+}
+
+// 后台定期清理到期对象，ctx 取消（服务退出）时停止；interval 为 0 时不启动
+func startExpirySweeper(ctx context.Context, bucket *oss.Bucket, indexPrefix string, interval time.Duration, deleted func(key string)) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			count, err := sweepExpiredObjects(bucket, indexPrefix, time.Now(), deleted)
+			if err != nil {
+				log.Printf("Failed to sweep expired objects: %v", err)
+			}
+			if count > 0 {
+				log.Printf("Deleted %d expired object(s)", count)
+			}
+		}
+	}()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/gin-gonic/gin"
+)
+
+// uploadParams POST /upload 和 PUT /upload/:object 共用的上传参数
+type uploadParams struct {
+	options         []oss.Option // 随对象保存的头、元数据和 ACL，不含覆盖检查
+	acl             string
+	forbidOverwrite bool
+	createOnly      bool      // 由 If-None-Match: * 指定，对象已存在时返回 412 而不是 409
+	ttlExpiresAt    time.Time // 为零值时对象不过期
+	validateImage   bool
+}
+
+// 写入对象时使用的选项：禁止覆盖时由 OSS 在写入时原子地判断，避免"先检查再上传"在并发上传时的竞态
+func (p uploadParams) putOptions() []oss.Option {
+	options := append([]oss.Option(nil), p.options...)
+	if p.forbidOverwrite {
+		options = append(options, oss.ForbidOverWrite(true))
+	}
+	return options
+}
+
+func (p uploadParams) completeOptions() []oss.Option {
+	if p.forbidOverwrite {
+		return []oss.Option{oss.ForbidOverWrite(true)}
+	}
+	return nil
+}
+
+// 上传失败时的状态码和提示：对象已存在时 If-None-Match: * 按条件请求的语义返回 412，overwrite=false 返回 409
+func (p uploadParams) failure(err error, objectName string) (int, string) {
+	if !isAlreadyExists(err) {
+		return http.StatusInternalServerError, "Failed to upload file to OSS"
+	}
+	if p.createOnly {
+		return http.StatusPreconditionFailed, fmt.Sprintf("Object '%s' already exists", objectName)
+	}
+	return http.StatusConflict, fmt.Sprintf("Object '%s' already exists", objectName)
+}
+
+// 解析上传参数，出错时返回应使用的状态码；param 取客户端参数（表单上传同时读表单和查询参数，原始请求体上传只读查询参数）
+//   - cacheControl、contentEncoding、expires：随对象保存的头，之后下载时原样返回
+//   - ttl（秒）：到期后对象由后台清理任务删除，到期时间记录在对象元数据中，只支持默认存储桶
+//   - overwrite=true|false：覆盖 UPLOAD_FORBID_OVERWRITE；If-None-Match: * 表示仅在不存在时创建
+//   - acl：覆盖 DEFAULT_OBJECT_ACL，都未指定时继承存储桶的 ACL；public-read-write 需要 ADMIN_TOKEN
+//   - validateImage=true|false：覆盖 UPLOAD_VALIDATE_IMAGES
+func uploadOptions(c *gin.Context, param func(string) string, cfg *Config, defaultBucket bool) (uploadParams, int, error) {
+	var p uploadParams
+	if cacheControl := param("cacheControl"); cacheControl != "" {
+		p.options = append(p.options, oss.CacheControl(cacheControl))
+	}
+	// 预先压缩过的文件通过 contentEncoding 声明编码，下载时原样返回 Content-Encoding，浏览器会自动解压
+	if value := param("contentEncoding"); value != "" {
+		if !validContentEncoding(value) {
+			return p, http.StatusBadRequest, fmt.Errorf("unsupported contentEncoding %q", value)
+		}
+		p.options = append(p.options, oss.ContentEncoding(value))
+	}
+	if value := param("expires"); value != "" {
+		expires, err := parseExpiresHeader(value, time.Now())
+		if err != nil {
+			return p, http.StatusBadRequest, err
+		}
+		p.options = append(p.options, oss.Expires(expires))
+	}
+	if value := param("ttl"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds <= 0 {
+			return p, http.StatusBadRequest, fmt.Errorf("invalid ttl value %q", value)
+		}
+		// 过期清理任务只扫描默认存储桶
+		if !defaultBucket {
+			return p, http.StatusBadRequest, fmt.Errorf("ttl is only supported on the default bucket")
+		}
+		p.ttlExpiresAt = time.Now().Add(time.Duration(seconds) * time.Second).Truncate(time.Second)
+		p.options = append(p.options, oss.Meta(ttlMetaKey, p.ttlExpiresAt.UTC().Format(time.RFC3339)))
+	}
+	p.validateImage = cfg.UploadValidateImages
+	switch param("validateImage") {
+	case "true":
+		p.validateImage = true
+	case "false":
+		p.validateImage = false
+	}
+	p.forbidOverwrite = cfg.UploadForbidOverwrite
+	switch param("overwrite") {
+	case "true":
+		p.forbidOverwrite = false
+	case "false":
+		p.forbidOverwrite = true
+	}
+	switch value := c.GetHeader("If-None-Match"); value {
+	case "":
+	case "*":
+		p.createOnly, p.forbidOverwrite = true, true
+	default:
+		return p, http.StatusBadRequest, fmt.Errorf("If-None-Match only supports '*' on upload")
+	}
+	p.acl = cfg.DefaultObjectACL
+	if value := param("acl"); value != "" {
+		// public-read-write 允许任何人改写对象，客户端只能在携带 ADMIN_TOKEN 时指定；DEFAULT_OBJECT_ACL 不受此限制
+		if value == string(oss.ACLPublicReadWrite) && (cfg.AdminToken == "" || !tokenMatches(c, "X-Admin-Token", cfg.AdminToken)) {
+			return p, http.StatusForbidden, fmt.Errorf("acl %q requires the admin token", value)
+		}
+		p.acl = value
+	}
+	if aclType, ok := objectACLs[p.acl]; ok {
+		p.options = append(p.options, oss.ObjectACL(aclType))
+	} else if p.acl != "" {
+		return p, http.StatusBadRequest, fmt.Errorf("invalid acl %q, must be one of default, private, public-read, public-read-write", p.acl)
+	} else {
+		p.acl = string(oss.ACLDefault)
+	}
+	return p, 0, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 与 PUT /upload/:object 相同的参数处理和错误映射，写入 fake OSS
+func newUploadRouter(t *testing.T, fake *fakeOSS, cfg *Config) *gin.Engine {
+	bucket := fake.bucket(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/upload/:object", func(c *gin.Context) {
+		params, status, err := uploadOptions(c, c.Query, cfg, true)
+		if err != nil {
+			c.JSON(status, gin.H{"message": err.Error()})
+			return
+		}
+		if err := bucket.PutObject(c.Param("object"), c.Request.Body, params.putOptions()...); err != nil {
+			status, message := params.failure(err, c.Param("object"))
+			c.JSON(status, gin.H{"message": message})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"acl": params.acl})
+	})
+	return r
+}
+
+// 两个同时进行的 If-None-Match: * 上传：OSS 在写入时原子地判断，恰好一个成功，另一个返回 412
+func TestConcurrentCreateOnlyUploads(t *testing.T) {
+	fake := newFakeOSS(t)
+	// 两个写入请求都到达 OSS 后才开始处理，确保它们确实是并发的
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	fake.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodPut {
+			arrived.Done()
+			arrived.Wait()
+		}
+		return true
+	}
+	server := httptest.NewServer(newUploadRouter(t, fake, &Config{}))
+	defer server.Close()
+
+	statuses := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodPut, server.URL+"/upload/report.txt", strings.NewReader("writer "+string(rune('A'+i))))
+			req.Header.Set("If-None-Match", "*")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}()
+	}
+	wg.Wait()
+
+	ok, failed := 0, 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			ok++
+		case http.StatusPreconditionFailed:
+			failed++
+		}
+	}
+	if ok != 1 || failed != 1 {
+		t.Fatalf("statuses = %v, want exactly one 200 and one 412", statuses)
+	}
+	obj, _ := fake.object("report.txt")
+	if content := string(obj.data); content != "writer A" && content != "writer B" {
+		t.Errorf("object content = %q", content)
+	}
+}
+
+func TestUploadOptionsOverwrite(t *testing.T) {
+	fake := newFakeOSS(t)
+	fake.put("existing.txt", []byte("old"), nil)
+	tests := []struct {
+		name        string
+		cfg         *Config
+		query       string
+		ifNoneMatch string
+		want        int
+	}{
+		{"overwrite allowed by default", &Config{}, "", "", http.StatusOK},
+		{"overwrite=false", &Config{}, "?overwrite=false", "", http.StatusConflict},
+		{"forbidden by config", &Config{UploadForbidOverwrite: true}, "", "", http.StatusConflict},
+		{"overwrite=true overrides config", &Config{UploadForbidOverwrite: true}, "?overwrite=true", "", http.StatusOK},
+		{"If-None-Match: *", &Config{}, "?overwrite=true", "*", http.StatusPreconditionFailed},
+		{"unsupported If-None-Match", &Config{}, "", `"abc"`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(newUploadRouter(t, fake, tt.cfg))
+			defer server.Close()
+			req, _ := http.NewRequest(http.MethodPut, server.URL+"/upload/existing.txt"+tt.query, strings.NewReader("new"))
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			fake.put("existing.txt", []byte("old"), nil)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// usageGroup 一个下级前缀（"目录"）下全部对象的数量和总大小
+type usageGroup struct {
+	Prefix  string `json:"prefix"`
+	Objects int64  `json:"objects"`
+	Size    int64  `json:"size"`
+}
+
+// usageReport 按下级前缀汇总的存储用量，groups 按总大小降序排列
+// direct 是直接位于 prefix 下、不属于任何下级前缀的对象
+type usageReport struct {
+	Prefix      string       `json:"prefix"`
+	Delimiter   string       `json:"delimiter"`
+	Objects     int64        `json:"objects"`
+	Size        int64        `json:"size"`
+	Direct      usageGroup   `json:"direct"`
+	Groups      []usageGroup `json:"groups"`
+	GeneratedAt time.Time    `json:"generatedAt"`
+}
+
+// 列举 prefix 下的全部对象，按 prefix 之后第一个 delimiter 之前的部分分组汇总
+// 需要遍历所有对象，对象很多时耗时较长，结果应缓存
+func computeUsage(bucket *oss.Bucket, prefix, delimiter string, options ...oss.Option) (usageReport, error) {
+	report := usageReport{Prefix: prefix, Delimiter: delimiter, Direct: usageGroup{Prefix: prefix}}
+	groups := make(map[string]*usageGroup)
+	marker := ""
+	for {
+		res, err := bucket.ListObjects(append(options, oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000))...)
+		if err != nil {
+			return report, fmt.Errorf("failed to list objects: %v", err)
+		}
+		for _, object := range res.Objects {
+			report.Objects++
+			report.Size += object.Size
+			rest := strings.TrimPrefix(object.Key, prefix)
+			i := strings.Index(rest, delimiter)
+			if i < 0 {
+				report.Direct.Objects++
+				report.Direct.Size += object.Size
+				continue
+			}
+			name := prefix + rest[:i+len(delimiter)]
+			g, ok := groups[name]
+			if !ok {
+				g = &usageGroup{Prefix: name}
+				groups[name] = g
+			}
+			g.Objects++
+			g.Size += object.Size
+		}
+		if !res.IsTruncated {
+			break
+		}
+		marker = res.NextMarker
+	}
+	report.Groups = make([]usageGroup, 0, len(groups))
+	for _, g := range groups {
+		report.Groups = append(report.Groups, *g)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Prefix < b.Prefix
+	})
+	report.GeneratedAt = time.Now().UTC()
+	return report, nil
+}
+
+// usageCache 短时间缓存用量报告，ttl 为 0 时不缓存
+type usageCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	reports map[string]usageReport
+}
+
+func newUsageCache(ttl time.Duration) *usageCache {
+	return &usageCache{ttl: ttl, reports: make(map[string]usageReport)}
+}
+
+func usageCacheKey(bucket, prefix, delimiter string) string {
+	return bucket + "\x00" + prefix + "\x00" + delimiter
+}
+
+func (uc *usageCache) get(key string) (usageReport, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	report, ok := uc.reports[key]
+	if !ok || time.Since(report.GeneratedAt) > uc.ttl {
+		return usageReport{}, false
+	}
+	return report, true
+}
+
+// 写入新报告，同时清理已过期的报告
+func (uc *usageCache) put(key string, report usageReport) {
+	if uc.ttl <= 0 {
+		return
+	}
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	for k, r := range uc.reports {
+		if time.Since(r.GeneratedAt) > uc.ttl {
+			delete(uc.reports, k)
+		}
+	}
+	uc.reports[key] = report
+}
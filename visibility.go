@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/gin-gonic/gin"
+)
+
+// 对象的可见性记录在用户元数据 x-oss-meta-<VISIBILITY_META_KEY> 中
+const (
+	visibilityPublic  = "public"
+	visibilityPrivate = "private"
+)
+
+// 读取对象内容前按可见性检查访问权限，返回 false 时已写入错误响应
+// 标记为 private 的对象需在 Authorization: Bearer <key> 或 X-API-Key 中携带 API_KEY；
+// 标记为 public 或未标记的对象不需要鉴权。未配置 API_KEY 时 private 对象一律拒绝读取
+func allowObjectRead(c *gin.Context, meta http.Header, metaKey, apiKey string) bool {
+	if strings.ToLower(meta.Get(oss.HTTPHeaderOssMetaPrefix+metaKey)) != visibilityPrivate {
+		return true
+	}
+	if apiKey == "" {
+		respond(c, http.StatusForbidden, gin.H{
+			"message": "Object is private and API_KEY is not configured",
+		})
+		return false
+	}
+	if !tokenMatches(c, "X-API-Key", apiKey) {
+		respond(c, http.StatusUnauthorized, gin.H{
+			"message": "Object is private, a valid API key is required",
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 事件类型，可通过 WEBHOOK_EVENTS 选择订阅哪些
+const (
+	EventUpload = "upload"
+	EventDelete = "delete"
+)
+
+// 签名头：sha256=<HMAC-SHA256(secret, body) 的十六进制>，接收方用同一个密钥重新计算后比较
+const webhookSignatureHeader = "X-Webhook-Signature"
+
+// webhookEvent 推送给下游系统的事件
+type webhookEvent struct {
+	Type      string    `json:"type"`
+	Key       string    `json:"key"`
+	Size      int64     `json:"size,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// webhookNotifier 在后台 goroutine 中发送事件，慢速或不可用的接收方不会阻塞请求
+type webhookNotifier struct {
+	url        string
+	secret     string
+	events     map[string]bool
+	client     *http.Client
+	maxRetries int
+	queue      chan webhookEvent
+}
+
+// 未配置 WEBHOOK_URL 时返回 nil，nil 的 notifier 调用 notify 不做任何事
+// 推送地址必须满足出站策略，连接时还会再次检查解析出的 IP
+func newWebhookNotifier(cfg *Config, policy *outboundPolicy) (*webhookNotifier, error) {
+	if cfg.WebhookURL == "" {
+		return nil, nil
+	}
+	if err := policy.checkURL(cfg.WebhookURL); err != nil {
+		return nil, fmt.Errorf("WEBHOOK_URL: %v", err)
+	}
+	events := make(map[string]bool)
+	for _, name := range strings.Split(cfg.WebhookEvents, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			events[name] = true
+		}
+	}
+	n := &webhookNotifier{
+		url:        cfg.WebhookURL,
+		secret:     cfg.WebhookSecret,
+		events:     events,
+		client:     policy.client(cfg.WebhookTimeout),
+		maxRetries: cfg.WebhookMaxRetries,
+		queue:      make(chan webhookEvent, 1000),
+	}
+	go n.run()
+	return n, nil
+}
+
+// 把事件放入发送队列；队列已满时丢弃事件并记录日志，保证请求不会被阻塞
+func (n *webhookNotifier) notify(eventType, key string, size int64) {
+	if n == nil || !n.events[eventType] {
+		return
+	}
+	event := webhookEvent{Type: eventType, Key: key, Size: size, Timestamp: time.Now().UTC()}
+	select {
+	case n.queue <- event:
+	default:
+		log.Printf("Webhook queue full, dropping %s event for %s", eventType, key)
+	}
+}
+
+func (n *webhookNotifier) run() {
+	for event := range n.queue {
+		var err error
+		for attempt := 0; attempt <= n.maxRetries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(time.Second << (attempt - 1))
+			}
+			if err = n.send(event); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to deliver %s webhook for %s after %d attempt(s): %v", event.Type, event.Key, n.maxRetries+1, err)
+		}
+	}
+}
+
+func (n *webhookNotifier) send(event webhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signPayload(n.secret, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}